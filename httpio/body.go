@@ -1,15 +1,17 @@
 package httpio
 
 import (
+	"encoding"
 	"encoding/csv"
-	"encoding/json"
-	"encoding/xml"
+	"fmt"
 	"html/template"
 	"net/http"
 	"net/http/httputil"
+	"reflect"
+	"strconv"
 	"sync"
-
-	"github.com/frk/form"
+	"text/template/parse"
+	"time"
 )
 
 // The RequestDump type implements the BodyReader interface.
@@ -18,11 +20,16 @@ type RequestDump struct {
 	Val *[]byte
 	// Indicates whether to dump the request's body as well.
 	Body bool
+	// If set, limits the size of the request's body to MaxBytes bytes.
+	MaxBytes int64
 }
 
 // ReadBody implements the BodyReader interface by dumping the request's
 // payload and setting the reciever's Val pointer to the result.
 func (d RequestDump) ReadBody(r *http.Request) error {
+	if d.Body {
+		LimitBody(nil, r, d.MaxBytes)
+	}
 	dump, err := httputil.DumpRequest(r, d.Body)
 	if err != nil {
 		return ReadError{err}
@@ -32,19 +39,48 @@ func (d RequestDump) ReadBody(r *http.Request) error {
 }
 
 // The JSON type implements both the BodyWriter and the BodyReader interfaces.
+//
+// The reader's options are implemented with the encoding/json package, if any
+// of them is set the Codec registered for "application/json" will be bypassed.
 type JSON struct {
 	// The value to be json encoded and sent in an HTTP response body or
 	// a pointer to the value to be json decoded from an HTTP request's body.
 	Val interface{}
+	// If set, the reader will fail if the body contains an object key
+	// that does not match any exported field of the destination struct.
+	DisallowUnknownFields bool
+	// If set, the reader will decode numbers into an interface{} as
+	// json.Number instead of float64, this preserves the precision
+	// of large integers.
+	UseNumber bool
+	// If set, the reader will fail if the body contains anything
+	// other than whitespace after the first json value.
+	DisallowTrailingData bool
+	// If set, an empty body leaves the value pointed to by Val unchanged
+	// instead of failing with io.EOF.
+	AllowEmpty bool
+	// If set, the body is retained while it is being decoded so that
+	// a failure can be reported as a JSONError with the path and offset
+	// of the offending value.
+	LocateErrors bool
+	// If set, limits the size of the request's body to MaxBytes bytes.
+	MaxBytes int64
 }
 
 // ReadBody implements the BodyReader interface by decoding the request's
-// json body into the reciever's Val field.
+// json body into the reciever's Val field using the Codec registered
+// for the "application/json" media type. If the body cannot be decoded
+// and LocateErrors is set, the returned ReadError will, where possible,
+// wrap a JSONError that reports the path and offset of the failure.
 func (j JSON) ReadBody(r *http.Request) error {
-	if err := json.NewDecoder(r.Body).Decode(j.Val); err != nil {
-		return ReadError{err}
+	LimitBody(nil, r, j.MaxBytes)
+
+	c := mustLookupCodec(contentTypeJSON)
+	if _, ok := c.(jsonCodec); !ok && !j.DisallowUnknownFields &&
+		!j.UseNumber && !j.DisallowTrailingData && !j.AllowEmpty && !j.LocateErrors {
+		return decodeBody(c, r, j.Val)
 	}
-	return nil
+	return j.decode(r.Body)
 }
 
 // WriteInit is a noop, required only to satisfy the BodyWriter interface.
@@ -55,14 +91,10 @@ func (JSON) WriteInit(_ http.ResponseWriter) error {
 const contentTypeJSON = "application/json; charset=utf-8"
 
 // WriteBody implements the BodyWriter interface by json encoding the
-// receiver's Val field and sending the result in the response's body.
+// receiver's Val field, using the Codec registered for the "application/json"
+// media type, and sending the result in the response's body.
 func (j JSON) WriteBody(w http.ResponseWriter, r *http.Request, statusCode int) error {
-	w.Header().Set("Content-Type", contentTypeJSON)
-	w.WriteHeader(statusCode)
-	if err := json.NewEncoder(w).Encode(j.Val); err != nil {
-		return WriteError{err}
-	}
-	return nil
+	return encodeBody(mustLookupCodec(contentTypeJSON), w, statusCode, j.Val)
 }
 
 // The XML type implements both the BodyWriter and the BodyReader interfaces.
@@ -70,15 +102,16 @@ type XML struct {
 	// The value to be xml encoded and sent in an HTTP response body or
 	// a pointer to the value to be xml decoded from an HTTP request's body.
 	Val interface{}
+	// If set, limits the size of the request's body to MaxBytes bytes.
+	MaxBytes int64
 }
 
 // ReadBody implements the BodyReader interface by decoding the request's
-// xml body into the reciever's Val field.
+// xml body into the reciever's Val field using the Codec registered
+// for the "application/xml" media type.
 func (x XML) ReadBody(r *http.Request) error {
-	if err := xml.NewDecoder(r.Body).Decode(x.Val); err != nil {
-		return ReadError{err}
-	}
-	return nil
+	LimitBody(nil, r, x.MaxBytes)
+	return decodeBody(mustLookupCodec(contentTypeXML), r, x.Val)
 }
 
 // WriteInit is a noop, required only to satisfy the BodyWriter interface.
@@ -89,14 +122,10 @@ func (XML) WriteInit(_ http.ResponseWriter) error {
 const contentTypeXML = "application/xml; charset=utf-8"
 
 // WriteBody implements the BodyWriter interface by xml encoding the
-// receiver's Val field and sending the result in the response's body.
+// receiver's Val field, using the Codec registered for the "application/xml"
+// media type, and sending the result in the response's body.
 func (x XML) WriteBody(w http.ResponseWriter, r *http.Request, statusCode int) error {
-	w.Header().Set("Content-Type", contentTypeXML)
-	w.WriteHeader(statusCode)
-	if err := xml.NewEncoder(w).Encode(x.Val); err != nil {
-		return WriteError{err}
-	}
-	return nil
+	return encodeBody(mustLookupCodec(contentTypeXML), w, statusCode, x.Val)
 }
 
 // The Form type implements both the BodyWriter and the BodyReader interfaces.
@@ -104,15 +133,16 @@ type Form struct {
 	// The value to be url encoded and sent in an HTTP response body or
 	// a pointer to the value to be url decoded from an HTTP request's body.
 	Val interface{}
+	// If set, limits the size of the request's body to MaxBytes bytes.
+	MaxBytes int64
 }
 
 // ReadBody implements the BodyReader interface by decoding the request's
-// form body into the reciever's Val field.
+// form body into the reciever's Val field using the Codec registered
+// for the "application/x-www-form-urlencoded" media type.
 func (f Form) ReadBody(r *http.Request) error {
-	if err := form.NewDecoder(r.Body).Decode(f.Val); err != nil {
-		return ReadError{err}
-	}
-	return nil
+	LimitBody(nil, r, f.MaxBytes)
+	return decodeBody(mustLookupCodec(contentTypeForm), r, f.Val)
 }
 
 // WriteInit is a noop, required only to satisfy the BodyWriter interface.
@@ -123,14 +153,11 @@ func (Form) WriteInit(_ http.ResponseWriter) error {
 const contentTypeForm = "application/x-www-form-urlencoded; charset=utf-8"
 
 // WriteBody implements the BodyWriter interface by form encoding the
-// receiver's Val field and sending the result in the response's body.
+// receiver's Val field, using the Codec registered for the
+// "application/x-www-form-urlencoded" media type, and sending
+// the result in the response's body.
 func (f Form) WriteBody(w http.ResponseWriter, r *http.Request, statusCode int) error {
-	w.Header().Set("Content-Type", contentTypeForm)
-	w.WriteHeader(statusCode)
-	if err := form.NewEncoder(w).Encode(f.Val); err != nil {
-		return WriteError{err}
-	}
-	return nil
+	return encodeBody(mustLookupCodec(contentTypeForm), w, statusCode, f.Val)
 }
 
 // The Text type implements the BodyWriter interface.
@@ -172,30 +199,151 @@ const contentTypeHTML = "text/html; charset=utf-8"
 
 // WriteBody implements the BodyWriter interface by executing an html
 // template with the specified Name, passing it the provided Data, and
-// then sending the result as the response's body.
+// then sending the result as the response's body. If the response's
+// Content-Security-Policy header contains a nonce, the template's
+// "cspNonce" function will return it, see HTMLFuncs.
 func (h HTML) WriteBody(w http.ResponseWriter, r *http.Request, code int) error {
-	if t, ok := templateMap[h.Name]; ok {
-		w.Header().Set("Content-Type", contentTypeHTML)
-		w.WriteHeader(code)
-		return t.Execute(w, h.Data)
+	t, ok := templateMap[h.Name]
+	if !ok {
+		return NoTemplateError{h.Name}
+	}
+
+	if nonce := cspNonce(w.Header()); len(nonce) > 0 {
+		if pool, ok := nonceTemplateMap[h.Name]; ok {
+			nt, ok := pool.Get().(*nonceTemplate)
+			if !ok {
+				return WriteError{fmt.Errorf("httpcrud/httpio: cannot clone template %q", h.Name)}
+			}
+			defer pool.Put(nt)
+
+			nt.nonce = nonce
+			defer func() { nt.nonce = "" }()
+			t = nt.t
+		}
 	}
-	return NoTemplateError{h.Name}
+	w.Header().Set("Content-Type", contentTypeHTML)
+	w.WriteHeader(code)
+	return t.Execute(w, h.Data)
+}
+
+// HTMLFuncs returns the functions that the HTML BodyWriter makes available to
+// its templates. The functions must be added to a template, with its Funcs
+// method, before the template is parsed. The functions are:
+//
+//	cspNonce
+//		Returns the nonce of the response's Content-Security-Policy,
+//		see SecurityHeaders, or an empty string if there is none, e.g.
+//		<script nonce="{{ cspNonce }}">...</script>
+func HTMLFuncs() template.FuncMap {
+	return template.FuncMap{"cspNonce": func() string { return "" }}
 }
 
 var registerHTMLTemplatesOnce sync.Once
 var templateMap map[string]*template.Template
 
+// nonceTemplateMap holds the pools of nonceTemplates of
+// the registered templates that use the cspNonce function.
+var nonceTemplateMap map[string]*sync.Pool
+
+// nonceTemplate is a clone of a template whose cspNonce
+// function returns the value of the nonce field.
+type nonceTemplate struct {
+	t     *template.Template
+	nonce string
+}
+
 // RegisterHTMLTemplatesOnce registers the given templates to be used by the HTML BodyWriter implementation.
 // The RegisterHTMLTemplatesOnce function is intended be called once at program start up.
 func RegisterHTMLTemplatesOnce(tmap map[string]*template.Template) {
 	registerHTMLTemplatesOnce.Do(func() {
 		templateMap = make(map[string]*template.Template, len(tmap))
+		nonceTemplateMap = make(map[string]*sync.Pool)
 		for key, val := range tmap {
 			templateMap[key] = val
+			if !usesCSPNonce(val) {
+				continue
+			}
+
+			// The unexecuted copy of the template from which
+			// the pool's nonceTemplates are cloned.
+			base, err := val.Clone()
+			if err != nil {
+				continue
+			}
+			nonceTemplateMap[key] = &sync.Pool{New: func() interface{} {
+				c, err := base.Clone()
+				if err != nil {
+					return nil
+				}
+				nt := new(nonceTemplate)
+				nt.t = c.Funcs(template.FuncMap{"cspNonce": func() string { return nt.nonce }})
+				return nt
+			}}
 		}
 	})
 }
 
+// usesCSPNonce reports whether the template, or any of its associated
+// templates, invokes the cspNonce function.
+func usesCSPNonce(t *template.Template) bool {
+	for _, at := range t.Templates() {
+		if at.Tree != nil && nodeUsesCSPNonce(at.Tree.Root) {
+			return true
+		}
+	}
+	return false
+}
+
+// nodeUsesCSPNonce reports whether the given parse tree node, or any
+// of its descendants, is an identifier of the cspNonce function.
+func nodeUsesCSPNonce(node parse.Node) bool {
+	switch n := node.(type) {
+	case *parse.ListNode:
+		if n == nil {
+			return false
+		}
+		for _, c := range n.Nodes {
+			if nodeUsesCSPNonce(c) {
+				return true
+			}
+		}
+	case *parse.ActionNode:
+		return nodeUsesCSPNonce(n.Pipe)
+	case *parse.PipeNode:
+		if n == nil {
+			return false
+		}
+		for _, c := range n.Cmds {
+			if nodeUsesCSPNonce(c) {
+				return true
+			}
+		}
+	case *parse.CommandNode:
+		for _, c := range n.Args {
+			if nodeUsesCSPNonce(c) {
+				return true
+			}
+		}
+	case *parse.ChainNode:
+		return nodeUsesCSPNonce(n.Node)
+	case *parse.IfNode:
+		return branchUsesCSPNonce(&n.BranchNode)
+	case *parse.RangeNode:
+		return branchUsesCSPNonce(&n.BranchNode)
+	case *parse.WithNode:
+		return branchUsesCSPNonce(&n.BranchNode)
+	case *parse.TemplateNode:
+		return nodeUsesCSPNonce(n.Pipe)
+	case *parse.IdentifierNode:
+		return n.Ident == "cspNonce"
+	}
+	return false
+}
+
+func branchUsesCSPNonce(n *parse.BranchNode) bool {
+	return nodeUsesCSPNonce(n.Pipe) || nodeUsesCSPNonce(n.List) || nodeUsesCSPNonce(n.ElseList)
+}
+
 // The Redirect type implements the BodyWriter interface.
 type Redirect struct {
 	// The URL to which to redirect.
@@ -258,12 +406,14 @@ type CSVWriter struct {
 	FileName string
 	// The HTTP status code to be sent with the response.
 	// SHOULD be set prior to the first call to WriteRow.
-	//
-	// Set by Open to 200 (Status OK) as default. If the embedding code needs
-	// to send a different value it should implement its own Open method, invoke
-	// the embedded Open method to set up the writer and *then* set the StatusCode
-	// field to the desired value.
+	// If not set, 200 (Status OK) will be used.
 	StatusCode int
+	// The field delimiter. If not set, a comma will be used.
+	Delimiter rune
+	// If set, the csv data will be preceded by the UTF-8 byte order
+	// mark, which helps spreadsheet applications like Excel to detect
+	// the encoding of the data.
+	BOM bool
 
 	// The http.ResponseWriter target into which to the csv data will be written.
 	rw http.ResponseWriter
@@ -281,15 +431,23 @@ type CSVWriter struct {
 // then that implementation MUST invoke this method directly.
 func (w *CSVWriter) Open(rw http.ResponseWriter) {
 	w.rw = rw
+	w.csv = nil
 	w.write = w.write1
-	w.StatusCode = http.StatusOK
 }
 
 // Flush flushes the underlying csv.Writer and returns and error if it fails.
-// Flush will be invoked by (CSV).WriteBody indirectly through the StreamWriter
-// interface, if, however, the embedding code overrides this method by providing
-// its own impelmentation then that implementation MUST invoke this method directly.
+// If no rows were written, Flush writes the response with just the list of
+// field names. Flush will be invoked by (CSV).WriteBody indirectly through the
+// StreamWriter interface, if, however, the embedding code overrides this method
+// by providing its own impelmentation then that implementation MUST invoke
+// this method directly.
 func (w *CSVWriter) Flush() error {
+	if w.csv == nil {
+		if err := w.start(); err != nil {
+			return err
+		}
+		w.write = w.write2
+	}
 	w.csv.Flush()
 	return w.csv.Error()
 }
@@ -300,17 +458,105 @@ func (w *CSVWriter) WriteRow(row []string) error {
 	return w.write(row)
 }
 
+// WriteStruct writes the given struct, or each element of the given slice
+// of structs, as a row to the underlying http.ResponseWriter. The fields of
+// the struct are mapped to the row's columns using the fields' "csv" tags,
+// like the encoding/json package does with the "json" tags. If the writer's
+// Header is set, each of its names is matched to a field case-insensitively,
+// the same way the CSVReader maps the columns, and the row's columns are
+// written in the Header's order. If the writer's Header is not set, the first
+// call to WriteStruct sets it to the list of the fields' names.
+//
+// Values that implement the encoding.TextMarshaler interface are encoded
+// with their MarshalText method, time.Time values are formatted as RFC 3339,
+// nil pointers are written as empty strings, and other values are formatted
+// with the fmt package.
+func (w *CSVWriter) WriteStruct(v interface{}) error {
+	rv := reflect.ValueOf(v)
+	for rv.Kind() == reflect.Ptr && !rv.IsNil() {
+		rv = rv.Elem()
+	}
+
+	if rv.Kind() == reflect.Slice || rv.Kind() == reflect.Array {
+		for i := 0; i < rv.Len(); i++ {
+			if err := w.WriteStruct(rv.Index(i).Interface()); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if rv.Kind() != reflect.Struct {
+		return fmt.Errorf("httpcrud/httpio: CSVWriter.WriteStruct: unsupported type %T", v)
+	}
+
+	fields := structFields(rv.Type(), "csv")
+	if len(w.Header) == 0 {
+		w.Header = make([]string, len(fields))
+		for i, f := range fields {
+			w.Header[i] = f.name
+		}
+	} else {
+		columns := make([]structField, len(w.Header))
+		for i, name := range w.Header {
+			f, ok := findStructFieldFold(fields, name)
+			if !ok {
+				return fmt.Errorf("httpcrud/httpio: CSVWriter.WriteStruct: unknown column %q for type %s", name, rv.Type())
+			}
+			columns[i] = f
+		}
+		fields = columns
+	}
+
+	row := make([]string, len(fields))
+	for i, f := range fields {
+		fv := fieldByIndex(rv, f.index)
+		if !fv.IsValid() {
+			continue
+		}
+		s, err := formatCSVValue(fv)
+		if err != nil {
+			return err
+		}
+		row[i] = s
+	}
+	return w.write(row)
+}
+
 const contentTypeCSV = "text/csv"
 
-// write1 sets the csv specific http headers, initializes the underlying
-// csv.Writer and writes the list of field names and the given row to it.
-func (w *CSVWriter) write1(row []string) error {
-	w.rw.Header().Set("Content-Disposition", "attachment; filename="+w.FileName)
+// start sets the csv specific http headers, writes the status code, and
+// initializes the underlying csv.Writer and writes the list of field names to it.
+func (w *CSVWriter) start() error {
+	if len(w.FileName) > 0 {
+		w.rw.Header().Set("Content-Disposition", contentDisposition("attachment", w.FileName))
+	} else {
+		w.rw.Header().Set("Content-Disposition", "attachment")
+	}
 	w.rw.Header().Set("Content-Type", contentTypeCSV)
+	if w.StatusCode == 0 {
+		w.StatusCode = http.StatusOK
+	}
 	w.rw.WriteHeader(w.StatusCode)
 
+	if w.BOM {
+		if _, err := w.rw.Write([]byte("\xEF\xBB\xBF")); err != nil {
+			return err
+		}
+	}
+
 	w.csv = csv.NewWriter(w.rw)
-	if err := w.csv.Write(w.Header); err != nil {
+	if w.Delimiter != 0 {
+		w.csv.Comma = w.Delimiter
+	}
+	if len(w.Header) > 0 {
+		return w.csv.Write(w.Header)
+	}
+	return nil
+}
+
+// write1 starts the csv response and writes the given row to it.
+func (w *CSVWriter) write1(row []string) error {
+	if err := w.start(); err != nil {
 		return err
 	}
 	if err := w.csv.Write(row); err != nil {
@@ -325,3 +571,41 @@ func (w *CSVWriter) write1(row []string) error {
 func (w *CSVWriter) write2(row []string) error {
 	return w.csv.Write(row)
 }
+
+// formatCSVValue returns the string representation of the given value.
+func formatCSVValue(v reflect.Value) (string, error) {
+	for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return "", nil
+		}
+		v = v.Elem()
+	}
+
+	if v.Type() == timeType {
+		return v.Interface().(time.Time).Format(time.RFC3339), nil
+	}
+	if v.Type().Implements(textMarshalerType) {
+		b, err := v.Interface().(encoding.TextMarshaler).MarshalText()
+		return string(b), err
+	}
+	if v.CanAddr() && reflect.PtrTo(v.Type()).Implements(textMarshalerType) {
+		b, err := v.Addr().Interface().(encoding.TextMarshaler).MarshalText()
+		return string(b), err
+	}
+
+	switch v.Kind() {
+	case reflect.String:
+		return v.String(), nil
+	case reflect.Bool:
+		return strconv.FormatBool(v.Bool()), nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(v.Int(), 10), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return strconv.FormatUint(v.Uint(), 10), nil
+	case reflect.Float32:
+		return strconv.FormatFloat(v.Float(), 'f', -1, 32), nil
+	case reflect.Float64:
+		return strconv.FormatFloat(v.Float(), 'f', -1, 64), nil
+	}
+	return fmt.Sprint(v.Interface()), nil
+}
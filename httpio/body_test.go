@@ -8,8 +8,10 @@ import (
 	"io"
 	"net/http"
 	"net/http/httptest"
+	"strconv"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/frk/compare"
 	"github.com/frk/form"
@@ -31,21 +33,21 @@ func TestRequestDump_ReadBody(t *testing.T) {
 		name:   "get without body",
 		url:    "https://testing.com",
 		method: "GET",
-		dump:   RequestDump{&[]byte{}, false},
+		dump:   RequestDump{Val: &[]byte{}, Body: false},
 		want:   []byte("GET / HTTP/1.1\r\nHost: testing.com\r\n\r\n"),
 	}, {
 		name:   "post without body",
 		url:    "https://testing.com/a/b/c",
 		method: "POST",
 		body:   `{"foo":"bar"}`,
-		dump:   RequestDump{&[]byte{}, false},
+		dump:   RequestDump{Val: &[]byte{}, Body: false},
 		want:   []byte("POST /a/b/c HTTP/1.1\r\nHost: testing.com\r\n\r\n"),
 	}, {
 		name:   "post with body",
 		url:    "https://testing.com/a/b/c",
 		method: "POST",
 		body:   `{"foo":"bar"}`,
-		dump:   RequestDump{&[]byte{}, true},
+		dump:   RequestDump{Val: &[]byte{}, Body: true},
 		want:   []byte("POST /a/b/c HTTP/1.1\r\nHost: testing.com\r\n\r\n{\"foo\":\"bar\"}"),
 	}}
 
@@ -79,9 +81,20 @@ type testBody struct {
 	Baz     bool     `json:"baz" xml:"baz" form:"baz"`
 }
 
+type testBodyList struct {
+	Items []testBody `json:"items"`
+}
+
 func TestJSON_ReadBody(t *testing.T) {
 	plaintext := `plaintext`
 	syntaxError := json.Unmarshal([]byte(plaintext), &testBody{})
+	typeError := json.Unmarshal([]byte(`{"foo":"test","bar":"x"}`), &testBody{})
+	nestedTypeError := json.Unmarshal([]byte(`{"items":[{"foo":"a"},{"foo":1}]}`), &testBodyList{})
+	unknownError := func() error {
+		dec := json.NewDecoder(strings.NewReader(`{"items":[{"foo":"a","bar":1},{"qux":1}]}`))
+		dec.DisallowUnknownFields()
+		return dec.Decode(&testBodyList{})
+	}()
 
 	tests := []struct {
 		name string
@@ -92,19 +105,70 @@ func TestJSON_ReadBody(t *testing.T) {
 	}{{
 		name: "should fail when empty body",
 		body: ``,
-		json: JSON{&testBody{}},
+		json: JSON{Val: &testBody{}},
 		want: &testBody{},
 		err:  ReadError{io.EOF},
+	}, {
+		name: "should leave Val unchanged when empty body and AllowEmpty",
+		body: "  \n",
+		json: JSON{Val: &testBody{}, AllowEmpty: true},
+		want: &testBody{},
 	}, {
 		name: "should fail when non-json body",
 		body: plaintext,
-		json: JSON{&testBody{}},
+		json: JSON{Val: &testBody{}},
 		want: &testBody{},
 		err:  ReadError{syntaxError},
+	}, {
+		name: "should fail with offset of syntax error",
+		body: plaintext,
+		json: JSON{Val: &testBody{}, LocateErrors: true},
+		want: &testBody{},
+		err:  ReadError{JSONError{Offset: 1, Err: syntaxError}},
+	}, {
+		name: "should fail without path when errors are not located",
+		body: `{"foo":"test","bar":"x"}`,
+		json: JSON{Val: &testBody{}},
+		want: &testBody{Foo: "test"},
+		err:  ReadError{typeError},
+	}, {
+		name: "should fail with path of mistyped value",
+		body: `{"foo":"test","bar":"x"}`,
+		json: JSON{Val: &testBody{}, LocateErrors: true},
+		want: &testBody{Foo: "test"},
+		err:  ReadError{JSONError{Path: "bar", Offset: 23, Err: typeError}},
+	}, {
+		name: "should fail with path of mistyped nested value",
+		body: `{"items":[{"foo":"a"},{"foo":1}]}`,
+		json: JSON{Val: &testBodyList{}, LocateErrors: true},
+		want: &testBodyList{Items: []testBody{{Foo: "a"}, {}}},
+		err:  ReadError{JSONError{Path: "items[1].foo", Offset: 30, Err: nestedTypeError}},
+	}, {
+		name: "should fail with path of unknown field",
+		body: `{"items":[{"foo":"a","bar":1},{"qux":1}]}`,
+		json: JSON{Val: &testBodyList{}, DisallowUnknownFields: true, LocateErrors: true},
+		want: &testBodyList{Items: []testBody{{Foo: "a", Bar: 1}, {}}},
+		err:  ReadError{JSONError{Path: "items[1].qux", Offset: 31, Err: unknownError}},
+	}, {
+		name: "should fail when trailing data",
+		body: `{"foo":"test"} {"foo":"x"}`,
+		json: JSON{Val: &testBody{}, DisallowTrailingData: true},
+		want: &testBody{Foo: "test"},
+		err:  ReadError{JSONError{Offset: 15, Err: errTrailingJSON}},
+	}, {
+		name: "should ignore trailing whitespace",
+		body: "{\"foo\":\"test\"} \n",
+		json: JSON{Val: &testBody{}, DisallowTrailingData: true},
+		want: &testBody{Foo: "test"},
+	}, {
+		name: "should decode numbers as json.Number",
+		body: `{"n":12345678901234567890}`,
+		json: JSON{Val: &map[string]interface{}{}, UseNumber: true},
+		want: &map[string]interface{}{"n": json.Number("12345678901234567890")},
 	}, {
 		name: "should decode json body into Value",
 		body: `{"foo":"test","bar":0.004,"baz":true}`,
-		json: JSON{&testBody{}},
+		json: JSON{Val: &testBody{}},
 		want: &testBody{Foo: "test", Bar: 0.004, Baz: true},
 	}}
 
@@ -123,6 +187,32 @@ func TestJSON_ReadBody(t *testing.T) {
 	}
 }
 
+// TestJSON_UnknownFieldMessage pins the format of the encoding/json error
+// message on which newJSONError relies to locate an unknown field.
+func TestJSON_UnknownFieldMessage(t *testing.T) {
+	for _, key := range []string{"qux", `q"u\\x`, "ключ"} {
+		data, _ := json.Marshal(map[string]int{key: 1})
+		dec := json.NewDecoder(strings.NewReader(string(data)))
+		dec.DisallowUnknownFields()
+		err := dec.Decode(&testBody{})
+		if err == nil {
+			t.Fatalf("%q: got nil error", key)
+		}
+
+		msg := err.Error()
+		if !strings.HasPrefix(msg, jsonUnknownField) {
+			t.Fatalf("%q: got message %q, want prefix %q", key, msg, jsonUnknownField)
+		}
+		got, uerr := strconv.Unquote(msg[len(jsonUnknownField):])
+		if uerr != nil {
+			t.Fatalf("%q: cannot unquote key from %q: %v", key, msg, uerr)
+		}
+		if e := compare.Compare(got, key); e != nil {
+			t.Error(e)
+		}
+	}
+}
+
 func TestJSON_WriteBody(t *testing.T) {
 	tests := []struct {
 		name   string
@@ -134,7 +224,7 @@ func TestJSON_WriteBody(t *testing.T) {
 	}{{
 		name:   "write data",
 		code:   200,
-		json:   JSON{testBody{Foo: "test", Bar: 0.004, Baz: true}},
+		json:   JSON{Val: testBody{Foo: "test", Bar: 0.004, Baz: true}},
 		want:   `{"foo":"test","bar":0.004,"baz":true}` + "\n",
 		header: http.Header{"Content-Type": {contentTypeJSON}},
 	}}
@@ -173,19 +263,19 @@ func TestXML_ReadBody(t *testing.T) {
 	}{{
 		name: "should fail when empty body",
 		body: ``,
-		xml:  XML{&testBody{}},
+		xml:  XML{Val: &testBody{}},
 		want: &testBody{},
 		err:  ReadError{io.EOF},
 	}, {
 		name: "should fail when non-xml body",
 		body: plaintext,
-		xml:  XML{&testBody{}},
+		xml:  XML{Val: &testBody{}},
 		want: &testBody{},
 		err:  ReadError{syntaxError},
 	}, {
 		name: "should decode xml body",
 		body: `<data><foo>test</foo><bar>0.004</bar><baz>true</baz></data>`,
-		xml:  XML{&testBody{}},
+		xml:  XML{Val: &testBody{}},
 		want: &testBody{XMLName: xml.Name{Local: "data"}, Foo: "test", Bar: 0.004, Baz: true},
 	}}
 
@@ -215,7 +305,7 @@ func TestXML_WriteBody(t *testing.T) {
 	}{{
 		name:   "write data",
 		code:   200,
-		xml:    XML{&testBody{Foo: "test", Bar: 0.004, Baz: true}},
+		xml:    XML{Val: &testBody{Foo: "test", Bar: 0.004, Baz: true}},
 		want:   `<data><foo>test</foo><bar>0.004</bar><baz>true</baz></data>`,
 		header: http.Header{"Content-Type": {contentTypeXML}},
 	}}
@@ -254,13 +344,13 @@ func TestForm_ReadBody(t *testing.T) {
 	}{{
 		name: "should fail with incompatible types",
 		body: badtypetext,
-		form: Form{&testBody{}},
+		form: Form{Val: &testBody{}},
 		want: &testBody{},
 		err:  ReadError{valueError},
 	}, {
 		name: "should decode form body",
 		body: `foo=test&bar=0.004&baz=true`,
-		form: Form{&testBody{}},
+		form: Form{Val: &testBody{}},
 		want: &testBody{Foo: "test", Bar: 0.004, Baz: true},
 	}}
 
@@ -289,7 +379,7 @@ func TestForm_WriteBody(t *testing.T) {
 		err    error
 	}{{
 		name:   "write data",
-		form:   Form{&testBody{Foo: "test", Bar: 0.004, Baz: true}},
+		form:   Form{Val: &testBody{Foo: "test", Bar: 0.004, Baz: true}},
 		code:   200,
 		want:   `foo=test&bar=0.004&baz=true`,
 		header: http.Header{"Content-Type": {contentTypeForm}},
@@ -357,14 +447,18 @@ func TestHTML_WriteBody(t *testing.T) {
 	t1 := template.Must(template.New("t").Parse(`<html><body>{{ . }}</body></html>`))
 	t2 := template.Must(template.New("t").Parse(`<html><body style="background-color:{{ . }}">foo</body></html>`))
 
+	t3 := template.Must(template.New("t").Funcs(HTMLFuncs()).Parse(`<script nonce="{{ cspNonce }}">var x = {{ . }};</script>`))
+
 	RegisterHTMLTemplatesOnce(map[string]*template.Template{
 		"page_a": t1,
 		"page_b": t2,
+		"page_n": t3,
 	})
 
 	tests := []struct {
 		name   string
 		html   HTML
+		csp    string
 		code   int
 		want   string
 		header http.Header
@@ -387,6 +481,42 @@ func TestHTML_WriteBody(t *testing.T) {
 		code:   200,
 		want:   `<html><body style="background-color:yellow">foo</body></html>`,
 		header: http.Header{"Content-Type": {contentTypeHTML}},
+	}, {
+		name: "write html with nonce",
+		html: HTML{"page_n", 42},
+		csp:  "default-src 'self'; script-src 'self' 'nonce-abc+/='",
+		code: 200,
+		want: `<script nonce="abc&#43;/=">var x =  42 ;</script>`,
+		header: http.Header{
+			"Content-Type":            {contentTypeHTML},
+			"Content-Security-Policy": {"default-src 'self'; script-src 'self' 'nonce-abc+/='"},
+		},
+	}, {
+		name: "write html with another nonce",
+		html: HTML{"page_n", 7},
+		csp:  "script-src 'nonce-xyz'",
+		code: 200,
+		want: `<script nonce="xyz">var x =  7 ;</script>`,
+		header: http.Header{
+			"Content-Type":            {contentTypeHTML},
+			"Content-Security-Policy": {"script-src 'nonce-xyz'"},
+		},
+	}, {
+		name:   "write html without nonce",
+		html:   HTML{"page_n", 42},
+		code:   200,
+		want:   `<script nonce="">var x =  42 ;</script>`,
+		header: http.Header{"Content-Type": {contentTypeHTML}},
+	}, {
+		name: "write html with nonce unused by template",
+		html: HTML{"page_a", 93459672},
+		csp:  "default-src 'self'; script-src 'self' 'nonce-abc+/='",
+		code: 200,
+		want: `<html><body>93459672</body></html>`,
+		header: http.Header{
+			"Content-Type":            {contentTypeHTML},
+			"Content-Security-Policy": {"default-src 'self'; script-src 'self' 'nonce-abc+/='"},
+		},
 	}, {
 		name:   "no template error",
 		html:   HTML{"page_c", "yellow"},
@@ -398,6 +528,9 @@ func TestHTML_WriteBody(t *testing.T) {
 		t.Run(tt.name, func(t *testing.T) {
 			w := httptest.NewRecorder()
 			w.Code = 0
+			if len(tt.csp) > 0 {
+				w.Header().Set("Content-Security-Policy", tt.csp)
+			}
 
 			err := tt.html.WriteBody(w, nil, tt.code)
 			if e := compare.Compare(err, tt.err); e != nil {
@@ -416,6 +549,47 @@ func TestHTML_WriteBody(t *testing.T) {
 	}
 }
 
+func TestUsesCSPNonce(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want bool
+	}{{
+		name: "action",
+		text: `<script nonce="{{ cspNonce }}"></script>`,
+		want: true,
+	}, {
+		name: "pipeline",
+		text: `{{ if . }}<script nonce="{{ cspNonce | print }}"></script>{{ end }}`,
+		want: true,
+	}, {
+		name: "else branch",
+		text: `{{ range . }}{{ . }}{{ else }}{{ with cspNonce }}{{ . }}{{ end }}{{ end }}`,
+		want: true,
+	}, {
+		name: "associated template",
+		text: `{{ define "x" }}{{ cspNonce }}{{ end }}{{ template "x" }}`,
+		want: true,
+	}, {
+		name: "text",
+		text: `<p>cspNonce</p>{{ "cspNonce" }}`,
+		want: false,
+	}, {
+		name: "comment",
+		text: `{{/* cspNonce */}}<p>{{ . }}</p>`,
+		want: false,
+	}}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpl := template.Must(template.New("t").Funcs(HTMLFuncs()).Parse(tt.text))
+			if e := compare.Compare(usesCSPNonce(tmpl), tt.want); e != nil {
+				t.Error(e)
+			}
+		})
+	}
+}
+
 func TestRedirect_WriteBody(t *testing.T) {
 	tests := []struct {
 		name   string
@@ -498,6 +672,29 @@ func TestCSV_WriteBody(t *testing.T) {
 		want: "foo,bar,baz\n123,456,789\nabc,def,ghi\n",
 		header: http.Header{"Content-Disposition": {"attachment; filename=file.csv"},
 			"Content-Type": {contentTypeCSV}},
+	}, {
+		name: "zero rows",
+		writer: &CSVWriter{
+			Header:   []string{"foo", "bar", "baz"},
+			FileName: "empty.csv",
+		},
+		code: 200,
+		want: "foo,bar,baz\n",
+		header: http.Header{"Content-Disposition": {"attachment; filename=empty.csv"},
+			"Content-Type": {contentTypeCSV}},
+	}, {
+		name: "delimiter and bom",
+		writer: &CSVWriter{
+			Header:    []string{"foo", "bar"},
+			FileName:  "report 2020.csv",
+			Delimiter: ';',
+			BOM:       true,
+		},
+		data: [][]string{{"a;b", "c"}},
+		code: 200,
+		want: "\xEF\xBB\xBFfoo;bar\n\"a;b\";c\n",
+		header: http.Header{"Content-Disposition": {`attachment; filename="report 2020.csv"`},
+			"Content-Type": {contentTypeCSV}},
 	}}
 
 	for _, tt := range tests {
@@ -506,8 +703,8 @@ func TestCSV_WriteBody(t *testing.T) {
 			w.Code = 0
 
 			tt.csv.Stream = tt.writer
-			_ = tt.csv.WriteInit(w)
 			tt.writer.StatusCode = tt.code
+			_ = tt.csv.WriteInit(w)
 			for _, row := range tt.data {
 				if err := tt.writer.WriteRow(row); err != nil {
 					t.Fatal(err)
@@ -529,3 +726,89 @@ func TestCSV_WriteBody(t *testing.T) {
 		})
 	}
 }
+
+func TestCSVWriter_WriteStruct(t *testing.T) {
+	type Embedded struct {
+		Note string `csv:"note"`
+	}
+	type Row struct {
+		ID      int        `csv:"id"`
+		Name    string     `csv:"name"`
+		Price   float64    `csv:"price"`
+		Active  bool       `csv:"active"`
+		Created time.Time  `csv:"created"`
+		Deleted *time.Time `csv:"deleted"`
+		Secret  string     `csv:"-"`
+		*Embedded
+	}
+
+	created := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	rows := []Row{
+		{ID: 1, Name: "foo", Price: 9.5, Active: true, Created: created, Secret: "x", Embedded: &Embedded{"a, b"}},
+		{ID: 2, Name: "bar", Price: 10, Created: created, Deleted: &created},
+	}
+
+	w := httptest.NewRecorder()
+	stream := &CSVWriter{FileName: "données.csv"}
+	body := CSV{stream}
+	if err := body.WriteInit(w); err != nil {
+		t.Fatal(err)
+	}
+	if err := stream.WriteStruct(rows); err != nil {
+		t.Fatal(err)
+	}
+	if err := body.WriteBody(w, nil, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	want := "id,name,price,active,created,deleted,note\n" +
+		"1,foo,9.5,true,2020-01-02T03:04:05Z,,\"a, b\"\n" +
+		"2,bar,10,false,2020-01-02T03:04:05Z,2020-01-02T03:04:05Z,\n"
+	if e := compare.Compare(w.Body.String(), want); e != nil {
+		t.Error(e)
+	}
+	wantcd := `attachment; filename="donn_es.csv"; filename*=UTF-8''donn%C3%A9es.csv`
+	if e := compare.Compare(w.Header().Get("Content-Disposition"), wantcd); e != nil {
+		t.Error(e)
+	}
+
+	if err := stream.WriteStruct(42); err == nil {
+		t.Error("got nil error, want unsupported type error")
+	}
+}
+
+func TestCSVWriter_WriteStruct_Header(t *testing.T) {
+	type Row struct {
+		ID   int    `csv:"id"`
+		Name string `csv:"name"`
+		Note string `csv:"note"`
+	}
+
+	w := httptest.NewRecorder()
+	stream := &CSVWriter{Header: []string{"Name", "id"}}
+	body := CSV{stream}
+	if err := body.WriteInit(w); err != nil {
+		t.Fatal(err)
+	}
+	if err := stream.WriteStruct([]Row{{ID: 1, Name: "foo", Note: "x"}, {ID: 2, Name: "bar"}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := body.WriteBody(w, nil, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	want := "Name,id\nfoo,1\nbar,2\n"
+	if e := compare.Compare(w.Body.String(), want); e != nil {
+		t.Error(e)
+	}
+
+	stream = &CSVWriter{Header: []string{"id", "price"}}
+	err := stream.WriteStruct(Row{ID: 1})
+	wanterr := `httpcrud/httpio: CSVWriter.WriteStruct: unknown column "price" for type httpio.Row`
+	if err == nil {
+		t.Fatal("got nil error, want unknown column error")
+	}
+	if e := compare.Compare(err.Error(), wanterr); e != nil {
+		t.Error(e)
+	}
+}
@@ -0,0 +1,422 @@
+package httpio
+
+import (
+	"bufio"
+	"container/list"
+	"errors"
+	"net"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// The defaults of the ResponseCache's limits.
+const (
+	defaultCacheMaxEntries   = 1000
+	defaultCacheMaxBodyBytes = 1 << 20
+)
+
+// ResponseCache is an in-process, shared, HTTP cache of responses to GET
+// requests. It can be used either as route middleware through its Handler
+// method, or by setting the ResponseCache field of the httpcrud.RouteOptions,
+// in which case it is applied only to the GET routes. The zero value is
+// ready to use, a ResponseCache must not be copied after first use.
+//
+// The responses are stored and reused according to the directives of their
+// Cache-Control header, see the CacheControl type, their Expires header, and
+// the request's Cache-Control header, as specified by RFC 7234 for shared
+// caches. Responses are keyed by the request's path and query, and by the
+// values of the request headers listed in the response's Vary header.
+//
+// A response is stored only if it has an explicit freshness lifetime, i.e.
+// the s-maxage or max-age directive, or the Expires header, and it is not
+// stored if it has the no-store, no-cache, or private directive, if it sets
+// a cookie, if its Content-Security-Policy has a nonce, or if its Vary header
+// is "*". A response to a request with an Authorization header is stored,
+// and reused for such requests, only if it has the public or s-maxage
+// directive. A response to a request with a Cookie header is stored only if
+// it has the public directive, and stored responses are reused for such
+// requests only if they have the public or s-maxage directive. Requests
+// with an Upgrade header, e.g. WebSocket handshakes, bypass the cache.
+//
+// IMPORTANT: A stored response is served without invoking the wrapped
+// handler, and therefore without any of the checks that the handler would
+// perform, e.g. the httpcrud.Handler's AuthCheck. A response that depends
+// on the client's identity must not be marked public, nor have the s-maxage
+// directive, otherwise it will be served to every client.
+//
+// If a stored response is stale, but within its stale-while-revalidate
+// window, it is served to the client and then revalidated by the same
+// request, while the other requests continue to be served the stale
+// response until the revalidation completes.
+type ResponseCache struct {
+	// The maximum number of stored responses, once reached the least
+	// recently used responses are evicted. If not set, 1000 will be used.
+	MaxEntries int
+	// The maximum size of a stored response's body. Responses with larger
+	// bodies are not stored. If not set, 1MB will be used.
+	MaxBodyBytes int
+
+	mu sync.Mutex
+	// the stored responses, in the order of their use
+	lru list.List
+	// the elements of lru by their cache key
+	entries map[string]*list.Element
+	// the Vary header names of the latest response by the request's path and query
+	vary map[string][]string
+}
+
+// cacheEntry is a stored response.
+type cacheEntry struct {
+	key    string
+	status int
+	header http.Header
+	body   []byte
+	// the time at which the response was stored
+	stored time.Time
+	// the freshness lifetime and the stale-while-revalidate window
+	ttl, swr time.Duration
+	// set if the response may be reused for requests with an Authorization header
+	public bool
+	// set while a request is revalidating the response
+	revalidating bool
+}
+
+// Handler returns an http.Handler that serves the responses of h from the
+// cache. The method's signature allows it to be used as route middleware.
+func (c *ResponseCache) Handler(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet || len(r.Header.Get("Upgrade")) > 0 {
+			h.ServeHTTP(w, r)
+			return
+		}
+		reqcc := parseCacheControl(r.Header.Get("Cache-Control"))
+		if _, ok := reqcc["no-store"]; ok {
+			h.ServeHTTP(w, r)
+			return
+		}
+
+		base := cacheBaseKey(r.URL)
+		if _, ok := reqcc["no-cache"]; !ok {
+			if e, stale := c.lookup(base, r); e != nil {
+				serveCacheEntry(w, r, e)
+				if stale {
+					if f, ok := w.(http.Flusher); ok {
+						f.Flush()
+					}
+					c.revalidate(h, r, e)
+				}
+				return
+			}
+		}
+
+		rec := &cacheRecorder{w: w, max: c.maxBodyBytes(), outer: w.Header().Clone()}
+		h.ServeHTTP(rec, r)
+		c.store(base, r, rec)
+	})
+}
+
+// lookup returns the stored response for the request, or nil. The returned
+// bool is true if the response is stale and the caller is responsible for
+// revalidating it.
+func (c *ResponseCache) lookup(base string, r *http.Request) (e *cacheEntry, revalidate bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	key := cacheKey(base, c.vary[base], r.Header)
+	el, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+	e = el.Value.(*cacheEntry)
+	if auth, cookie := requestCredentials(r); (auth || cookie) && !e.public {
+		return nil, false
+	}
+
+	age := time.Since(e.stored)
+	if age >= e.ttl+e.swr {
+		c.remove(el)
+		return nil, false
+	}
+	c.lru.MoveToFront(el)
+	if age < e.ttl || e.revalidating {
+		return e, false
+	}
+	e.revalidating = true
+	return e, true
+}
+
+// revalidate replaces the given stale entry with a fresh response from h.
+func (c *ResponseCache) revalidate(h http.Handler, r *http.Request, e *cacheEntry) {
+	rec := &cacheRecorder{w: discardResponse{header: http.Header{}}, max: c.maxBodyBytes()}
+	h.ServeHTTP(rec, r)
+
+	c.mu.Lock()
+	e.revalidating = false
+	c.mu.Unlock()
+	c.store(cacheBaseKey(r.URL), r, rec)
+}
+
+// store stores the recorded response if it's cacheable.
+func (c *ResponseCache) store(base string, r *http.Request, rec *cacheRecorder) {
+	e, vary, ok := newCacheEntry(rec, r)
+	if !ok {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.entries == nil {
+		c.entries = make(map[string]*list.Element)
+		c.vary = make(map[string][]string)
+	}
+
+	c.vary[base] = vary
+	e.key = cacheKey(base, vary, r.Header)
+	if el, ok := c.entries[e.key]; ok {
+		c.remove(el)
+	}
+	c.entries[e.key] = c.lru.PushFront(e)
+
+	max := c.MaxEntries
+	if max <= 0 {
+		max = defaultCacheMaxEntries
+	}
+	for c.lru.Len() > max {
+		c.remove(c.lru.Back())
+	}
+}
+
+// remove removes the given element from the cache. The caller must hold the lock.
+func (c *ResponseCache) remove(el *list.Element) {
+	delete(c.entries, el.Value.(*cacheEntry).key)
+	c.lru.Remove(el)
+}
+
+func (c *ResponseCache) maxBodyBytes() int {
+	if c.MaxBodyBytes > 0 {
+		return c.MaxBodyBytes
+	}
+	return defaultCacheMaxBodyBytes
+}
+
+// newCacheEntry returns a cacheEntry for the recorded response to the given
+// request, together with the header names listed in the response's Vary header.
+// The returned bool will be false if the response must not be stored.
+func newCacheEntry(rec *cacheRecorder, r *http.Request) (e *cacheEntry, vary []string, ok bool) {
+	if rec.overflow || rec.hijacked || rec.header == nil {
+		return nil, nil, false
+	}
+	switch rec.status {
+	case http.StatusOK, http.StatusNonAuthoritativeInfo, http.StatusNoContent,
+		http.StatusMovedPermanently, http.StatusNotFound, http.StatusGone:
+	default:
+		return nil, nil, false
+	}
+
+	h := rec.header
+	if len(h["Set-Cookie"]) > 0 || len(cspNonce(h)) > 0 {
+		return nil, nil, false
+	}
+	cc := parseCacheControl(strings.Join(h["Cache-Control"], ","))
+	for _, d := range []string{"no-store", "no-cache", "private"} {
+		if _, ok := cc[d]; ok {
+			return nil, nil, false
+		}
+	}
+	_, public := cc["public"]
+	smaxage, hasSMaxAge := cacheDirectiveSeconds(cc, "s-maxage")
+	if auth, cookie := requestCredentials(r); (auth && !public && !hasSMaxAge) || (cookie && !public) {
+		return nil, nil, false
+	}
+
+	for _, v := range h["Vary"] {
+		for _, name := range strings.Split(v, ",") {
+			if name = strings.TrimSpace(name); name == "*" {
+				return nil, nil, false
+			} else if len(name) > 0 {
+				vary = append(vary, http.CanonicalHeaderKey(name))
+			}
+		}
+	}
+	sort.Strings(vary)
+
+	e = &cacheEntry{status: rec.status, header: h, body: rec.body, stored: time.Now()}
+	e.public = public || hasSMaxAge
+	if hasSMaxAge {
+		e.ttl = smaxage
+	} else if maxage, ok := cacheDirectiveSeconds(cc, "max-age"); ok {
+		e.ttl = maxage
+	} else if exp, err := http.ParseTime(h.Get("Expires")); err == nil {
+		date, err := http.ParseTime(h.Get("Date"))
+		if err != nil {
+			date = e.stored
+		}
+		e.ttl = exp.Sub(date)
+	}
+	e.swr, _ = cacheDirectiveSeconds(cc, "stale-while-revalidate")
+	if e.ttl <= 0 && e.swr <= 0 {
+		return nil, nil, false
+	}
+	return e, vary, true
+}
+
+// requestCredentials reports whether the request has
+// an Authorization header and whether it has a Cookie header.
+func requestCredentials(r *http.Request) (auth, cookie bool) {
+	return len(r.Header.Get("Authorization")) > 0, len(r.Header.Get("Cookie")) > 0
+}
+
+// serveCacheEntry writes the stored response, or 304 (Not Modified)
+// if the request's conditional headers allow it.
+func serveCacheEntry(w http.ResponseWriter, r *http.Request, e *cacheEntry) {
+	h := w.Header()
+	for k, v := range e.header {
+		h[k] = append([]string(nil), v...)
+	}
+	h.Set("Age", strconv.FormatInt(int64(time.Since(e.stored)/time.Second), 10))
+
+	if e.status == http.StatusOK && notModified(r, h) {
+		h.Del("Content-Type")
+		h.Del("Content-Length")
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	w.WriteHeader(e.status)
+	w.Write(e.body)
+}
+
+// cacheBaseKey returns the part of the cache key derived from the request's url.
+func cacheBaseKey(u *url.URL) string {
+	return u.EscapedPath() + "?" + u.Query().Encode()
+}
+
+// cacheKey returns the cache key of a request with the given
+// base key and header for the given list of Vary header names.
+func cacheKey(base string, vary []string, header http.Header) string {
+	key := base
+	for _, name := range vary {
+		key += "\x00" + name + ":" + strings.Join(header[name], ",")
+	}
+	return key
+}
+
+// parseCacheControl parses the given Cache-Control header value into
+// a map of lower-cased directive names to their unquoted values.
+func parseCacheControl(s string) map[string]string {
+	cc := make(map[string]string)
+	for _, d := range strings.Split(s, ",") {
+		d = strings.TrimSpace(d)
+		if len(d) == 0 {
+			continue
+		}
+		name, value := d, ""
+		if i := strings.IndexByte(d, '='); i >= 0 {
+			name, value = d[:i], strings.Trim(strings.TrimSpace(d[i+1:]), `"`)
+		}
+		cc[strings.ToLower(strings.TrimSpace(name))] = value
+	}
+	return cc
+}
+
+// cacheDirectiveSeconds returns the duration of the named directive
+// whose value is a number of seconds. The returned bool will be false
+// if the directive is absent or its value is invalid.
+func cacheDirectiveSeconds(cc map[string]string, name string) (time.Duration, bool) {
+	v, ok := cc[name]
+	if !ok {
+		return 0, false
+	}
+	n, err := strconv.ParseInt(v, 10, 64)
+	if err != nil || n < 0 {
+		return 0, false
+	}
+	return time.Duration(n) * time.Second, true
+}
+
+// cacheRecorder implements the http.ResponseWriter, http.Flusher, and
+// http.Hijacker interfaces. It passes the response on to the underlying writer while
+// recording it. The header is recorded when the status code is written,
+// before it can be modified by the outer writers, and without the header
+// fields that were set by the outer middleware, e.g. the CORS headers,
+// before the handler was called.
+type cacheRecorder struct {
+	w   http.ResponseWriter
+	max int
+	// the header as it was before the handler was called
+	outer http.Header
+
+	status   int
+	header   http.Header
+	body     []byte
+	overflow bool
+	hijacked bool
+}
+
+func (rec *cacheRecorder) Header() http.Header {
+	return rec.w.Header()
+}
+
+func (rec *cacheRecorder) WriteHeader(statusCode int) {
+	if rec.status == 0 && statusCode >= 200 {
+		rec.status = statusCode
+		rec.header = rec.w.Header().Clone()
+		for k, v := range rec.outer {
+			if strings.Join(rec.header[k], "\x00") == strings.Join(v, "\x00") {
+				delete(rec.header, k)
+			}
+		}
+	}
+	rec.w.WriteHeader(statusCode)
+}
+
+func (rec *cacheRecorder) Write(p []byte) (int, error) {
+	if rec.status == 0 {
+		rec.WriteHeader(http.StatusOK)
+	}
+	if !rec.overflow {
+		if len(rec.body)+len(p) > rec.max {
+			rec.overflow, rec.body = true, nil
+		} else {
+			rec.body = append(rec.body, p...)
+		}
+	}
+	return rec.w.Write(p)
+}
+
+// Flush implements the http.Flusher interface.
+func (rec *cacheRecorder) Flush() {
+	if f, ok := rec.w.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Hijack implements the http.Hijacker interface. A hijacked
+// response is not stored.
+func (rec *cacheRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hj, ok := rec.w.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("httpcrud/httpio: response does not support hijacking")
+	}
+	rec.hijacked = true
+	return hj.Hijack()
+}
+
+// Unwrap returns the underlying http.ResponseWriter.
+func (rec *cacheRecorder) Unwrap() http.ResponseWriter {
+	return rec.w
+}
+
+// discardResponse implements the http.ResponseWriter interface by discarding
+// the response, it is used to record the responses of revalidations.
+type discardResponse struct {
+	header http.Header
+}
+
+func (d discardResponse) Header() http.Header         { return d.header }
+func (d discardResponse) WriteHeader(int)             {}
+func (d discardResponse) Write(p []byte) (int, error) { return len(p), nil }
@@ -0,0 +1,338 @@
+package httpio
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/frk/compare"
+)
+
+// countingHandler responds with the number of times it has been called
+// and with the header set by the hdr func, if not nil.
+type countingHandler struct {
+	calls  int
+	status int
+	hdr    func(h http.Header, r *http.Request)
+}
+
+func (h *countingHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.calls += 1
+	if h.hdr != nil {
+		h.hdr(w.Header(), r)
+	}
+	if h.status > 0 {
+		w.WriteHeader(h.status)
+	}
+	w.Write([]byte(strconv.Itoa(h.calls)))
+}
+
+// age moves the stored time of all of the cache's entries into the past.
+func (c *ResponseCache) age(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for el := c.lru.Front(); el != nil; el = el.Next() {
+		el.Value.(*cacheEntry).stored = el.Value.(*cacheEntry).stored.Add(-d)
+	}
+}
+
+func TestResponseCache(t *testing.T) {
+	type request struct {
+		method string
+		url    string
+		header map[string]string
+		// the number of seconds by which to age the cache before the request
+		age  int
+		code int
+		want string
+	}
+
+	maxAge := func(h http.Header, _ *http.Request) {
+		CacheControl{MaxAge: time.Minute}.WriteHeader(h)
+	}
+
+	tests := []struct {
+		name     string
+		status   int
+		hdr      func(h http.Header, r *http.Request)
+		requests []request
+	}{{
+		name: "fresh response is reused",
+		hdr:  maxAge,
+		requests: []request{
+			{url: "/a?x=1&y=2", want: "1"},
+			{url: "/a?y=2&x=1", want: "1"},
+			{url: "/a?x=1", want: "2"},
+			{url: "/b?x=1&y=2", want: "3"},
+			{url: "/a?x=1&y=2", age: 59, want: "1"},
+		},
+	}, {
+		name: "expired response is not reused",
+		hdr:  maxAge,
+		requests: []request{
+			{url: "/", want: "1"},
+			{url: "/", age: 60, want: "2"},
+			{url: "/", want: "2"},
+		},
+	}, {
+		name: "only get is cached",
+		hdr:  maxAge,
+		requests: []request{
+			{method: "POST", url: "/", want: "1"},
+			{method: "POST", url: "/", want: "2"},
+			{method: "HEAD", url: "/", want: "3"},
+			{url: "/", want: "4"},
+			{url: "/", want: "4"},
+		},
+	}, {
+		name: "not cacheable directives",
+		hdr: func(h http.Header, r *http.Request) {
+			cc := CacheControl{MaxAge: time.Minute}
+			switch r.URL.Path {
+			case "/private":
+				cc.Private = true
+			case "/no-store":
+				cc.NoStore = true
+			case "/no-cache":
+				cc.NoCache = true
+			case "/cookie":
+				h.Set("Set-Cookie", "a=b")
+			case "/vary":
+				h.Set("Vary", "*")
+			case "/none":
+				cc.MaxAge = 0
+			}
+			cc.WriteHeader(h)
+		},
+		requests: []request{
+			{url: "/private", want: "1"},
+			{url: "/private", want: "2"},
+			{url: "/no-store", want: "3"},
+			{url: "/no-store", want: "4"},
+			{url: "/no-cache", want: "5"},
+			{url: "/no-cache", want: "6"},
+			{url: "/cookie", want: "7"},
+			{url: "/cookie", want: "8"},
+			{url: "/vary", want: "9"},
+			{url: "/vary", want: "10"},
+			{url: "/none", want: "11"},
+			{url: "/none", want: "12"},
+		},
+	}, {
+		name:   "not cacheable status",
+		status: http.StatusInternalServerError,
+		hdr:    maxAge,
+		requests: []request{
+			{url: "/", code: 500, want: "1"},
+			{url: "/", code: 500, want: "2"},
+		},
+	}, {
+		name:   "cacheable status",
+		status: http.StatusNotFound,
+		hdr:    maxAge,
+		requests: []request{
+			{url: "/", code: 404, want: "1"},
+			{url: "/", code: 404, want: "1"},
+		},
+	}, {
+		name: "expires",
+		hdr: func(h http.Header, _ *http.Request) {
+			now := time.Now()
+			exp := now.Add(time.Minute)
+			h.Set("Date", now.UTC().Format(http.TimeFormat))
+			Expires{&exp}.WriteHeader(h)
+		},
+		requests: []request{
+			{url: "/", want: "1"},
+			{url: "/", age: 30, want: "1"},
+			{url: "/", age: 31, want: "2"},
+		},
+	}, {
+		name: "vary",
+		hdr: func(h http.Header, _ *http.Request) {
+			HeaderWriterList{CacheControl{MaxAge: time.Minute}, Vary{"accept-language"}}.WriteHeader(h)
+		},
+		requests: []request{
+			{url: "/", header: map[string]string{"Accept-Language": "en"}, want: "1"},
+			{url: "/", header: map[string]string{"Accept-Language": "de"}, want: "2"},
+			{url: "/", header: map[string]string{"Accept-Language": "en"}, want: "1"},
+			{url: "/", header: map[string]string{"Accept-Language": "de"}, want: "2"},
+			{url: "/", want: "3"},
+		},
+	}, {
+		name: "request cache-control",
+		hdr:  maxAge,
+		requests: []request{
+			{url: "/", want: "1"},
+			{url: "/", header: map[string]string{"Cache-Control": "no-store"}, want: "2"},
+			{url: "/", want: "1"},
+			{url: "/", header: map[string]string{"Cache-Control": "no-cache"}, want: "3"},
+			{url: "/", want: "3"},
+		},
+	}, {
+		name: "authorization",
+		hdr: func(h http.Header, r *http.Request) {
+			cc := CacheControl{MaxAge: time.Minute}
+			cc.Public = r.URL.Path == "/public"
+			cc.WriteHeader(h)
+		},
+		requests: []request{
+			{url: "/", header: map[string]string{"Authorization": "Bearer x"}, want: "1"},
+			{url: "/", header: map[string]string{"Authorization": "Bearer x"}, want: "2"},
+			{url: "/", want: "3"},
+			{url: "/", header: map[string]string{"Authorization": "Bearer x"}, want: "4"},
+			{url: "/", want: "3"},
+			{url: "/public", header: map[string]string{"Authorization": "Bearer x"}, want: "5"},
+			{url: "/public", header: map[string]string{"Authorization": "Bearer y"}, want: "5"},
+		},
+	}, {
+		name: "cookie",
+		hdr: func(h http.Header, r *http.Request) {
+			cc := CacheControl{MaxAge: time.Minute}
+			cc.Public = r.URL.Path == "/public"
+			cc.WriteHeader(h)
+		},
+		requests: []request{
+			{url: "/", header: map[string]string{"Cookie": "session=x"}, want: "1"},
+			{url: "/", want: "2"},
+			{url: "/", header: map[string]string{"Cookie": "session=x"}, want: "3"},
+			{url: "/", want: "2"},
+			{url: "/public", header: map[string]string{"Cookie": "session=x"}, want: "4"},
+			{url: "/public", header: map[string]string{"Cookie": "session=y"}, want: "4"},
+		},
+	}, {
+		name: "upgrade",
+		hdr:  maxAge,
+		requests: []request{
+			{url: "/", header: map[string]string{"Upgrade": "websocket"}, want: "1"},
+			{url: "/", header: map[string]string{"Upgrade": "websocket"}, want: "2"},
+			{url: "/", want: "3"},
+			{url: "/", header: map[string]string{"Upgrade": "websocket"}, want: "4"},
+		},
+	}, {
+		name: "conditional request",
+		hdr: func(h http.Header, _ *http.Request) {
+			h.Set("ETag", `"v1"`)
+			maxAge(h, nil)
+		},
+		requests: []request{
+			{url: "/", want: "1"},
+			{url: "/", header: map[string]string{"If-None-Match": `"v1"`}, code: 304},
+			{url: "/", header: map[string]string{"If-None-Match": `"v2"`}, want: "1"},
+		},
+	}, {
+		name: "stale while revalidate",
+		hdr: func(h http.Header, _ *http.Request) {
+			CacheControl{MaxAge: time.Minute, StaleWhileRevalidate: time.Minute}.WriteHeader(h)
+		},
+		requests: []request{
+			{url: "/", want: "1"},
+			{url: "/", age: 90, want: "1"},
+			{url: "/", want: "2"},
+			{url: "/", age: 120, want: "3"},
+		},
+	}}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &ResponseCache{}
+			h := c.Handler(&countingHandler{status: tt.status, hdr: tt.hdr})
+
+			for i, req := range tt.requests {
+				c.age(time.Duration(req.age) * time.Second)
+
+				method := req.method
+				if len(method) == 0 {
+					method = "GET"
+				}
+				r := httptest.NewRequest(method, req.url, nil)
+				for k, v := range req.header {
+					r.Header.Set(k, v)
+				}
+				w := httptest.NewRecorder()
+				h.ServeHTTP(w, r)
+
+				code := req.code
+				if code == 0 {
+					code = 200
+				}
+				if e := compare.Compare(w.Code, code); e != nil {
+					t.Errorf("#%d: %v", i, e)
+				}
+				if e := compare.Compare(w.Body.String(), req.want); e != nil {
+					t.Errorf("#%d: %v", i, e)
+				}
+			}
+		})
+	}
+}
+
+func TestResponseCache_Limits(t *testing.T) {
+	c := &ResponseCache{MaxEntries: 2, MaxBodyBytes: 4}
+	h := c.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		CacheControl{MaxAge: time.Minute}.WriteHeader(w.Header())
+		w.Write([]byte(r.URL.Path))
+	}))
+
+	for _, path := range []string{"/a", "/b", "/a", "/c", "/long"} {
+		h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", path, nil))
+	}
+
+	var keys []string
+	for el := c.lru.Front(); el != nil; el = el.Next() {
+		keys = append(keys, el.Value.(*cacheEntry).key)
+	}
+	if e := compare.Compare(keys, []string{"/c?", "/a?"}); e != nil {
+		t.Error(e)
+	}
+}
+
+func TestResponseCache_Age(t *testing.T) {
+	c := &ResponseCache{}
+	h := c.Handler(&countingHandler{hdr: func(h http.Header, _ *http.Request) {
+		CacheControl{SMaxAge: time.Minute}.WriteHeader(h)
+		h.Set("Content-Type", "text/plain")
+	}})
+
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+	c.age(5 * time.Second)
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+	want := http.Header{
+		"Age":           {"5"},
+		"Cache-Control": {"s-maxage=60"},
+		"Content-Type":  {"text/plain"},
+	}
+	if e := compare.Compare(w.Result().Header, want); e != nil {
+		t.Error(e)
+	}
+}
+
+func TestResponseCache_OuterHeader(t *testing.T) {
+	c := &ResponseCache{}
+	cors := &CORS{AllowOrigins: []string{"https://*.example.com"}}
+	h := cors.Handler(c.Handler(&countingHandler{hdr: func(h http.Header, _ *http.Request) {
+		CacheControl{MaxAge: time.Minute}.WriteHeader(h)
+	}}))
+
+	for i, origin := range []string{"https://a.example.com", "https://b.example.com", "https://evil.com"} {
+		r := httptest.NewRequest("GET", "/", nil)
+		r.Header.Set("Origin", origin)
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+
+		if e := compare.Compare(w.Body.String(), "1"); e != nil {
+			t.Errorf("#%d: %v", i, e)
+		}
+		want := origin
+		if origin == "https://evil.com" {
+			want = ""
+		}
+		if e := compare.Compare(w.Header().Get("Access-Control-Allow-Origin"), want); e != nil {
+			t.Errorf("#%d: %v", i, e)
+		}
+	}
+}
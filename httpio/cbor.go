@@ -0,0 +1,965 @@
+package httpio
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"math/big"
+	"net/http"
+	"reflect"
+	"sort"
+	"time"
+)
+
+// The CBOR type implements both the BodyWriter and the BodyReader interfaces
+// for the Concise Binary Object Representation format as specified by RFC 8949.
+//
+// Values are encoded and decoded by reflection, struct fields are mapped using
+// the "cbor" struct tag, falling back to the "json" struct tag, and falling back
+// to the field's name. Both tags support the "omitempty" option.
+//
+// The encoder always produces the core deterministic encoding (RFC 8949, section
+// 4.2.1), i.e. the shortest form of integers, lengths and floating point values
+// is used, indefinite-length items are never produced, and map keys are sorted
+// by the bytewise lexicographic order of their encoding.
+//
+// The time.Time values are encoded as epoch-based date/time (tag 1), as an
+// integer if the time has no fractional seconds, otherwise as a float, and
+// both the tag 0 (RFC 3339 string) and tag 1 date/times can be decoded. The
+// big.Int values are encoded as bignums (tags 2 and 3) unless they fit into
+// a CBOR integer. CBORTag can be used to encode and decode any other tag.
+type CBOR struct {
+	// The value to be cbor encoded and sent in an HTTP response body or
+	// a pointer to the value to be cbor decoded from an HTTP request's body.
+	Val interface{}
+}
+
+// ReadBody implements the BodyReader interface by decoding the request's
+// cbor body into the reciever's Val field using the Codec registered
+// for the "application/cbor" media type.
+func (c CBOR) ReadBody(r *http.Request) error {
+	return decodeBody(mustLookupCodec(contentTypeCBOR), r, c.Val)
+}
+
+// WriteInit is a noop, required only to satisfy the BodyWriter interface.
+func (CBOR) WriteInit(_ http.ResponseWriter) error {
+	return nil
+}
+
+const contentTypeCBOR = "application/cbor"
+
+// WriteBody implements the BodyWriter interface by cbor encoding the
+// receiver's Val field, using the Codec registered for the "application/cbor"
+// media type, and sending the result in the response's body.
+func (c CBOR) WriteBody(w http.ResponseWriter, r *http.Request, statusCode int) error {
+	return encodeBody(mustLookupCodec(contentTypeCBOR), w, statusCode, c.Val)
+}
+
+// CBORTag represents a tagged CBOR data item.
+type CBORTag struct {
+	// The tag number.
+	Number uint64
+	// The tag content.
+	Content interface{}
+}
+
+// cborCodec implements the Codec interface for the CBOR format.
+type cborCodec struct{}
+
+func (cborCodec) MediaType() string              { return contentTypeCBOR }
+func (cborCodec) NewDecoder(r io.Reader) Decoder { return &cborDecoder{r: bufio.NewReader(r)} }
+func (cborCodec) NewEncoder(w io.Writer) Encoder { return &cborEncoder{w: w} }
+
+// The CBOR major types.
+const (
+	cborUint   = 0 << 5
+	cborNegint = 1 << 5
+	cborBytes  = 2 << 5
+	cborText   = 3 << 5
+	cborArray  = 4 << 5
+	cborMap    = 5 << 5
+	cborTag    = 6 << 5
+	cborSimple = 7 << 5
+)
+
+// The CBOR simple values, floats and other special values.
+const (
+	cborFalse     = cborSimple | 20
+	cborTrue      = cborSimple | 21
+	cborNull      = cborSimple | 22
+	cborUndefined = cborSimple | 23
+	cborFloat16   = cborSimple | 25
+	cborFloat32   = cborSimple | 26
+	cborFloat64   = cborSimple | 27
+	cborBreak     = cborSimple | 31
+
+	// The additional information value indicating an indefinite length.
+	cborIndefinite = 31
+)
+
+// The CBOR tag numbers handled by the codec.
+const (
+	cborTagDateTimeString = 0
+	cborTagEpochDateTime  = 1
+	cborTagPosBignum      = 2
+	cborTagNegBignum      = 3
+)
+
+var (
+	bigIntType  = reflect.TypeOf(big.Int{})
+	cborTagType = reflect.TypeOf(CBORTag{})
+)
+
+// cborEncoder implements the Encoder interface for the CBOR format.
+type cborEncoder struct {
+	w   io.Writer
+	buf bytes.Buffer
+}
+
+// Encode writes the CBOR encoding of v to the underlying io.Writer.
+func (e *cborEncoder) Encode(v interface{}) error {
+	e.buf.Reset()
+	if err := e.encode(&e.buf, reflect.ValueOf(v)); err != nil {
+		return err
+	}
+	_, err := e.w.Write(e.buf.Bytes())
+	return err
+}
+
+func (e *cborEncoder) encode(buf *bytes.Buffer, v reflect.Value) error {
+	if !v.IsValid() {
+		buf.WriteByte(cborNull)
+		return nil
+	}
+
+	switch v.Type() {
+	case timeType:
+		t := v.Interface().(time.Time)
+		writeCBORHead(buf, cborTag, cborTagEpochDateTime)
+		if t.Nanosecond() == 0 {
+			writeCBORInt(buf, t.Unix())
+		} else {
+			writeCBORFloat(buf, float64(t.Unix())+float64(t.Nanosecond())/1e9)
+		}
+		return nil
+	case bigIntType:
+		b := v.Interface().(big.Int)
+		writeCBORBigInt(buf, &b)
+		return nil
+	case cborTagType:
+		tag := v.Interface().(CBORTag)
+		writeCBORHead(buf, cborTag, tag.Number)
+		return e.encode(buf, reflect.ValueOf(tag.Content))
+	}
+
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		if v.IsNil() {
+			buf.WriteByte(cborNull)
+			return nil
+		}
+		return e.encode(buf, v.Elem())
+	case reflect.Bool:
+		if v.Bool() {
+			buf.WriteByte(cborTrue)
+		} else {
+			buf.WriteByte(cborFalse)
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		writeCBORInt(buf, v.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		writeCBORHead(buf, cborUint, v.Uint())
+	case reflect.Float32, reflect.Float64:
+		writeCBORFloat(buf, v.Float())
+	case reflect.String:
+		writeCBORHead(buf, cborText, uint64(v.Len()))
+		buf.WriteString(v.String())
+	case reflect.Slice:
+		if v.IsNil() {
+			buf.WriteByte(cborNull)
+			return nil
+		}
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			writeCBORHead(buf, cborBytes, uint64(v.Len()))
+			buf.Write(v.Bytes())
+			return nil
+		}
+		fallthrough
+	case reflect.Array:
+		if v.Type().Elem().Kind() == reflect.Uint8 && v.Kind() == reflect.Array {
+			writeCBORHead(buf, cborBytes, uint64(v.Len()))
+			for i := 0; i < v.Len(); i++ {
+				buf.WriteByte(byte(v.Index(i).Uint()))
+			}
+			return nil
+		}
+		writeCBORHead(buf, cborArray, uint64(v.Len()))
+		for i := 0; i < v.Len(); i++ {
+			if err := e.encode(buf, v.Index(i)); err != nil {
+				return err
+			}
+		}
+	case reflect.Map:
+		if v.IsNil() {
+			buf.WriteByte(cborNull)
+			return nil
+		}
+		pairs := make([]cborPair, 0, v.Len())
+		iter := v.MapRange()
+		for iter.Next() {
+			var k bytes.Buffer
+			if err := e.encode(&k, iter.Key()); err != nil {
+				return err
+			}
+			pairs = append(pairs, cborPair{k.Bytes(), iter.Value()})
+		}
+		return e.encodePairs(buf, pairs)
+	case reflect.Struct:
+		fields := structFields(v.Type(), "cbor", "json")
+		pairs := make([]cborPair, 0, len(fields))
+		for _, f := range fields {
+			fv := fieldByIndex(v, f.index)
+			if !fv.IsValid() || (f.omitEmpty && isEmptyValue(fv)) {
+				continue
+			}
+			var k bytes.Buffer
+			writeCBORHead(&k, cborText, uint64(len(f.name)))
+			k.WriteString(f.name)
+			pairs = append(pairs, cborPair{k.Bytes(), fv})
+		}
+		return e.encodePairs(buf, pairs)
+	default:
+		return fmt.Errorf("cbor: unsupported type %s", v.Type())
+	}
+	return nil
+}
+
+// cborPair holds an encoded map key and the associated value.
+type cborPair struct {
+	key []byte
+	val reflect.Value
+}
+
+// encodePairs encodes the given pairs as a map, with the pairs
+// sorted by the bytewise lexicographic order of their keys.
+func (e *cborEncoder) encodePairs(buf *bytes.Buffer, pairs []cborPair) error {
+	sort.Slice(pairs, func(i, j int) bool { return bytes.Compare(pairs[i].key, pairs[j].key) < 0 })
+
+	writeCBORHead(buf, cborMap, uint64(len(pairs)))
+	for _, p := range pairs {
+		buf.Write(p.key)
+		if err := e.encode(buf, p.val); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeCBORHead writes the initial byte of the given major type followed
+// by the argument n, using the shortest possible form.
+func writeCBORHead(buf *bytes.Buffer, major byte, n uint64) {
+	switch {
+	case n < 24:
+		buf.WriteByte(major | byte(n))
+	case n <= math.MaxUint8:
+		buf.WriteByte(major | 24)
+		buf.WriteByte(byte(n))
+	case n <= math.MaxUint16:
+		var b [3]byte
+		b[0] = major | 25
+		binary.BigEndian.PutUint16(b[1:], uint16(n))
+		buf.Write(b[:])
+	case n <= math.MaxUint32:
+		var b [5]byte
+		b[0] = major | 26
+		binary.BigEndian.PutUint32(b[1:], uint32(n))
+		buf.Write(b[:])
+	default:
+		var b [9]byte
+		b[0] = major | 27
+		binary.BigEndian.PutUint64(b[1:], n)
+		buf.Write(b[:])
+	}
+}
+
+func writeCBORInt(buf *bytes.Buffer, i int64) {
+	if i < 0 {
+		writeCBORHead(buf, cborNegint, uint64(-(i + 1)))
+	} else {
+		writeCBORHead(buf, cborUint, uint64(i))
+	}
+}
+
+// writeCBORBigInt writes b as an integer if it fits, otherwise as a bignum.
+func writeCBORBigInt(buf *bytes.Buffer, b *big.Int) {
+	if b.Sign() >= 0 {
+		if b.IsUint64() {
+			writeCBORHead(buf, cborUint, b.Uint64())
+			return
+		}
+		writeCBORHead(buf, cborTag, cborTagPosBignum)
+		writeCBORHead(buf, cborBytes, uint64(len(b.Bytes())))
+		buf.Write(b.Bytes())
+		return
+	}
+
+	// negative values are encoded as -1-n
+	n := new(big.Int).Neg(b)
+	n.Sub(n, big.NewInt(1))
+	if n.IsUint64() {
+		writeCBORHead(buf, cborNegint, n.Uint64())
+		return
+	}
+	writeCBORHead(buf, cborTag, cborTagNegBignum)
+	writeCBORHead(buf, cborBytes, uint64(len(n.Bytes())))
+	buf.Write(n.Bytes())
+}
+
+// writeCBORFloat writes f using the shortest of the half, single and double
+// precision formats that preserves the value. NaNs are written as 0xf97e00.
+func writeCBORFloat(buf *bytes.Buffer, f float64) {
+	if math.IsNaN(f) {
+		buf.Write([]byte{cborFloat16, 0x7e, 0x00})
+		return
+	}
+	if f32 := float32(f); float64(f32) == f {
+		if h, ok := float32ToFloat16(f32); ok {
+			buf.Write([]byte{cborFloat16, byte(h >> 8), byte(h)})
+			return
+		}
+		var b [5]byte
+		b[0] = cborFloat32
+		binary.BigEndian.PutUint32(b[1:], math.Float32bits(f32))
+		buf.Write(b[:])
+		return
+	}
+	var b [9]byte
+	b[0] = cborFloat64
+	binary.BigEndian.PutUint64(b[1:], math.Float64bits(f))
+	buf.Write(b[:])
+}
+
+// float32ToFloat16 returns the IEEE 754 half-precision representation
+// of f, the ok result is false if f cannot be represented exactly.
+func float32ToFloat16(f float32) (h uint16, ok bool) {
+	bits := math.Float32bits(f)
+	sign := uint16(bits>>16) & 0x8000
+	exp := int(bits>>23) & 0xff
+	mant := bits & 0x7fffff
+
+	switch {
+	case exp == 0xff: // infinity (NaNs are handled by the caller)
+		return sign | 0x7c00, mant == 0
+	case exp == 0:
+		return sign, mant == 0
+	}
+
+	switch e := exp - 127; {
+	case e >= -14 && e <= 15: // normal
+		if mant&0x1fff != 0 {
+			return 0, false
+		}
+		return sign | uint16(e+15)<<10 | uint16(mant>>13), true
+	case e >= -24 && e < -14: // subnormal
+		m := mant | 0x800000
+		s := uint(-e - 1)
+		if m&(1<<s-1) != 0 {
+			return 0, false
+		}
+		return sign | uint16(m>>s), true
+	}
+	return 0, false
+}
+
+// float16ToFloat64 converts the IEEE 754 half-precision value h to a float64.
+func float16ToFloat64(h uint16) float64 {
+	exp := int(h>>10) & 0x1f
+	mant := float64(h & 0x3ff)
+
+	var f float64
+	switch exp {
+	case 0:
+		f = math.Ldexp(mant, -24)
+	case 0x1f:
+		if mant == 0 {
+			f = math.Inf(1)
+		} else {
+			f = math.NaN()
+		}
+	default:
+		f = math.Ldexp(mant+1024, exp-25)
+	}
+	if h&0x8000 != 0 {
+		f = -f
+	}
+	return f
+}
+
+// cborDecoder implements the Decoder interface for the CBOR format.
+type cborDecoder struct {
+	r *bufio.Reader
+	// the nesting depth of the value being decoded
+	depth int
+}
+
+// Decode reads the next CBOR encoded value from the underlying
+// io.Reader and stores it in the value pointed to by v.
+func (d *cborDecoder) Decode(v interface{}) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() {
+		return fmt.Errorf("cbor: cannot decode into non-pointer %T", v)
+	}
+	return d.decode(rv.Elem())
+}
+
+func (d *cborDecoder) decode(v reflect.Value) error {
+	if d.depth++; d.depth > maxDecodeDepth {
+		return errors.New("cbor: exceeded max depth")
+	}
+	defer func() { d.depth-- }()
+
+	b, err := d.peekByte()
+	if err != nil {
+		return err
+	}
+
+	if b == cborNull || b == cborUndefined {
+		d.r.ReadByte()
+		switch v.Kind() {
+		case reflect.Ptr, reflect.Interface, reflect.Map, reflect.Slice:
+			v.Set(reflect.Zero(v.Type()))
+		}
+		return nil
+	}
+
+	if v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			v.Set(reflect.New(v.Type().Elem()))
+		}
+		return d.decode(v.Elem())
+	}
+
+	if v.Kind() == reflect.Interface && v.NumMethod() == 0 {
+		x, err := d.decodeInterface()
+		if err != nil {
+			return err
+		}
+		if x != nil {
+			v.Set(reflect.ValueOf(x))
+		} else {
+			v.Set(reflect.Zero(v.Type()))
+		}
+		return nil
+	}
+
+	switch v.Type() {
+	case timeType, bigIntType, cborTagType:
+		x, err := d.decodeInterface()
+		if err != nil {
+			return err
+		}
+		switch xv := x.(type) {
+		case time.Time:
+			if v.Type() == timeType {
+				v.Set(reflect.ValueOf(xv))
+				return nil
+			}
+		case *big.Int:
+			if v.Type() == bigIntType {
+				v.Set(reflect.ValueOf(*xv))
+				return nil
+			}
+		case int64:
+			if v.Type() == bigIntType {
+				v.Set(reflect.ValueOf(*big.NewInt(xv)))
+				return nil
+			}
+		case uint64:
+			if v.Type() == bigIntType {
+				v.Set(reflect.ValueOf(*new(big.Int).SetUint64(xv)))
+				return nil
+			}
+		case CBORTag:
+			if v.Type() == cborTagType {
+				v.Set(reflect.ValueOf(xv))
+				return nil
+			}
+		}
+		return d.typeError(b, v.Type())
+	}
+
+	// skip over any tags that the Go type doesn't care about
+	for b>>5 == cborTag>>5 {
+		if _, err := d.readHead(cborTag); err != nil {
+			return err
+		}
+		if b, err = d.peekByte(); err != nil {
+			return err
+		}
+	}
+
+	switch v.Kind() {
+	case reflect.Bool:
+		d.r.ReadByte()
+		switch b {
+		case cborTrue:
+			v.SetBool(true)
+		case cborFalse:
+			v.SetBool(false)
+		default:
+			return d.typeError(b, v.Type())
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		var i int64
+		switch b >> 5 {
+		case cborUint >> 5:
+			n, err := d.readHead(cborUint)
+			if err != nil {
+				return err
+			}
+			if n > math.MaxInt64 {
+				return d.typeError(b, v.Type())
+			}
+			i = int64(n)
+		case cborNegint >> 5:
+			n, err := d.readHead(cborNegint)
+			if err != nil {
+				return err
+			}
+			if n > math.MaxInt64 {
+				return d.typeError(b, v.Type())
+			}
+			i = -1 - int64(n)
+		default:
+			return d.typeError(b, v.Type())
+		}
+		if v.OverflowInt(i) {
+			return d.typeError(b, v.Type())
+		}
+		v.SetInt(i)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		if b>>5 != cborUint>>5 {
+			return d.typeError(b, v.Type())
+		}
+		n, err := d.readHead(cborUint)
+		if err != nil {
+			return err
+		}
+		if v.OverflowUint(n) {
+			return d.typeError(b, v.Type())
+		}
+		v.SetUint(n)
+	case reflect.Float32, reflect.Float64:
+		x, err := d.decodeInterface()
+		if err != nil {
+			return err
+		}
+		switch xv := x.(type) {
+		case float64:
+			v.SetFloat(xv)
+		case int64:
+			v.SetFloat(float64(xv))
+		case uint64:
+			v.SetFloat(float64(xv))
+		default:
+			return d.typeError(b, v.Type())
+		}
+	case reflect.String:
+		if b>>5 != cborText>>5 && b>>5 != cborBytes>>5 {
+			return d.typeError(b, v.Type())
+		}
+		s, err := d.readString(b & 0xe0)
+		if err != nil {
+			return err
+		}
+		v.SetString(string(s))
+	case reflect.Slice:
+		if v.Type().Elem().Kind() == reflect.Uint8 && (b>>5 == cborBytes>>5 || b>>5 == cborText>>5) {
+			s, err := d.readString(b & 0xe0)
+			if err != nil {
+				return err
+			}
+			v.SetBytes(s)
+			return nil
+		}
+		if b>>5 != cborArray>>5 {
+			return d.typeError(b, v.Type())
+		}
+		s := reflect.MakeSlice(v.Type(), 0, 0)
+		err := d.readItems(cborArray, func() error {
+			ev := reflect.New(v.Type().Elem()).Elem()
+			if err := d.decode(ev); err != nil {
+				return err
+			}
+			s = reflect.Append(s, ev)
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		v.Set(s)
+	case reflect.Array:
+		if v.Type().Elem().Kind() == reflect.Uint8 && b>>5 == cborBytes>>5 {
+			s, err := d.readString(cborBytes)
+			if err != nil {
+				return err
+			}
+			reflect.Copy(v, reflect.ValueOf(s))
+			return nil
+		}
+		if b>>5 != cborArray>>5 {
+			return d.typeError(b, v.Type())
+		}
+		i := 0
+		return d.readItems(cborArray, func() error {
+			defer func() { i++ }()
+			if i < v.Len() {
+				return d.decode(v.Index(i))
+			}
+			_, err := d.decodeInterface()
+			return err
+		})
+	case reflect.Map:
+		if b>>5 != cborMap>>5 {
+			return d.typeError(b, v.Type())
+		}
+		if v.IsNil() {
+			v.Set(reflect.MakeMap(v.Type()))
+		}
+		return d.readItems(cborMap, func() error {
+			kv := reflect.New(v.Type().Key()).Elem()
+			if err := d.decode(kv); err != nil {
+				return err
+			}
+			if unhashableMapKey(kv) {
+				return fmt.Errorf("cbor: unhashable map key of type %s", kv.Elem().Type())
+			}
+			ev := reflect.New(v.Type().Elem()).Elem()
+			if err := d.decode(ev); err != nil {
+				return err
+			}
+			v.SetMapIndex(kv, ev)
+			return nil
+		})
+	case reflect.Struct:
+		if b>>5 != cborMap>>5 {
+			return d.typeError(b, v.Type())
+		}
+		fields := structFields(v.Type(), "cbor", "json")
+		return d.readItems(cborMap, func() error {
+			k, err := d.decodeInterface()
+			if err != nil {
+				return err
+			}
+			name, _ := k.(string)
+			f, ok := findStructFieldFold(fields, name)
+			if !ok {
+				_, err := d.decodeInterface()
+				return err
+			}
+			fv, err := fieldByIndexAlloc(v, f.index)
+			if err != nil {
+				return fmt.Errorf("cbor: %v", err)
+			}
+			return d.decode(fv)
+		})
+	default:
+		return d.typeError(b, v.Type())
+	}
+	return nil
+}
+
+// decodeInterface decodes the next value into its natural Go representation:
+// nil, bool, int64, uint64 (only if it overflows int64), *big.Int (for bignums
+// and negative integers that overflow int64), float64, string, []byte,
+// []interface{}, map[string]interface{} (or map[interface{}]interface{} if
+// any of the keys is not a string), time.Time or CBORTag.
+func (d *cborDecoder) decodeInterface() (interface{}, error) {
+	if d.depth++; d.depth > maxDecodeDepth {
+		return nil, errors.New("cbor: exceeded max depth")
+	}
+	defer func() { d.depth-- }()
+
+	b, err := d.peekByte()
+	if err != nil {
+		return nil, err
+	}
+
+	switch major := b & 0xe0; major {
+	case cborUint:
+		n, err := d.readHead(cborUint)
+		if err != nil {
+			return nil, err
+		}
+		if n > math.MaxInt64 {
+			return n, nil
+		}
+		return int64(n), nil
+	case cborNegint:
+		n, err := d.readHead(cborNegint)
+		if err != nil {
+			return nil, err
+		}
+		if n > math.MaxInt64 {
+			i := new(big.Int).SetUint64(n)
+			return i.Neg(i.Add(i, big.NewInt(1))), nil
+		}
+		return -1 - int64(n), nil
+	case cborBytes:
+		return d.readString(cborBytes)
+	case cborText:
+		s, err := d.readString(cborText)
+		return string(s), err
+	case cborArray:
+		var s []interface{}
+		err := d.readItems(cborArray, func() error {
+			x, err := d.decodeInterface()
+			s = append(s, x)
+			return err
+		})
+		if err != nil {
+			return nil, err
+		}
+		if s == nil {
+			s = []interface{}{}
+		}
+		return s, nil
+	case cborMap:
+		var keys, vals []interface{}
+		strkeys := true
+		err := d.readItems(cborMap, func() error {
+			k, err := d.decodeInterface()
+			if err != nil {
+				return err
+			}
+			if _, ok := k.(string); !ok {
+				strkeys = false
+			}
+			v, err := d.decodeInterface()
+			keys, vals = append(keys, k), append(vals, v)
+			return err
+		})
+		if err != nil {
+			return nil, err
+		}
+		if strkeys {
+			m := make(map[string]interface{}, len(keys))
+			for i, k := range keys {
+				m[k.(string)] = vals[i]
+			}
+			return m, nil
+		}
+		m := make(map[interface{}]interface{}, len(keys))
+		for i, k := range keys {
+			if k != nil && !reflect.TypeOf(k).Comparable() {
+				return nil, fmt.Errorf("cbor: unhashable map key of type %T", k)
+			}
+			m[k] = vals[i]
+		}
+		return m, nil
+	case cborTag:
+		num, err := d.readHead(cborTag)
+		if err != nil {
+			return nil, err
+		}
+		content, err := d.decodeInterface()
+		if err != nil {
+			return nil, err
+		}
+		return decodeCBORTag(num, content)
+	}
+
+	// major type 7
+	d.r.ReadByte()
+	switch b {
+	case cborFalse:
+		return false, nil
+	case cborTrue:
+		return true, nil
+	case cborNull, cborUndefined:
+		return nil, nil
+	case cborFloat16:
+		u, err := d.readUint(2)
+		return float16ToFloat64(uint16(u)), err
+	case cborFloat32:
+		u, err := d.readUint(4)
+		return float64(math.Float32frombits(uint32(u))), err
+	case cborFloat64:
+		u, err := d.readUint(8)
+		return math.Float64frombits(u), err
+	}
+	return nil, fmt.Errorf("cbor: unsupported simple value 0x%x", b)
+}
+
+// decodeCBORTag converts the content of the tag with the given number
+// into its Go representation.
+func decodeCBORTag(num uint64, content interface{}) (interface{}, error) {
+	switch num {
+	case cborTagDateTimeString:
+		s, ok := content.(string)
+		if !ok {
+			return nil, fmt.Errorf("cbor: invalid content of tag 0: %T", content)
+		}
+		t, err := time.Parse(time.RFC3339Nano, s)
+		if err != nil {
+			return nil, fmt.Errorf("cbor: invalid content of tag 0: %v", err)
+		}
+		return t, nil
+	case cborTagEpochDateTime:
+		switch c := content.(type) {
+		case int64:
+			return time.Unix(c, 0).UTC(), nil
+		case uint64:
+			return nil, fmt.Errorf("cbor: epoch date/time out of range")
+		case float64:
+			if math.IsNaN(c) || math.IsInf(c, 0) {
+				return nil, fmt.Errorf("cbor: invalid epoch date/time")
+			}
+			sec, frac := math.Modf(c)
+			return time.Unix(int64(sec), int64(frac*1e9)).UTC(), nil
+		}
+		return nil, fmt.Errorf("cbor: invalid content of tag 1: %T", content)
+	case cborTagPosBignum, cborTagNegBignum:
+		b, ok := content.([]byte)
+		if !ok {
+			return nil, fmt.Errorf("cbor: invalid content of tag %d: %T", num, content)
+		}
+		i := new(big.Int).SetBytes(b)
+		if num == cborTagNegBignum {
+			i.Neg(i.Add(i, big.NewInt(1)))
+		}
+		return i, nil
+	}
+	return CBORTag{Number: num, Content: content}, nil
+}
+
+func (d *cborDecoder) peekByte() (byte, error) {
+	b, err := d.r.Peek(1)
+	if err != nil {
+		return 0, err
+	}
+	return b[0], nil
+}
+
+// readHead reads the initial byte, which must be of the given major type,
+// and the argument that follows it. Indefinite lengths are reported
+// as math.MaxUint64 to the caller.
+func (d *cborDecoder) readHead(major byte) (uint64, error) {
+	b, err := d.r.ReadByte()
+	if err != nil {
+		return 0, err
+	}
+	if b&0xe0 != major {
+		return 0, fmt.Errorf("cbor: unexpected major type %d, want %d", b>>5, major>>5)
+	}
+
+	switch info := b & 0x1f; {
+	case info < 24:
+		return uint64(info), nil
+	case info <= 27:
+		return d.readUint(1 << (info - 24))
+	case info == cborIndefinite && (major == cborBytes || major == cborText || major == cborArray || major == cborMap):
+		return math.MaxUint64, nil
+	}
+	return 0, fmt.Errorf("cbor: invalid additional information %d", b&0x1f)
+}
+
+// readString reads a definite or indefinite-length byte or text string.
+func (d *cborDecoder) readString(major byte) ([]byte, error) {
+	n, err := d.readHead(major)
+	if err != nil {
+		return nil, err
+	}
+	if n != math.MaxUint64 {
+		return d.readN(n)
+	}
+
+	// indefinite-length, concatenate the definite-length chunks
+	var s []byte
+	for {
+		b, err := d.peekByte()
+		if err != nil {
+			return nil, unexpectedEOF(err)
+		}
+		if b == cborBreak {
+			d.r.ReadByte()
+			return s, nil
+		}
+		n, err := d.readHead(major)
+		if err != nil {
+			return nil, err
+		}
+		if n == math.MaxUint64 {
+			return nil, fmt.Errorf("cbor: nested indefinite-length string")
+		}
+		chunk, err := d.readN(n)
+		if err != nil {
+			return nil, err
+		}
+		s = append(s, chunk...)
+	}
+}
+
+// readItems reads the head of a definite or indefinite-length array or map
+// and then invokes fn once for each array element or map entry.
+func (d *cborDecoder) readItems(major byte, fn func() error) error {
+	n, err := d.readHead(major)
+	if err != nil {
+		return err
+	}
+	if n != math.MaxUint64 {
+		for i := uint64(0); i < n; i++ {
+			if err := fn(); err != nil {
+				return unexpectedEOF(err)
+			}
+		}
+		return nil
+	}
+
+	for {
+		b, err := d.peekByte()
+		if err != nil {
+			return unexpectedEOF(err)
+		}
+		if b == cborBreak {
+			d.r.ReadByte()
+			return nil
+		}
+		if err := fn(); err != nil {
+			return unexpectedEOF(err)
+		}
+	}
+}
+
+// readUint reads an n-byte big-endian unsigned integer.
+func (d *cborDecoder) readUint(n int) (uint64, error) {
+	var b [8]byte
+	if _, err := io.ReadFull(d.r, b[8-n:]); err != nil {
+		return 0, unexpectedEOF(err)
+	}
+	return binary.BigEndian.Uint64(b[:]), nil
+}
+
+// readN reads the next n bytes. The buffer is grown as the data arrives
+// so that a bogus length cannot cause a large upfront allocation.
+func (d *cborDecoder) readN(n uint64) ([]byte, error) {
+	if n > math.MaxInt64 {
+		return nil, fmt.Errorf("cbor: length %d out of range", n)
+	}
+	var buf bytes.Buffer
+	if n < 1<<16 {
+		buf.Grow(int(n))
+	}
+	if _, err := io.CopyN(&buf, d.r, int64(n)); err != nil {
+		return nil, unexpectedEOF(err)
+	}
+	return buf.Bytes(), nil
+}
+
+func (d *cborDecoder) typeError(b byte, t reflect.Type) error {
+	return fmt.Errorf("cbor: cannot decode major type %d into Go value of type %s", b>>5, t)
+}
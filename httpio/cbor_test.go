@@ -0,0 +1,261 @@
+package httpio
+
+import (
+	"bytes"
+	"io"
+	"math"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/frk/compare"
+)
+
+type testCBORInner struct {
+	A int    `cbor:"a"`
+	B string `cbor:"b,omitempty"`
+}
+
+type testCBORUnexported struct {
+	A int
+}
+
+type testCBOREmbedded struct {
+	*testCBORUnexported
+	X int
+}
+
+type testCBOR struct {
+	Name   string         `cbor:"name"`
+	Count  uint16         `json:"count"`
+	Ratio  float64        `cbor:"ratio,omitempty"`
+	Skip   string         `cbor:"-"`
+	Tags   []string       `cbor:"tags"`
+	Inner  *testCBORInner `cbor:"inner"`
+	Attrs  map[string]int `cbor:"attrs"`
+	When   time.Time      `cbor:"when"`
+	Big    big.Int        `cbor:"big"`
+	Tag    CBORTag        `cbor:"tag"`
+	Bytes  []byte         `cbor:"bytes"`
+	Plain  bool
+	hidden int
+}
+
+func TestCBOR_Encode(t *testing.T) {
+	bigpos, _ := new(big.Int).SetString("18446744073709551616", 10)
+	bigneg, _ := new(big.Int).SetString("-18446744073709551617", 10)
+
+	tests := []struct {
+		name string
+		val  interface{}
+		want []byte
+	}{
+		{name: "nil", val: nil, want: []byte{0xf6}},
+		{name: "true", val: true, want: []byte{0xf5}},
+		{name: "0", val: 0, want: []byte{0x00}},
+		{name: "24", val: 24, want: []byte{0x18, 0x18}},
+		{name: "1000", val: 1000, want: []byte{0x19, 0x03, 0xe8}},
+		{name: "-1", val: -1, want: []byte{0x20}},
+		{name: "-1000", val: -1000, want: []byte{0x39, 0x03, 0xe7}},
+		{name: "max uint64", val: uint64(math.MaxUint64), want: []byte{0x1b, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff}},
+		{name: "small big.Int", val: big.NewInt(-10), want: []byte{0x29}},
+		{name: "positive bignum", val: bigpos, want: []byte{0xc2, 0x49, 1, 0, 0, 0, 0, 0, 0, 0, 0}},
+		{name: "negative bignum", val: bigneg, want: []byte{0xc3, 0x49, 1, 0, 0, 0, 0, 0, 0, 0, 0}},
+		{name: "0.0", val: 0.0, want: []byte{0xf9, 0x00, 0x00}},
+		{name: "-0.0", val: math.Copysign(0, -1), want: []byte{0xf9, 0x80, 0x00}},
+		{name: "1.5", val: 1.5, want: []byte{0xf9, 0x3e, 0x00}},
+		{name: "65504.0", val: 65504.0, want: []byte{0xf9, 0x7b, 0xff}},
+		{name: "subnormal half", val: 5.960464477539063e-8, want: []byte{0xf9, 0x00, 0x01}},
+		{name: "100000.0", val: 100000.0, want: []byte{0xfa, 0x47, 0xc3, 0x50, 0x00}},
+		{name: "1.1", val: 1.1, want: []byte{0xfb, 0x3f, 0xf1, 0x99, 0x99, 0x99, 0x99, 0x99, 0x9a}},
+		{name: "Inf", val: math.Inf(1), want: []byte{0xf9, 0x7c, 0x00}},
+		{name: "NaN", val: math.NaN(), want: []byte{0xf9, 0x7e, 0x00}},
+		{name: "text", val: "IETF", want: []byte{0x64, 'I', 'E', 'T', 'F'}},
+		{name: "bytes", val: []byte{1, 2, 3, 4}, want: []byte{0x44, 1, 2, 3, 4}},
+		{name: "array", val: []int{1, 2, 3}, want: []byte{0x83, 1, 2, 3}},
+		{name: "map", val: map[string]interface{}{"b": []int{2, 3}, "a": 1},
+			want: []byte{0xa2, 0x61, 'a', 0x01, 0x61, 'b', 0x82, 0x02, 0x03}},
+		{name: "map key order", val: map[interface{}]int{"a": 3, -1: 2, 10: 1},
+			want: []byte{0xa3, 0x0a, 0x01, 0x20, 0x02, 0x61, 'a', 0x03}},
+		{name: "epoch time", val: time.Unix(1363896240, 0),
+			want: []byte{0xc1, 0x1a, 0x51, 0x4b, 0x67, 0xb0}},
+		{name: "epoch time with fraction", val: time.Unix(1363896240, 5e8),
+			want: []byte{0xc1, 0xfb, 0x41, 0xd4, 0x52, 0xd9, 0xec, 0x20, 0x00, 0x00}},
+		{name: "epoch time after 2262", val: time.Date(2300, 1, 1, 0, 0, 0, 5e8, time.UTC),
+			want: []byte{0xc1, 0xfb, 0x42, 0x03, 0x65, 0xae, 0xd8, 0x04, 0x00, 0x00}},
+		{name: "tag", val: CBORTag{Number: 32, Content: "a"}, want: []byte{0xd8, 0x20, 0x61, 'a'}},
+		{name: "struct", val: testCBORInner{A: 1}, want: []byte{0xa1, 0x61, 'a', 0x01}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := (cborCodec{}).NewEncoder(&buf).Encode(tt.val); err != nil {
+				t.Fatal(err)
+			}
+			if e := compare.Compare(buf.Bytes(), tt.want); e != nil {
+				t.Error(e)
+			}
+		})
+	}
+}
+
+func TestCBOR_RoundTrip(t *testing.T) {
+	in := testCBOR{
+		Name:   "foo",
+		Count:  300,
+		Skip:   "skipped",
+		Tags:   []string{"a", "b"},
+		Inner:  &testCBORInner{A: -5, B: "bar"},
+		Attrs:  map[string]int{"x": 1, "y": 70000},
+		When:   time.Date(2021, 3, 4, 5, 6, 7, 0, time.UTC),
+		Big:    *new(big.Int).Lsh(big.NewInt(1), 100),
+		Tag:    CBORTag{Number: 42, Content: "data"},
+		Bytes:  []byte{0, 1, 2},
+		Plain:  true,
+		hidden: 1,
+	}
+
+	w := httptest.NewRecorder()
+	if err := (CBOR{in}).WriteBody(w, nil, http.StatusOK); err != nil {
+		t.Fatal(err)
+	}
+	if e := compare.Compare(w.Header().Get("Content-Type"), contentTypeCBOR); e != nil {
+		t.Error(e)
+	}
+
+	var out testCBOR
+	r := &http.Request{Body: strReadCloser{strings.NewReader(w.Body.String())}}
+	if err := (CBOR{&out}).ReadBody(r); err != nil {
+		t.Fatal(err)
+	}
+
+	in.Skip, in.hidden = "", 0
+	if e := compare.Compare(out, in); e != nil {
+		t.Error(e)
+	}
+}
+
+func TestCBOR_DecodeInterface(t *testing.T) {
+	tests := []struct {
+		name string
+		data []byte
+		want interface{}
+	}{
+		{name: "null", data: []byte{0xf6}, want: nil},
+		{name: "int", data: []byte{0x39, 0x03, 0xe7}, want: int64(-1000)},
+		{name: "uint64", data: []byte{0x1b, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff}, want: uint64(math.MaxUint64)},
+		{name: "half float", data: []byte{0xf9, 0x3c, 0x00}, want: 1.0},
+		{name: "indefinite bytes", data: []byte{0x5f, 0x42, 1, 2, 0x43, 3, 4, 5, 0xff}, want: []byte{1, 2, 3, 4, 5}},
+		{name: "indefinite text", data: []byte{0x7f, 0x62, 's', 't', 0x63, 'r', 'e', 'a', 0xff}, want: "strea"},
+		{name: "indefinite array", data: []byte{0x9f, 0x01, 0x82, 0x02, 0x03, 0xff},
+			want: []interface{}{int64(1), []interface{}{int64(2), int64(3)}}},
+		{name: "indefinite map", data: []byte{0xbf, 0x61, 'a', 0x01, 0xff}, want: map[string]interface{}{"a": int64(1)}},
+		{name: "non-string keys", data: []byte{0xa1, 0x01, 0x02}, want: map[interface{}]interface{}{int64(1): int64(2)}},
+		{name: "date/time string", data: append([]byte{0xc0, 0x74}, "2013-03-21T20:04:00Z"...),
+			want: time.Date(2013, 3, 21, 20, 4, 0, 0, time.UTC)},
+		{name: "epoch date/time", data: []byte{0xc1, 0x1a, 0x51, 0x4b, 0x67, 0xb0},
+			want: time.Date(2013, 3, 21, 20, 4, 0, 0, time.UTC)},
+		{name: "negative bignum", data: []byte{0xc3, 0x41, 0x01}, want: big.NewInt(-2)},
+		{name: "unknown tag", data: []byte{0xd8, 0x20, 0x61, 'a'}, want: CBORTag{Number: 32, Content: "a"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out interface{}
+			if err := (cborCodec{}).NewDecoder(bytes.NewReader(tt.data)).Decode(&out); err != nil {
+				t.Fatal(err)
+			}
+			if e := compare.Compare(out, tt.want); e != nil {
+				t.Error(e)
+			}
+		})
+	}
+}
+
+func TestCBOR_DecodeErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		data []byte
+		dest interface{}
+		err  string
+	}{{
+		name: "empty",
+		data: []byte{},
+		dest: new(int),
+		err:  io.EOF.Error(),
+	}, {
+		name: "truncated",
+		data: []byte{0x19, 0x03},
+		dest: new(int),
+		err:  io.ErrUnexpectedEOF.Error(),
+	}, {
+		name: "truncated array",
+		data: []byte{0x82, 0x01},
+		dest: new([]int),
+		err:  io.ErrUnexpectedEOF.Error(),
+	}, {
+		name: "overflow",
+		data: []byte{0x19, 0x03, 0xe8},
+		dest: new(int8),
+		err:  "cbor: cannot decode major type 0 into Go value of type int8",
+	}, {
+		name: "negative into uint",
+		data: []byte{0x20},
+		dest: new(uint),
+		err:  "cbor: cannot decode major type 1 into Go value of type uint",
+	}, {
+		name: "string into int",
+		data: []byte{0x61, 'a'},
+		dest: new(int),
+		err:  "cbor: cannot decode major type 3 into Go value of type int",
+	}, {
+		name: "non-pointer",
+		data: []byte{0x01},
+		dest: 1,
+		err:  "cbor: cannot decode into non-pointer int",
+	}, {
+		name: "unhashable key typed",
+		data: []byte{0xa1, 0x81, 0x01, 0x01},
+		dest: new(map[interface{}]interface{}),
+		err:  "cbor: unhashable map key of type []interface {}",
+	}, {
+		name: "unexported embedded pointer",
+		data: []byte{0xa1, 0x61, 'A', 0x01},
+		dest: new(testCBOREmbedded),
+		err:  "cbor: cannot set embedded pointer to unexported struct httpio.testCBORUnexported",
+	}, {
+		name: "max depth",
+		data: bytes.Repeat([]byte{0x81}, 1<<20),
+		dest: new(interface{}),
+		err:  "cbor: exceeded max depth",
+	}, {
+		name: "max depth typed",
+		data: bytes.Repeat([]byte{0x81}, 1<<20),
+		dest: new([]interface{}),
+		err:  "cbor: exceeded max depth",
+	}}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := (cborCodec{}).NewDecoder(bytes.NewReader(tt.data)).Decode(tt.dest)
+			if err == nil {
+				t.Fatal("expected error")
+			}
+			if e := compare.Compare(err.Error(), tt.err); e != nil {
+				t.Error(e)
+			}
+		})
+	}
+}
+
+func TestCBOR_ReadError(t *testing.T) {
+	r := &http.Request{Body: strReadCloser{strings.NewReader("\x61")}}
+	err := (CBOR{new(string)}).ReadBody(r)
+	if _, ok := err.(ReadError); !ok {
+		t.Errorf("got %T, want ReadError", err)
+	}
+}
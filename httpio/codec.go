@@ -0,0 +1,278 @@
+package httpio
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"reflect"
+	"strings"
+	"sync"
+
+	"github.com/frk/form"
+)
+
+// Decoder is the interface that wraps the Decode method.
+type Decoder interface {
+	// Decode reads the next encoded value from its input
+	// and stores it in the value pointed to by v.
+	Decode(v interface{}) error
+}
+
+// Encoder is the interface that wraps the Encode method.
+type Encoder interface {
+	// Encode writes the encoding of v to its output.
+	Encode(v interface{}) error
+}
+
+// Codec is the interface that groups the encoding and decoding
+// of values for a specific media type.
+type Codec interface {
+	// MediaType returns the media type handled by the Codec, e.g.
+	// "application/json". The returned value may include parameters, e.g.
+	// "; charset=utf-8", in which case they will be included in the
+	// Content-Type header of responses encoded by the Codec.
+	MediaType() string
+	// NewDecoder returns a new Decoder that reads from r.
+	NewDecoder(r io.Reader) Decoder
+	// NewEncoder returns a new Encoder that writes to w.
+	NewEncoder(w io.Writer) Encoder
+}
+
+// codecRegistry holds the registered Codecs.
+var codecRegistry struct {
+	sync.RWMutex
+	list   []Codec
+	byType map[string]Codec
+}
+
+func init() {
+	RegisterCodec(jsonCodec{})
+	RegisterCodec(xmlCodec{contentTypeXML})
+	RegisterCodec(xmlCodec{"text/xml; charset=utf-8"})
+	RegisterCodec(formCodec{})
+	RegisterCodec(textCodec{})
+	RegisterCodec(msgpackCodec{})
+	RegisterCodec(cborCodec{})
+}
+
+// RegisterCodec registers the given Codec for its media type. If a Codec for
+// the same media type was registered previously it will be replaced, this
+// can be used to, for example, swap out the default "application/json" Codec
+// for a faster implementation.
+//
+// RegisterCodec is intended to be called at program start up, usually from
+// an init function.
+func RegisterCodec(c Codec) {
+	mtype := baseMediaType(c.MediaType())
+
+	codecRegistry.Lock()
+	defer codecRegistry.Unlock()
+	if codecRegistry.byType == nil {
+		codecRegistry.byType = make(map[string]Codec)
+	}
+	if _, ok := codecRegistry.byType[mtype]; ok {
+		for i, c2 := range codecRegistry.list {
+			if baseMediaType(c2.MediaType()) == mtype {
+				codecRegistry.list[i] = c
+			}
+		}
+	} else {
+		codecRegistry.list = append(codecRegistry.list, c)
+	}
+	codecRegistry.byType[mtype] = c
+}
+
+// LookupCodec returns the Codec registered for the given media type. Any
+// parameters of the media type are ignored. If there's no Codec registered
+// for the exact media type, but the media type has a structured syntax suffix,
+// e.g. "application/vnd.api+json", then the Codec registered for the suffix's
+// base type, e.g. "application/json", is returned.
+func LookupCodec(mediaType string) (Codec, bool) {
+	mtype := baseMediaType(mediaType)
+
+	codecRegistry.RLock()
+	defer codecRegistry.RUnlock()
+	if c, ok := codecRegistry.byType[mtype]; ok {
+		return c, true
+	}
+	if base := suffixMediaType(mtype); len(base) > 0 {
+		if c, ok := codecRegistry.byType[base]; ok {
+			return c, true
+		}
+	}
+	return nil, false
+}
+
+// Codecs returns the list of registered Codecs in the order of registration.
+func Codecs() []Codec {
+	codecRegistry.RLock()
+	defer codecRegistry.RUnlock()
+	return append([]Codec(nil), codecRegistry.list...)
+}
+
+// mustLookupCodec is like LookupCodec but panics if there's no Codec
+// registered for the media type. It is used for the package's own
+// media types which are registered on init.
+func mustLookupCodec(mediaType string) Codec {
+	c, ok := LookupCodec(mediaType)
+	if !ok {
+		panic("httpcrud/httpio: no codec registered for " + mediaType)
+	}
+	return c
+}
+
+// baseMediaType returns the lower-cased media type without parameters.
+func baseMediaType(mediaType string) string {
+	if mtype, _, err := mime.ParseMediaType(mediaType); err == nil {
+		return mtype
+	}
+	if i := strings.IndexByte(mediaType, ';'); i >= 0 {
+		mediaType = mediaType[:i]
+	}
+	return strings.ToLower(strings.TrimSpace(mediaType))
+}
+
+// The Body type implements both the BodyWriter and the BodyReader interfaces
+// by using the Codec registered for the media type of the body.
+type Body struct {
+	// The value to be encoded and sent in an HTTP response body or
+	// a pointer to the value to be decoded from an HTTP request's body.
+	Val interface{}
+	// The media type of the body. When reading, the request's Content-Type
+	// takes precedence and Type is used only if the request has none.
+	// When writing, if Type is not set, the media type will be negotiated
+	// from the request's Accept header and the registered Codecs.
+	Type string
+}
+
+// ReadBody implements the BodyReader interface by decoding the request's
+// body into the receiver's Val field using the Codec registered for the
+// request's media type. If no such Codec exists ReadBody will return an
+// UnsupportedMediaTypeError.
+func (b Body) ReadBody(r *http.Request) error {
+	mtype := requestMediaType(r)
+	if len(mtype) == 0 && len(b.Type) > 0 {
+		mtype = baseMediaType(b.Type)
+	}
+
+	c, ok := LookupCodec(mtype)
+	if !ok {
+		return UnsupportedMediaTypeError{MediaType: mtype, Accepted: codecMediaTypes()}
+	}
+	return decodeBody(c, r, b.Val)
+}
+
+// WriteInit is a noop, required only to satisfy the BodyWriter interface.
+func (Body) WriteInit(_ http.ResponseWriter) error {
+	return nil
+}
+
+// WriteBody implements the BodyWriter interface by encoding the receiver's
+// Val field using the Codec registered for the receiver's Type, or the
+// Codec negotiated from the request's Accept header if Type is not set.
+// If there's no Codec registered for the Type, a NoCodecError is returned.
+func (b Body) WriteBody(w http.ResponseWriter, r *http.Request, statusCode int) error {
+	if len(b.Type) == 0 {
+		return Negotiate{Val: b.Val}.WriteBody(w, r, statusCode)
+	}
+
+	c, ok := LookupCodec(b.Type)
+	if !ok {
+		return NoCodecError{b.Type}
+	}
+	return encodeBody(c, w, statusCode, b.Val)
+}
+
+// codecMediaTypes returns the media types of the registered Codecs.
+func codecMediaTypes() []string {
+	codecs := Codecs()
+	types := make([]string, len(codecs))
+	for i, c := range codecs {
+		types[i] = baseMediaType(c.MediaType())
+	}
+	return types
+}
+
+// decodeBody decodes the request's body into v using the given Codec.
+func decodeBody(c Codec, r *http.Request, v interface{}) error {
+	if err := c.NewDecoder(r.Body).Decode(v); err != nil {
+		return ReadError{err}
+	}
+	return nil
+}
+
+// encodeBody writes the header with the given status code and the Codec's
+// media type as the Content-Type, and then encodes v into the response body.
+func encodeBody(c Codec, w http.ResponseWriter, statusCode int, v interface{}) error {
+	w.Header().Set("Content-Type", c.MediaType())
+	w.WriteHeader(statusCode)
+	if err := c.NewEncoder(w).Encode(v); err != nil {
+		return WriteError{err}
+	}
+	return nil
+}
+
+// jsonCodec implements the Codec interface using the encoding/json package.
+type jsonCodec struct{}
+
+func (jsonCodec) MediaType() string              { return contentTypeJSON }
+func (jsonCodec) NewDecoder(r io.Reader) Decoder { return json.NewDecoder(r) }
+func (jsonCodec) NewEncoder(w io.Writer) Encoder { return json.NewEncoder(w) }
+
+// xmlCodec implements the Codec interface using the encoding/xml package.
+type xmlCodec struct{ mediaType string }
+
+func (c xmlCodec) MediaType() string            { return c.mediaType }
+func (xmlCodec) NewDecoder(r io.Reader) Decoder { return xml.NewDecoder(r) }
+func (xmlCodec) NewEncoder(w io.Writer) Encoder { return xml.NewEncoder(w) }
+
+// formCodec implements the Codec interface using the github.com/frk/form package.
+type formCodec struct{}
+
+func (formCodec) MediaType() string              { return contentTypeForm }
+func (formCodec) NewDecoder(r io.Reader) Decoder { return form.NewDecoder(r) }
+func (formCodec) NewEncoder(w io.Writer) Encoder { return form.NewEncoder(w) }
+
+// textCodec implements the Codec interface for plain text. The decoder can
+// decode only into strings and byte slices, the encoder writes the values
+// formatted with the fmt package's %v verb.
+type textCodec struct{}
+
+func (textCodec) MediaType() string              { return contentTypeText }
+func (textCodec) NewDecoder(r io.Reader) Decoder { return textDecoder{r} }
+func (textCodec) NewEncoder(w io.Writer) Encoder { return textEncoder{w} }
+
+type textDecoder struct{ r io.Reader }
+
+func (d textDecoder) Decode(v interface{}) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() {
+		return fmt.Errorf("httpcrud/httpio: cannot decode text into %T", v)
+	}
+	rv = rv.Elem()
+	if rv.Kind() != reflect.String && !(rv.Kind() == reflect.Slice && rv.Type().Elem().Kind() == reflect.Uint8) {
+		return fmt.Errorf("httpcrud/httpio: cannot decode text into %T", v)
+	}
+
+	data, err := ioutil.ReadAll(d.r)
+	if err != nil {
+		return err
+	}
+	if rv.Kind() == reflect.String {
+		rv.SetString(string(data))
+	} else {
+		rv.SetBytes(data)
+	}
+	return nil
+}
+
+type textEncoder struct{ w io.Writer }
+
+func (e textEncoder) Encode(v interface{}) error {
+	_, err := fmt.Fprint(e.w, v)
+	return err
+}
@@ -0,0 +1,165 @@
+package httpio
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/frk/compare"
+)
+
+// upperCodec is a test Codec that encodes strings in upper case.
+type upperCodec struct{}
+
+func (upperCodec) MediaType() string              { return "application/x-upper" }
+func (upperCodec) NewDecoder(r io.Reader) Decoder { return textDecoder{r} }
+func (upperCodec) NewEncoder(w io.Writer) Encoder { return upperEncoder{w} }
+
+type upperEncoder struct{ w io.Writer }
+
+func (e upperEncoder) Encode(v interface{}) error {
+	_, err := io.WriteString(e.w, strings.ToUpper(v.(string)))
+	return err
+}
+
+func TestLookupCodec(t *testing.T) {
+	tests := []struct {
+		mtype string
+		want  Codec
+		ok    bool
+	}{
+		{mtype: "application/json", want: jsonCodec{}, ok: true},
+		{mtype: "Application/JSON; charset=utf-8", want: jsonCodec{}, ok: true},
+		{mtype: "application/problem+json", want: jsonCodec{}, ok: true},
+		{mtype: "text/xml", want: xmlCodec{"text/xml; charset=utf-8"}, ok: true},
+		{mtype: "image/png", want: nil, ok: false},
+	}
+
+	for _, tt := range tests {
+		c, ok := LookupCodec(tt.mtype)
+		if e := compare.Compare(ok, tt.ok); e != nil {
+			t.Error(tt.mtype, e)
+		}
+		if e := compare.Compare(c, tt.want); e != nil {
+			t.Error(tt.mtype, e)
+		}
+	}
+}
+
+func TestRegisterCodec(t *testing.T) {
+	RegisterCodec(upperCodec{})
+	defer func() {
+		codecRegistry.Lock()
+		delete(codecRegistry.byType, "application/x-upper")
+		codecRegistry.list = codecRegistry.list[:len(codecRegistry.list)-1]
+		codecRegistry.Unlock()
+	}()
+
+	t.Run("write", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		if err := (Body{Val: "hello", Type: "application/x-upper"}).WriteBody(w, nil, 200); err != nil {
+			t.Fatal(err)
+		}
+		if e := compare.Compare(w.Body.String(), "HELLO"); e != nil {
+			t.Error(e)
+		}
+		if e := compare.Compare(w.Header().Get("Content-Type"), "application/x-upper"); e != nil {
+			t.Error(e)
+		}
+	})
+
+	t.Run("negotiate", func(t *testing.T) {
+		r := httptest.NewRequest("GET", "/", nil)
+		r.Header.Set("Accept", "application/x-upper")
+		w := httptest.NewRecorder()
+		if err := (Body{Val: "hello"}).WriteBody(w, r, 200); err != nil {
+			t.Fatal(err)
+		}
+		if e := compare.Compare(w.Body.String(), "HELLO"); e != nil {
+			t.Error(e)
+		}
+	})
+
+	t.Run("read", func(t *testing.T) {
+		var s string
+		r := httptest.NewRequest("POST", "/", strings.NewReader("hello"))
+		r.Header.Set("Content-Type", "application/x-upper")
+		if err := (AnyBody{Val: &s}).ReadBody(r); err != nil {
+			t.Fatal(err)
+		}
+		if e := compare.Compare(s, "hello"); e != nil {
+			t.Error(e)
+		}
+	})
+}
+
+func TestBody_WriteBody_NoCodec(t *testing.T) {
+	w := httptest.NewRecorder()
+	err := Body{Val: "hello", Type: "application/x-unknown"}.WriteBody(w, nil, 200)
+	if e := compare.Compare(err, NoCodecError{"application/x-unknown"}); e != nil {
+		t.Error(e)
+	}
+	want := `httpcrud/httpio: no codec registered for "application/x-unknown"`
+	if e := compare.Compare(err.Error(), want); e != nil {
+		t.Error(e)
+	}
+	if e := compare.Compare(NoCodecError{}.StatusCode(), http.StatusInternalServerError); e != nil {
+		t.Error(e)
+	}
+}
+
+func TestBody_ReadBody(t *testing.T) {
+	tests := []struct {
+		name  string
+		ctype string
+		body  Body
+		data  string
+		want  interface{}
+		err   error
+	}{{
+		name:  "json",
+		ctype: "application/json",
+		body:  Body{Val: &testBody{}},
+		data:  `{"foo":"test"}`,
+		want:  &testBody{Foo: "test"},
+	}, {
+		name: "fallback type",
+		body: Body{Val: &testBody{}, Type: "application/x-www-form-urlencoded"},
+		data: `foo=test&baz=true`,
+		want: &testBody{Foo: "test", Baz: true},
+	}, {
+		name:  "text",
+		ctype: "text/plain",
+		body:  Body{Val: new(string)},
+		data:  `hello`,
+		want:  func() *string { s := "hello"; return &s }(),
+	}, {
+		name:  "unsupported",
+		ctype: "application/octet-stream",
+		body:  Body{Val: &testBody{}},
+		data:  `foo`,
+		want:  &testBody{},
+		err: UnsupportedMediaTypeError{MediaType: "application/octet-stream", Accepted: []string{
+			"application/json", "application/xml", "text/xml", "application/x-www-form-urlencoded",
+			"text/plain", "application/msgpack", "application/cbor"}},
+	}}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := &http.Request{Header: http.Header{}, Body: strReadCloser{strings.NewReader(tt.data)}}
+			if len(tt.ctype) > 0 {
+				r.Header.Set("Content-Type", tt.ctype)
+			}
+
+			err := tt.body.ReadBody(r)
+			if e := compare.Compare(err, tt.err); e != nil {
+				t.Error(e)
+			}
+			if e := compare.Compare(tt.body.Val, tt.want); e != nil {
+				t.Error(e)
+			}
+		})
+	}
+}
@@ -0,0 +1,303 @@
+package httpio
+
+import (
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// The default minimum size of a response body for it to be compressed.
+const defaultCompressMinSize = 1024
+
+// Compression holds the settings used to compress response bodies with the
+// content coding negotiated from the request's Accept-Encoding header. The
+// supported content codings are "gzip" and "deflate".
+//
+// The response body is not compressed if it's smaller than MinSize, if the
+// response already has a Content-Encoding, or if the response's Content-Type
+// denotes already compressed content, e.g. images, video, audio or archives.
+// A body that is flushed before MinSize bytes have been written is treated as
+// a stream and is compressed regardless of its size, the flushes are passed
+// on to the underlying writer after flushing the compressor.
+//
+// Compression can be used either as route middleware through its Handler
+// method, or by setting the ResponseWriter's Compress field. Note that since
+// StreamWriters, like CSVWriter, are opened by WriteInit, before the request's
+// Accept-Encoding header is available to the ResponseWriter, their output
+// can be compressed only by the middleware.
+type Compression struct {
+	// The minimum size of a response body, in bytes, for it
+	// to be compressed. If not set, 1024 will be used.
+	MinSize int
+	// The compression level, as defined by the compress/flate package.
+	// If not set, flate.DefaultCompression will be used.
+	Level int
+}
+
+// Handler returns an http.Handler that compresses the responses of h.
+// The method's signature allows it to be used as route middleware.
+func (c Compression) Handler(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		addVary(w.Header(), "Accept-Encoding")
+
+		// protocol upgrades, e.g. to WebSocket, need the
+		// original writer to be able to hijack the connection
+		enc := negotiateEncoding(r.Header.Get("Accept-Encoding"))
+		if len(enc) == 0 || len(r.Header.Get("Upgrade")) > 0 {
+			h.ServeHTTP(w, r)
+			return
+		}
+
+		cw := c.newWriter(w, enc)
+		defer cw.Close()
+		h.ServeHTTP(cw, r)
+	})
+}
+
+func (c Compression) newWriter(w http.ResponseWriter, encoding string) *compressWriter {
+	cw := &compressWriter{w: w, encoding: encoding, level: c.Level, minSize: c.MinSize}
+	if cw.level == 0 {
+		cw.level = flate.DefaultCompression
+	}
+	if cw.minSize <= 0 {
+		cw.minSize = defaultCompressMinSize
+	}
+	return cw
+}
+
+// negotiateEncoding returns the supported content coding that best matches
+// the given Accept-Encoding header value, or an empty string if none does.
+// If equally acceptable, gzip is preferred over deflate.
+func negotiateEncoding(accept string) string {
+	var gzipq, deflateq, anyq float64 = -1, -1, -1
+	for _, part := range strings.Split(accept, ",") {
+		fields := strings.Split(part, ";")
+		coding := strings.ToLower(strings.TrimSpace(fields[0]))
+
+		q := 1.0
+		for _, p := range fields[1:] {
+			kv := strings.SplitN(strings.TrimSpace(p), "=", 2)
+			if len(kv) == 2 && strings.ToLower(strings.TrimSpace(kv[0])) == "q" {
+				if v, err := strconv.ParseFloat(strings.TrimSpace(kv[1]), 64); err == nil {
+					q = v
+				}
+			}
+		}
+
+		switch coding {
+		case "gzip", "x-gzip":
+			gzipq = q
+		case "deflate":
+			deflateq = q
+		case "*":
+			anyq = q
+		}
+	}
+	if gzipq < 0 {
+		gzipq = anyq
+	}
+	if deflateq < 0 {
+		deflateq = anyq
+	}
+
+	switch {
+	case gzipq > 0 && gzipq >= deflateq:
+		return "gzip"
+	case deflateq > 0:
+		return "deflate"
+	}
+	return ""
+}
+
+// compressWriter implements the http.ResponseWriter and http.Flusher interfaces.
+// It buffers the start of the body until it can decide whether the body should
+// be compressed, and from then on it writes the body either through the
+// compressor or directly to the underlying http.ResponseWriter.
+type compressWriter struct {
+	w        http.ResponseWriter
+	encoding string
+	level    int
+	minSize  int
+
+	// the status code passed to WriteHeader, if any
+	status int
+	// the start of the body, buffered until decided is set
+	buf []byte
+	// set once the writer has decided whether to compress
+	decided bool
+	// the compressor, nil if the body is not compressed
+	cw interface {
+		io.WriteCloser
+		Flush() error
+	}
+}
+
+func (w *compressWriter) Header() http.Header {
+	return w.w.Header()
+}
+
+func (w *compressWriter) WriteHeader(statusCode int) {
+	if w.decided || statusCode < 200 {
+		w.w.WriteHeader(statusCode)
+		return
+	}
+	if w.status != 0 {
+		return // superfluous call
+	}
+	w.status = statusCode
+	if statusCode == http.StatusNoContent || statusCode == http.StatusNotModified {
+		w.decide(false)
+	}
+}
+
+func (w *compressWriter) Write(p []byte) (int, error) {
+	if !w.decided {
+		w.buf = append(w.buf, p...)
+		if len(w.buf) < w.minSize {
+			return len(p), nil
+		}
+		if err := w.decide(true); err != nil {
+			return 0, err
+		}
+		return len(p), nil
+	}
+	if w.cw != nil {
+		return w.cw.Write(p)
+	}
+	return w.w.Write(p)
+}
+
+// Flush implements the http.Flusher interface.
+func (w *compressWriter) Flush() {
+	if !w.decided {
+		if err := w.decide(true); err != nil {
+			return
+		}
+	}
+	if w.cw != nil {
+		if err := w.cw.Flush(); err != nil {
+			return
+		}
+	}
+	if f, ok := w.w.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Close decides, if it hasn't already, whether to compress the
+// buffered body, and then flushes and closes the compressor.
+func (w *compressWriter) Close() error {
+	if !w.decided {
+		if err := w.decide(len(w.buf) >= w.minSize); err != nil {
+			return err
+		}
+	}
+	if w.cw != nil {
+		return w.cw.Close()
+	}
+	return nil
+}
+
+// Unwrap returns the underlying http.ResponseWriter.
+func (w *compressWriter) Unwrap() http.ResponseWriter {
+	return w.w
+}
+
+// decide writes the header and the buffered body, compressing the
+// body if compress is true and the response's header allows it.
+func (w *compressWriter) decide(compress bool) (err error) {
+	w.decided = true
+
+	h := w.w.Header()
+	if compress {
+		if len(w.buf) > 0 && len(h.Get("Content-Type")) == 0 {
+			h.Set("Content-Type", http.DetectContentType(w.buf))
+		}
+		compress = len(h.Get("Content-Encoding")) == 0 && isCompressible(h.Get("Content-Type"))
+	}
+	if compress && isRangeResponse(w.status, h) {
+		// The client would decompress the body and use the result as
+		// a byte range of the identity representation, which it isn't.
+		compress = false
+	}
+
+	if compress {
+		addVary(h, "Accept-Encoding")
+		// The compressed representation is not byte-for-byte identical
+		// with the identity one and so it cannot share its strong ETag.
+		if t, ok := ParseETag(h.Get("ETag")); ok && !t.Weak {
+			t.Weak = true
+			h.Set("ETag", t.String())
+		}
+		h.Set("Content-Encoding", w.encoding)
+		h.Del("Content-Length")
+		if w.encoding == "gzip" {
+			gw, err := gzip.NewWriterLevel(w.w, w.level)
+			if err != nil {
+				return err
+			}
+			w.cw = gw
+		} else {
+			zw, err := zlib.NewWriterLevel(w.w, w.level)
+			if err != nil {
+				return err
+			}
+			w.cw = zw
+		}
+	}
+
+	if w.status != 0 {
+		w.w.WriteHeader(w.status)
+	}
+	if len(w.buf) > 0 {
+		buf := w.buf
+		w.buf = nil
+		if w.cw != nil {
+			_, err = w.cw.Write(buf)
+		} else {
+			_, err = w.w.Write(buf)
+		}
+	}
+	return err
+}
+
+// isRangeResponse reports whether the response with the given status and
+// header is, or may be followed by, a response to a byte range request.
+func isRangeResponse(status int, h http.Header) bool {
+	if status == http.StatusPartialContent || len(h.Get("Content-Range")) > 0 {
+		return true
+	}
+	ar := h.Get("Accept-Ranges")
+	return len(ar) > 0 && ar != "none"
+}
+
+// isCompressible reports whether content of the given
+// media type is worth compressing.
+func isCompressible(contentType string) bool {
+	mtype := baseMediaType(contentType)
+	switch {
+	case mtype == "image/svg+xml":
+		return true
+	case strings.HasPrefix(mtype, "image/"),
+		strings.HasPrefix(mtype, "video/"),
+		strings.HasPrefix(mtype, "audio/"):
+		return false
+	}
+	switch mtype {
+	case "application/zip",
+		"application/gzip",
+		"application/x-gzip",
+		"application/x-bzip2",
+		"application/x-7z-compressed",
+		"application/x-rar-compressed",
+		"application/zstd",
+		"font/woff",
+		"font/woff2":
+		return false
+	}
+	return true
+}
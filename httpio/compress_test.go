@@ -0,0 +1,230 @@
+package httpio
+
+import (
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/frk/compare"
+)
+
+func TestNegotiateEncoding(t *testing.T) {
+	tests := []struct {
+		accept string
+		want   string
+	}{
+		{accept: "", want: ""},
+		{accept: "identity", want: ""},
+		{accept: "gzip", want: "gzip"},
+		{accept: "deflate", want: "deflate"},
+		{accept: "deflate, gzip", want: "gzip"},
+		{accept: "gzip;q=0.5, deflate", want: "deflate"},
+		{accept: "gzip;q=0, deflate;q=0", want: ""},
+		{accept: "*", want: "gzip"},
+		{accept: "*;q=0.5, gzip;q=0", want: "deflate"},
+		{accept: "br, x-gzip", want: "gzip"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.accept, func(t *testing.T) {
+			if e := compare.Compare(negotiateEncoding(tt.accept), tt.want); e != nil {
+				t.Error(e)
+			}
+		})
+	}
+}
+
+func decompressTestBody(t *testing.T, encoding string, body io.Reader) string {
+	var r io.Reader = body
+	var err error
+	switch encoding {
+	case "gzip":
+		r, err = gzip.NewReader(body)
+	case "deflate":
+		r, err = zlib.NewReader(body)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func TestCompression_Handler(t *testing.T) {
+	large := strings.Repeat("hello world ", 200)
+
+	tests := []struct {
+		name     string
+		accept   string
+		ctype    string
+		cenc     string
+		status   int
+		header   map[string]string
+		body     string
+		encoding string
+		etag     string
+	}{{
+		name:     "should compress large body with gzip",
+		accept:   "gzip, deflate",
+		body:     large,
+		encoding: "gzip",
+	}, {
+		name:     "should compress large body with deflate",
+		accept:   "deflate",
+		status:   http.StatusCreated,
+		body:     large,
+		encoding: "deflate",
+	}, {
+		name:   "should not compress small body",
+		accept: "gzip",
+		body:   "hello",
+	}, {
+		name:   "should not compress when not accepted",
+		accept: "br",
+		body:   large,
+	}, {
+		name:   "should not compress images",
+		accept: "gzip",
+		ctype:  "image/png",
+		body:   large,
+	}, {
+		name:   "should not compress already encoded body",
+		accept: "gzip",
+		cenc:   "br",
+		body:   large,
+	}, {
+		name:   "should not compress no content",
+		accept: "gzip",
+		status: http.StatusNoContent,
+	}, {
+		name:   "should not compress partial content",
+		accept: "gzip",
+		status: http.StatusPartialContent,
+		header: map[string]string{"Content-Range": "bytes 0-2399/5000"},
+		body:   large,
+	}, {
+		name:   "should not compress when ranges are accepted",
+		accept: "gzip",
+		header: map[string]string{"Accept-Ranges": "bytes", "ETag": `"v1"`},
+		body:   large,
+		etag:   `"v1"`,
+	}, {
+		name:     "should weaken strong etag",
+		accept:   "gzip",
+		header:   map[string]string{"ETag": `"v1"`},
+		body:     large,
+		encoding: "gzip",
+		etag:     `W/"v1"`,
+	}}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := Compression{}.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if len(tt.ctype) > 0 {
+					w.Header().Set("Content-Type", tt.ctype)
+				}
+				if len(tt.cenc) > 0 {
+					w.Header().Set("Content-Encoding", tt.cenc)
+				}
+				for k, v := range tt.header {
+					w.Header().Set(k, v)
+				}
+				if tt.status > 0 {
+					w.WriteHeader(tt.status)
+				}
+				io.WriteString(w, tt.body)
+			}))
+
+			r := httptest.NewRequest("GET", "/", nil)
+			r.Header.Set("Accept-Encoding", tt.accept)
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, r)
+
+			status := tt.status
+			if status == 0 {
+				status = http.StatusOK
+			}
+			if e := compare.Compare(w.Code, status); e != nil {
+				t.Error(e)
+			}
+			if e := compare.Compare(w.Header().Get("Vary"), "Accept-Encoding"); e != nil {
+				t.Error(e)
+			}
+
+			encoding := w.Header().Get("Content-Encoding")
+			if encoding == tt.cenc {
+				encoding = ""
+			}
+			if e := compare.Compare(encoding, tt.encoding); e != nil {
+				t.Error(e)
+			}
+			if e := compare.Compare(decompressTestBody(t, encoding, w.Body), tt.body); e != nil {
+				t.Error(e)
+			}
+			if e := compare.Compare(w.Header().Get("ETag"), tt.etag); e != nil {
+				t.Error(e)
+			}
+		})
+	}
+}
+
+func TestCompression_Handler_Flush(t *testing.T) {
+	h := Compression{}.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		stream := &CSVWriter{Header: []string{"a", "b"}, FileName: "test.csv"}
+		CSV{stream}.WriteInit(w)
+		stream.WriteRow([]string{"1", "2"})
+		CSV{stream}.WriteBody(w, r, 0)
+		w.(http.Flusher).Flush()
+		stream.WriteRow([]string{"3", "4"})
+		CSV{stream}.WriteBody(w, r, 0)
+	}))
+
+	r := httptest.NewRequest("GET", "/", nil)
+	r.Header.Set("Accept-Encoding", "gzip")
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+
+	if !w.Flushed {
+		t.Error("response was not flushed")
+	}
+	if e := compare.Compare(w.Header().Get("Content-Encoding"), "gzip"); e != nil {
+		t.Error(e)
+	}
+	if e := compare.Compare(w.Header().Get("Content-Type"), contentTypeCSV); e != nil {
+		t.Error(e)
+	}
+	if e := compare.Compare(decompressTestBody(t, "gzip", w.Body), "a,b\n1,2\n3,4\n"); e != nil {
+		t.Error(e)
+	}
+}
+
+func TestResponseWriter_Compress(t *testing.T) {
+	val := map[string]string{"data": strings.Repeat("x", 2000)}
+
+	r := httptest.NewRequest("GET", "/", nil)
+	r.Header.Set("Accept-Encoding", "gzip")
+	w := httptest.NewRecorder()
+
+	rw := ResponseWriter{Body: JSON{Val: val}, Compress: &Compression{}}
+	if err := rw.WriteResponse(w, r); err != nil {
+		t.Fatal(err)
+	}
+	if e := compare.Compare(w.Header().Get("Content-Encoding"), "gzip"); e != nil {
+		t.Error(e)
+	}
+	if e := compare.Compare(w.Header().Get("Content-Type"), contentTypeJSON); e != nil {
+		t.Error(e)
+	}
+	want := `{"data":"` + strings.Repeat("x", 2000) + `"}` + "\n"
+	if e := compare.Compare(decompressTestBody(t, "gzip", w.Body), want); e != nil {
+		t.Error(e)
+	}
+}
@@ -0,0 +1,196 @@
+package httpio
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// CORS can be used to handle Cross-Origin Resource Sharing requests. It can be
+// used either as route middleware through its Handler method, together with
+// the ServePreflight method for the OPTIONS requests, or by setting the CORS
+// field of the httpcrud.RouteOptions, or of a RouteList entry, in which case
+// the preflight requests are answered automatically.
+type CORS struct {
+	// The list of allowed origins. An origin can be either an exact origin,
+	// e.g. "https://example.com", a wildcard origin that matches any of the
+	// subdomains of a domain, e.g. "https://*.example.com", or "*" to allow
+	// any origin. The origins are matched case-insensitively.
+	AllowOrigins []string
+	// The list of methods allowed in the preflight requests. If empty,
+	// the methods of the routes registered for the path will be allowed.
+	AllowMethods []string
+	// The list of headers allowed in the preflight requests. If empty, or
+	// if it contains "*", the headers requested by the client are allowed.
+	AllowHeaders []string
+	// The list of response headers that the client is allowed to access.
+	ExposeHeaders []string
+	// Indicates whether the client is allowed to send credentials, e.g.
+	// cookies. If set, the request's origin is sent back in place of "*".
+	// Credentials are never allowed for an origin that is matched only by
+	// the "*" entry of AllowOrigins, such an origin is sent "*" instead,
+	// otherwise any site could make credentialed requests.
+	AllowCredentials bool
+	// The time, truncated to seconds, for which the client may cache the
+	// preflight response. If zero, the Access-Control-Max-Age header is
+	// not set.
+	MaxAge time.Duration
+}
+
+// AllowOrigin reports whether the given origin is allowed.
+func (c *CORS) AllowOrigin(origin string) bool {
+	return c.matchOrigin(origin, true)
+}
+
+// matchOrigin reports whether the given origin matches any of the allowed
+// origins. If wildcard is false, the "*" entry of the allowed origins is ignored.
+func (c *CORS) matchOrigin(origin string, wildcard bool) bool {
+	if len(origin) == 0 {
+		return false
+	}
+	for _, o := range c.AllowOrigins {
+		if (o == "*" && wildcard) || strings.EqualFold(o, origin) {
+			return true
+		}
+		if i := strings.Index(o, "://*."); i >= 0 {
+			scheme, suffix := o[:i+3], o[i+4:]
+			if len(origin) > len(scheme)+len(suffix) &&
+				strings.EqualFold(origin[:len(scheme)], scheme) &&
+				strings.EqualFold(origin[len(origin)-len(suffix):], suffix) &&
+				!strings.ContainsAny(origin[len(scheme):len(origin)-len(suffix)], "/:") {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Handler returns an http.Handler that sets the CORS headers of the response
+// to an allowed origin's request and then calls h. The headers are set before
+// h is called, therefore they are sent also with the error responses. The
+// method's signature allows it to be used as route middleware.
+func (c *CORS) Handler(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c.WriteHeader(w.Header(), r)
+		h.ServeHTTP(w, r)
+	})
+}
+
+// WriteHeader sets the CORS headers of the response to the given request,
+// if the request's origin is allowed.
+func (c *CORS) WriteHeader(header http.Header, r *http.Request) {
+	origin := r.Header.Get("Origin")
+	if !c.anyOrigin() {
+		addVary(header, "Origin")
+	}
+	if !c.AllowOrigin(origin) {
+		return
+	}
+	c.writeOrigin(header, origin)
+	if len(c.ExposeHeaders) > 0 {
+		header.Set("Access-Control-Expose-Headers", strings.Join(c.ExposeHeaders, ", "))
+	}
+}
+
+// ServePreflight answers the given OPTIONS request. If the request is a preflight
+// request from an allowed origin, for one of the allowed methods and headers, the
+// response will include the CORS headers, otherwise it will be sent without them,
+// which will cause the client to reject the actual request. The methods argument
+// is used in place of AllowMethods if the latter is empty, and as the value of
+// the Allow header if the request is not a preflight request.
+func (c *CORS) ServePreflight(w http.ResponseWriter, r *http.Request, methods []string) {
+	h := w.Header()
+	origin := r.Header.Get("Origin")
+	method := r.Header.Get("Access-Control-Request-Method")
+	if len(origin) == 0 || len(method) == 0 {
+		h.Set("Allow", strings.Join(appendMethod(methods, http.MethodOptions), ", "))
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	addVary(h, "Origin")
+	addVary(h, "Access-Control-Request-Method")
+	addVary(h, "Access-Control-Request-Headers")
+	defer w.WriteHeader(http.StatusNoContent)
+
+	if !c.AllowOrigin(origin) {
+		return
+	}
+	allowMethods := c.AllowMethods
+	if len(allowMethods) == 0 {
+		allowMethods = methods
+	}
+	if !containsString(allowMethods, method) {
+		return
+	}
+	reqHeaders := parseHeaderNames(r.Header["Access-Control-Request-Headers"])
+	if len(c.AllowHeaders) > 0 && !containsString(c.AllowHeaders, "*") {
+		for _, name := range reqHeaders {
+			if !containsStringFold(c.AllowHeaders, name) {
+				return
+			}
+		}
+	}
+
+	c.writeOrigin(h, origin)
+	h.Set("Access-Control-Allow-Methods", strings.Join(allowMethods, ", "))
+	if len(reqHeaders) > 0 {
+		h.Set("Access-Control-Allow-Headers", strings.Join(reqHeaders, ", "))
+	}
+	if c.MaxAge > 0 {
+		h.Set("Access-Control-Max-Age", strconv.FormatInt(int64(c.MaxAge/time.Second), 10))
+	}
+}
+
+// writeOrigin sets the Access-Control-Allow-Origin and
+// Access-Control-Allow-Credentials headers for the given allowed origin.
+// If the origin was matched only by "*" the credentials are not allowed.
+func (c *CORS) writeOrigin(header http.Header, origin string) {
+	if c.anyOrigin() || !c.matchOrigin(origin, false) {
+		header.Set("Access-Control-Allow-Origin", "*")
+		return
+	}
+	header.Set("Access-Control-Allow-Origin", origin)
+	if c.AllowCredentials {
+		header.Set("Access-Control-Allow-Credentials", "true")
+	}
+}
+
+// anyOrigin reports whether the Access-Control-Allow-Origin
+// header can be set to "*" for any allowed origin.
+func (c *CORS) anyOrigin() bool {
+	return !c.AllowCredentials && containsString(c.AllowOrigins, "*")
+}
+
+// parseHeaderNames returns the list of header names from the given
+// comma separated header values, in their canonical format.
+func parseHeaderNames(values []string) (names []string) {
+	for _, v := range values {
+		for _, name := range strings.Split(v, ",") {
+			if name = strings.TrimSpace(name); len(name) > 0 {
+				names = append(names, http.CanonicalHeaderKey(name))
+			}
+		}
+	}
+	return names
+}
+
+// containsStringFold reports whether the list contains
+// the string s, compared case-insensitively.
+func containsStringFold(list []string, s string) bool {
+	for _, v := range list {
+		if strings.EqualFold(v, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// appendMethod appends the method to the list, unless it's already present.
+func appendMethod(methods []string, method string) []string {
+	if containsString(methods, method) {
+		return methods
+	}
+	return append(methods[:len(methods):len(methods)], method)
+}
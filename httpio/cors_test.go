@@ -0,0 +1,204 @@
+package httpio
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/frk/compare"
+)
+
+func TestCORS_AllowOrigin(t *testing.T) {
+	cors := &CORS{AllowOrigins: []string{"https://example.com", "https://*.example.org", "http://*.local:8080"}}
+
+	tests := []struct {
+		origin string
+		want   bool
+	}{
+		{"", false},
+		{"https://example.com", true},
+		{"https://EXAMPLE.com", true},
+		{"http://example.com", false},
+		{"https://www.example.com", false},
+		{"https://app.example.org", true},
+		{"https://a.b.example.org", true},
+		{"https://example.org", false},
+		{"https://.example.org", false},
+		{"https://evil.com/.example.org", false},
+		{"https://app.example.org.evil.com", false},
+		{"http://app.example.org", false},
+		{"http://dev.local:8080", true},
+		{"http://dev.local", false},
+		{"http://dev.local:9090", false},
+	}
+	for _, tt := range tests {
+		if got := cors.AllowOrigin(tt.origin); got != tt.want {
+			t.Errorf("%q: got %t, want %t", tt.origin, got, tt.want)
+		}
+	}
+
+	if !(&CORS{AllowOrigins: []string{"*"}}).AllowOrigin("https://any.com") {
+		t.Error("wildcard origin not allowed")
+	}
+}
+
+func TestCORS_Handler(t *testing.T) {
+	tests := []struct {
+		name   string
+		cors   CORS
+		origin string
+		want   http.Header
+	}{{
+		name:   "allowed origin",
+		cors:   CORS{AllowOrigins: []string{"https://example.com"}, ExposeHeaders: []string{"X-Total", "Link"}},
+		origin: "https://example.com",
+		want: http.Header{
+			"Vary":                          {"Origin"},
+			"Access-Control-Allow-Origin":   {"https://example.com"},
+			"Access-Control-Expose-Headers": {"X-Total, Link"},
+		},
+	}, {
+		name:   "disallowed origin",
+		cors:   CORS{AllowOrigins: []string{"https://example.com"}},
+		origin: "https://evil.com",
+		want:   http.Header{"Vary": {"Origin"}},
+	}, {
+		name: "no origin",
+		cors: CORS{AllowOrigins: []string{"https://example.com"}},
+		want: http.Header{"Vary": {"Origin"}},
+	}, {
+		name:   "any origin",
+		cors:   CORS{AllowOrigins: []string{"*"}},
+		origin: "https://example.com",
+		want:   http.Header{"Access-Control-Allow-Origin": {"*"}},
+	}, {
+		name:   "credentials not allowed for any origin",
+		cors:   CORS{AllowOrigins: []string{"https://example.com", "*"}, AllowCredentials: true},
+		origin: "https://evil.com",
+		want: http.Header{
+			"Vary":                        {"Origin"},
+			"Access-Control-Allow-Origin": {"*"},
+		},
+	}, {
+		name:   "credentials allowed for listed origin",
+		cors:   CORS{AllowOrigins: []string{"https://example.com", "*"}, AllowCredentials: true},
+		origin: "https://example.com",
+		want: http.Header{
+			"Vary":                             {"Origin"},
+			"Access-Control-Allow-Origin":      {"https://example.com"},
+			"Access-Control-Allow-Credentials": {"true"},
+		},
+	}}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/", nil)
+			if len(tt.origin) > 0 {
+				r.Header.Set("Origin", tt.origin)
+			}
+			w := httptest.NewRecorder()
+			tt.cors.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				http.Error(w, "unauthorized", http.StatusUnauthorized)
+			})).ServeHTTP(w, r)
+
+			if e := compare.Compare(w.Code, http.StatusUnauthorized); e != nil {
+				t.Error(e)
+			}
+			got := w.Result().Header
+			got.Del("Content-Type")
+			got.Del("X-Content-Type-Options")
+			if e := compare.Compare(got, tt.want); e != nil {
+				t.Error(e)
+			}
+		})
+	}
+}
+
+func TestCORS_ServePreflight(t *testing.T) {
+	vary := []string{"Origin", "Access-Control-Request-Method", "Access-Control-Request-Headers"}
+
+	tests := []struct {
+		name   string
+		cors   CORS
+		header map[string]string
+		want   http.Header
+	}{{
+		name: "not a preflight",
+		cors: CORS{AllowOrigins: []string{"*"}},
+		want: http.Header{"Allow": {"GET, PUT, OPTIONS"}},
+	}, {
+		name: "allowed",
+		cors: CORS{AllowOrigins: []string{"https://*.example.com"}, AllowCredentials: true, MaxAge: 10 * time.Minute},
+		header: map[string]string{
+			"Origin":                         "https://app.example.com",
+			"Access-Control-Request-Method":  "PUT",
+			"Access-Control-Request-Headers": "content-type, x-request-id",
+		},
+		want: http.Header{
+			"Vary":                             vary,
+			"Access-Control-Allow-Origin":      {"https://app.example.com"},
+			"Access-Control-Allow-Credentials": {"true"},
+			"Access-Control-Allow-Methods":     {"GET, PUT"},
+			"Access-Control-Allow-Headers":     {"Content-Type, X-Request-Id"},
+			"Access-Control-Max-Age":           {"600"},
+		},
+	}, {
+		name: "allowed headers",
+		cors: CORS{AllowOrigins: []string{"*"}, AllowMethods: []string{"GET", "DELETE"}, AllowHeaders: []string{"Content-Type"}},
+		header: map[string]string{
+			"Origin":                         "https://example.com",
+			"Access-Control-Request-Method":  "DELETE",
+			"Access-Control-Request-Headers": "content-type",
+		},
+		want: http.Header{
+			"Vary":                         vary,
+			"Access-Control-Allow-Origin":  {"*"},
+			"Access-Control-Allow-Methods": {"GET, DELETE"},
+			"Access-Control-Allow-Headers": {"Content-Type"},
+		},
+	}, {
+		name: "disallowed header",
+		cors: CORS{AllowOrigins: []string{"*"}, AllowHeaders: []string{"Content-Type"}},
+		header: map[string]string{
+			"Origin":                         "https://example.com",
+			"Access-Control-Request-Method":  "GET",
+			"Access-Control-Request-Headers": "content-type, authorization",
+		},
+		want: http.Header{"Vary": vary},
+	}, {
+		name: "disallowed method",
+		cors: CORS{AllowOrigins: []string{"*"}},
+		header: map[string]string{
+			"Origin":                        "https://example.com",
+			"Access-Control-Request-Method": "DELETE",
+		},
+		want: http.Header{"Vary": vary},
+	}, {
+		name: "disallowed origin",
+		cors: CORS{AllowOrigins: []string{"https://example.com"}},
+		header: map[string]string{
+			"Origin":                        "https://evil.com",
+			"Access-Control-Request-Method": "GET",
+		},
+		want: http.Header{"Vary": vary},
+	}}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("OPTIONS", "/", nil)
+			for k, v := range tt.header {
+				r.Header.Set(k, v)
+			}
+			w := httptest.NewRecorder()
+			tt.cors.ServePreflight(w, r, []string{"GET", "PUT"})
+
+			if e := compare.Compare(w.Code, http.StatusNoContent); e != nil {
+				t.Error(e)
+			}
+			if e := compare.Compare(w.Result().Header, tt.want); e != nil {
+				t.Error(e)
+			}
+		})
+	}
+}
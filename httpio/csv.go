@@ -0,0 +1,257 @@
+package httpio
+
+import (
+	"encoding"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// The default maximum number of row errors collected by the CSVReader.
+const defaultCSVMaxErrors = 100
+
+var textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+
+// The CSVReader type implements the BodyReader interface by streaming the rows
+// of a "text/csv" body, one at a time, into a struct and invoking a callback
+// for each of them. The columns are mapped to the struct's fields using the
+// fields' "csv" tags, the same way the CSVWriter's WriteStruct method does.
+//
+// The first row of the body must be a header row with the names of the columns.
+// A header that names a column more than once, that names a column that does
+// not match any of the struct's fields, unless IgnoreUnknown is set, or that
+// is missing one of the Required columns, is rejected before any of the rows
+// are read.
+//
+// Rows that cannot be decoded do not abort the reading, instead, the errors are
+// collected and returned, once the whole body has been read, as a CSVError.
+// Note that since the rows are streamed, Func is invoked for the valid rows
+// even if other rows are invalid, handlers that need all-or-nothing semantics
+// should, for example, run the callback in a transaction that is rolled back
+// if ReadBody fails.
+type CSVReader struct {
+	// A pointer to the struct into which each row will be decoded. The
+	// struct is reset to its zero value before each row is decoded.
+	Val interface{}
+	// The function to be invoked after a row has been successfully decoded
+	// into Val, with the row's line number. If Func returns a CSVRowError
+	// the error is collected as the row's error, any other error aborts
+	// the reading and is returned as is.
+	Func func(line int) error
+	// The field delimiter. If not set, a comma will be used.
+	Delimiter rune
+	// The list of columns that must be present in the header row.
+	Required []string
+	// If set, columns that do not match any of the struct's fields
+	// are ignored, otherwise the header row is rejected.
+	IgnoreUnknown bool
+	// The maximum number of row errors to collect, once reached the reading
+	// stops and the collected errors are returned. If not set, 100 will be used.
+	MaxErrors int
+	// If set, limits the size of the request's body to MaxBytes bytes.
+	MaxBytes int64
+}
+
+// ReadBody implements the BodyReader interface. If the request's media type
+// is not "text/csv" an UnsupportedMediaTypeError will be returned, if the
+// header row or any of the rows are invalid a CSVError will be returned.
+func (c CSVReader) ReadBody(r *http.Request) error {
+	LimitBody(nil, r, c.MaxBytes)
+
+	if mtype := requestMediaType(r); mtype != contentTypeCSV {
+		return UnsupportedMediaTypeError{MediaType: mtype, Accepted: []string{contentTypeCSV}}
+	}
+
+	rv := reflect.ValueOf(c.Val)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() || rv.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("httpcrud/httpio: CSVReader.Val must be a non-nil pointer to a struct, got %T", c.Val)
+	}
+	rv = rv.Elem()
+
+	cr := csv.NewReader(r.Body)
+	cr.FieldsPerRecord = -1
+	cr.ReuseRecord = true
+	if c.Delimiter != 0 {
+		cr.Comma = c.Delimiter
+	}
+
+	header, err := cr.Read()
+	if err == io.EOF {
+		return CSVError{Errors: []CSVRowError{{Line: 1, Message: "missing header row"}}}
+	} else if err != nil {
+		return csvReadError(err, 1)
+	}
+	header = append([]string(nil), header...) // the record is reused by the csv.Reader
+	columns, errs := c.mapColumns(rv.Type(), header)
+	if len(errs) > 0 {
+		return CSVError{Errors: errs}
+	}
+
+	maxErrors := c.MaxErrors
+	if maxErrors <= 0 {
+		maxErrors = defaultCSVMaxErrors
+	}
+
+	for line := 2; len(errs) < maxErrors; line++ {
+		record, err := cr.Read()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			var perr *csv.ParseError
+			if !errors.As(err, &perr) {
+				return ReadError{err}
+			}
+			errs = append(errs, CSVRowError{Line: line, Message: perr.Err.Error()})
+			continue
+		}
+		if len(record) != len(header) {
+			errs = append(errs, CSVRowError{Line: line, Message: fmt.Sprintf(
+				"wrong number of fields, got %d, want %d", len(record), len(header))})
+			continue
+		}
+
+		rv.Set(reflect.Zero(rv.Type()))
+		rowErrs := errs
+		for i, f := range columns {
+			if f == nil {
+				continue
+			}
+			fv, err := fieldByIndexAlloc(rv, f.index)
+			if err == nil {
+				err = setCSVValue(fv, record[i])
+			}
+			if err != nil {
+				errs = append(errs, CSVRowError{Line: line, Column: header[i], Message: err.Error()})
+			}
+		}
+		if len(errs) > len(rowErrs) || c.Func == nil {
+			continue
+		}
+
+		if err := c.Func(line); err != nil {
+			rerr, ok := err.(CSVRowError)
+			if !ok {
+				return err
+			}
+			if rerr.Line == 0 {
+				rerr.Line = line
+			}
+			errs = append(errs, rerr)
+		}
+	}
+
+	if len(errs) > 0 {
+		return CSVError{Errors: errs}
+	}
+	return nil
+}
+
+// mapColumns returns the struct field of each of the columns named in the
+// header, or nil for unknown columns if they are ignored, and the errors
+// found in the header.
+func (c CSVReader) mapColumns(t reflect.Type, header []string) (columns []*structField, errs []CSVRowError) {
+	fields := structFields(t, "csv")
+	columns = make([]*structField, len(header))
+	seen := make(map[string]bool, len(header))
+	for i, name := range header {
+		if i == 0 {
+			name = strings.TrimPrefix(name, "\xEF\xBB\xBF")
+		}
+		name = strings.TrimSpace(name)
+		header[i] = name
+
+		f, ok := findStructFieldFold(fields, name)
+		if !ok {
+			if !c.IgnoreUnknown {
+				errs = append(errs, CSVRowError{Line: 1, Column: name, Message: "unknown column"})
+			}
+			continue
+		}
+		if seen[f.name] {
+			errs = append(errs, CSVRowError{Line: 1, Column: name, Message: "duplicate column"})
+			continue
+		}
+		seen[f.name] = true
+		columns[i] = &f
+	}
+
+	for _, name := range c.Required {
+		if f, ok := findStructFieldFold(fields, name); !ok || !seen[f.name] {
+			errs = append(errs, CSVRowError{Line: 1, Column: name, Message: "missing required column"})
+		}
+	}
+
+	return columns, errs
+}
+
+// csvReadError translates the given error returned by the csv.Reader.
+func csvReadError(err error, line int) error {
+	var perr *csv.ParseError
+	if errors.As(err, &perr) {
+		return CSVError{Errors: []CSVRowError{{Line: line, Message: perr.Err.Error()}}}
+	}
+	return ReadError{err}
+}
+
+// setCSVValue decodes the given csv field value into v. An empty value
+// leaves v set to its zero value.
+func setCSVValue(v reflect.Value, s string) error {
+	if len(s) == 0 {
+		return nil
+	}
+	if v.Kind() == reflect.Ptr {
+		v.Set(reflect.New(v.Type().Elem()))
+		v = v.Elem()
+	}
+
+	if v.Type() == timeType {
+		for _, layout := range []string{time.RFC3339Nano, "2006-01-02"} {
+			if t, err := time.Parse(layout, s); err == nil {
+				v.Set(reflect.ValueOf(t))
+				return nil
+			}
+		}
+		return errors.New("invalid time")
+	}
+	if v.CanAddr() && reflect.PtrTo(v.Type()).Implements(textUnmarshalerType) {
+		return v.Addr().Interface().(encoding.TextUnmarshaler).UnmarshalText([]byte(s))
+	}
+
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(s)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return errors.New("invalid boolean")
+		}
+		v.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		i, err := strconv.ParseInt(s, 10, v.Type().Bits())
+		if err != nil {
+			return errors.New("invalid integer")
+		}
+		v.SetInt(i)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		u, err := strconv.ParseUint(s, 10, v.Type().Bits())
+		if err != nil {
+			return errors.New("invalid unsigned integer")
+		}
+		v.SetUint(u)
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(s, v.Type().Bits())
+		if err != nil {
+			return errors.New("invalid number")
+		}
+		v.SetFloat(f)
+	default:
+		return fmt.Errorf("unsupported field type %s", v.Type())
+	}
+	return nil
+}
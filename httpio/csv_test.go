@@ -0,0 +1,222 @@
+package httpio
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/frk/compare"
+)
+
+type testCSVRow struct {
+	ID      int        `csv:"id"`
+	Name    string     `csv:"name"`
+	Price   *float64   `csv:"price"`
+	Active  bool       `csv:"active"`
+	Created time.Time  `csv:"created"`
+	Tag     testCSVTag `csv:"tag"`
+}
+
+type testCSVTag string
+
+func (t *testCSVTag) UnmarshalText(text []byte) error {
+	if strings.ContainsRune(string(text), ' ') {
+		return errors.New("tag must not contain spaces")
+	}
+	*t = testCSVTag(text)
+	return nil
+}
+
+func TestCSVReader(t *testing.T) {
+	price := 9.5
+	created := time.Date(2020, 1, 2, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name    string
+		ctype   string
+		body    string
+		reader  CSVReader
+		funcErr func(row testCSVRow) error
+		want    []testCSVRow
+		lines   []int
+		err     error
+	}{{
+		name:  "valid rows",
+		ctype: "text/csv; charset=utf-8",
+		body: "\xEF\xBB\xBFid,Name,price,active,created,tag\n" +
+			"1,foo,9.5,true,2020-01-02,a\n" +
+			"2,\"bar\nbaz\",,false,2020-01-02T00:00:00Z,\n",
+		want: []testCSVRow{
+			{ID: 1, Name: "foo", Price: &price, Active: true, Created: created, Tag: "a"},
+			{ID: 2, Name: "bar\nbaz", Created: created},
+		},
+		lines: []int{2, 3},
+	}, {
+		name:   "delimiter and subset of columns",
+		ctype:  "text/csv",
+		body:   "name;id\nfoo;1\n",
+		reader: CSVReader{Delimiter: ';'},
+		want:   []testCSVRow{{ID: 1, Name: "foo"}},
+		lines:  []int{2},
+	}, {
+		name:  "unsupported media type",
+		ctype: "application/json",
+		body:  "[]",
+		err:   UnsupportedMediaTypeError{MediaType: "application/json", Accepted: []string{contentTypeCSV}},
+	}, {
+		name:  "empty body",
+		ctype: "text/csv",
+		body:  "",
+		err:   CSVError{Errors: []CSVRowError{{Line: 1, Message: "missing header row"}}},
+	}, {
+		name:   "invalid header",
+		ctype:  "text/csv",
+		body:   "id,foo,id\n1,2,3\n",
+		reader: CSVReader{Required: []string{"id", "name"}},
+		err: CSVError{Errors: []CSVRowError{
+			{Line: 1, Column: "foo", Message: "unknown column"},
+			{Line: 1, Column: "id", Message: "duplicate column"},
+			{Line: 1, Column: "name", Message: "missing required column"},
+		}},
+	}, {
+		name:   "ignore unknown columns",
+		ctype:  "text/csv",
+		body:   "id,foo\n1,2\n",
+		reader: CSVReader{IgnoreUnknown: true},
+		want:   []testCSVRow{{ID: 1}},
+		lines:  []int{2},
+	}, {
+		name:  "row errors",
+		ctype: "text/csv",
+		body: "id,price,active,created,tag\n" +
+			"x,1.5,yes,2020-01-02,a\n" +
+			"2,1.5,true,2020-01-02,a\n" +
+			"3,abc,true,01/02/2020,a b\n" +
+			"4,1.5\n" +
+			"5,1.5,true,2020-01-02,a\n",
+		want: []testCSVRow{
+			{ID: 2, Price: floatPtr(1.5), Active: true, Created: created, Tag: "a"},
+			{ID: 5, Price: floatPtr(1.5), Active: true, Created: created, Tag: "a"},
+		},
+		lines: []int{3, 6},
+		err: CSVError{Errors: []CSVRowError{
+			{Line: 2, Column: "id", Message: "invalid integer"},
+			{Line: 2, Column: "active", Message: "invalid boolean"},
+			{Line: 4, Column: "price", Message: "invalid number"},
+			{Line: 4, Column: "created", Message: "invalid time"},
+			{Line: 4, Column: "tag", Message: "tag must not contain spaces"},
+			{Line: 5, Message: "wrong number of fields, got 2, want 5"},
+		}},
+	}, {
+		name:   "max errors",
+		ctype:  "text/csv",
+		body:   "id\nx\ny\n3\n",
+		reader: CSVReader{MaxErrors: 1},
+		err:    CSVError{Errors: []CSVRowError{{Line: 2, Column: "id", Message: "invalid integer"}}},
+	}, {
+		name:  "callback row error",
+		ctype: "text/csv",
+		body:  "id,name\n1,foo\n2,\n",
+		funcErr: func(row testCSVRow) error {
+			if len(row.Name) == 0 {
+				return CSVRowError{Column: "name", Message: "required"}
+			}
+			return nil
+		},
+		want:  []testCSVRow{{ID: 1, Name: "foo"}, {ID: 2}},
+		lines: []int{2, 3},
+		err:   CSVError{Errors: []CSVRowError{{Line: 3, Column: "name", Message: "required"}}},
+	}, {
+		name:  "callback abort",
+		ctype: "text/csv",
+		body:  "id\n1\n2\n",
+		funcErr: func(row testCSVRow) error {
+			return errTestCSVAbort
+		},
+		want:  []testCSVRow{{ID: 1}},
+		lines: []int{2},
+		err:   errTestCSVAbort,
+	}}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("POST", "/", strings.NewReader(tt.body))
+			r.Header.Set("Content-Type", tt.ctype)
+
+			var row testCSVRow
+			var got []testCSVRow
+			var lines []int
+			tt.reader.Val = &row
+			tt.reader.Func = func(line int) error {
+				got, lines = append(got, row), append(lines, line)
+				if tt.funcErr != nil {
+					return tt.funcErr(row)
+				}
+				return nil
+			}
+
+			err := tt.reader.ReadBody(r)
+			if e := compare.Compare(err, tt.err); e != nil {
+				t.Error(e)
+			}
+			if e := compare.Compare(got, tt.want); e != nil {
+				t.Error(e)
+			}
+			if e := compare.Compare(lines, tt.lines); e != nil {
+				t.Error(e)
+			}
+		})
+	}
+}
+
+func TestCSVError(t *testing.T) {
+	err := CSVError{Errors: []CSVRowError{
+		{Line: 2, Column: "id", Message: "invalid integer"},
+		{Line: 3, Message: "wrong number of fields"},
+	}}
+	want := `httpcrud/httpio: invalid csv: line 2, column "id": invalid integer (and 1 more errors)`
+	if e := compare.Compare(err.Error(), want); e != nil {
+		t.Error(e)
+	}
+	if e := compare.Compare(err.StatusCode(), http.StatusUnprocessableEntity); e != nil {
+		t.Error(e)
+	}
+}
+
+func TestCSVError_Empty(t *testing.T) {
+	want := "httpcrud/httpio: invalid csv"
+	if e := compare.Compare(CSVError{}.Error(), want); e != nil {
+		t.Error(e)
+	}
+}
+
+type testCSVInner struct {
+	A int `csv:"a"`
+}
+
+type testCSVEmbedded struct {
+	*testCSVInner
+	X int `csv:"x"`
+}
+
+func TestCSVReader_UnexportedEmbedded(t *testing.T) {
+	r := httptest.NewRequest("POST", "/", strings.NewReader("a,x\n1,2\n"))
+	r.Header.Set("Content-Type", "text/csv")
+
+	var row testCSVEmbedded
+	err := CSVReader{Val: &row}.ReadBody(r)
+	want := CSVError{Errors: []CSVRowError{{Line: 2, Column: "a",
+		Message: "cannot set embedded pointer to unexported struct httpio.testCSVInner"}}}
+	if e := compare.Compare(err, want); e != nil {
+		t.Error(e)
+	}
+}
+
+var errTestCSVAbort = errors.New("abort")
+
+func floatPtr(f float64) *float64 {
+	return &f
+}
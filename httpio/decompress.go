@@ -0,0 +1,106 @@
+package httpio
+
+import (
+	"bufio"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// The default limit of the size of a decompressed request body.
+const defaultMaxDecompressedBytes = 10 << 20
+
+// The Decompress type implements the BodyReader interface by decompressing
+// the request's body according to its Content-Encoding header before passing
+// the request on to the wrapped BodyReader. The supported encodings are "gzip"
+// and "deflate", the latter being accepted in both the zlib and the raw format.
+//
+// To protect against decompression bombs the size of the decompressed body
+// is limited, exceeding the limit will result in a PayloadTooLargeError.
+type Decompress struct {
+	// The BodyReader to read the decompressed body.
+	Body BodyReader
+	// The limit of the size of the decompressed body in bytes.
+	// If not set, a limit of 10MB will be used.
+	MaxBytes int64
+}
+
+// ReadBody implements the BodyReader interface. If the request's body is encoded
+// with an unsupported encoding an UnsupportedEncodingError will be returned.
+func (d Decompress) ReadBody(r *http.Request) error {
+	if err := decompressBody(r, d.MaxBytes); err != nil {
+		return err
+	}
+	return d.Body.ReadBody(r)
+}
+
+// decompressBody replaces the request's body with a reader that decompresses
+// it according to the request's Content-Encoding header.
+func decompressBody(r *http.Request, maxBytes int64) error {
+	var codings []string
+	for _, v := range r.Header["Content-Encoding"] {
+		for _, c := range strings.Split(v, ",") {
+			if c = strings.ToLower(strings.TrimSpace(c)); len(c) > 0 && c != "identity" {
+				codings = append(codings, c)
+			}
+		}
+	}
+	if len(codings) == 0 || r.Body == nil {
+		return nil
+	}
+	for _, c := range codings {
+		switch c {
+		case "gzip", "x-gzip", "deflate":
+		default:
+			return UnsupportedEncodingError{Encoding: c, Accepted: []string{"gzip", "deflate"}}
+		}
+	}
+
+	var body io.Reader = r.Body
+	for i := len(codings) - 1; i >= 0; i-- {
+		var err error
+		if codings[i] == "deflate" {
+			body, err = newDeflateReader(body)
+		} else {
+			body, err = gzip.NewReader(body)
+		}
+		if err != nil {
+			return ReadError{err}
+		}
+	}
+
+	if maxBytes <= 0 {
+		maxBytes = defaultMaxDecompressedBytes
+	}
+	r.Body = decompressedBody{body, r.Body}
+	r.ContentLength = -1
+	r.Header.Del("Content-Encoding")
+	r.Header.Del("Content-Length")
+	LimitBody(nil, r, maxBytes)
+	return nil
+}
+
+// newDeflateReader returns a reader that decompresses the "deflate" encoded
+// data from r. Since some clients send raw deflate data instead of the zlib
+// format mandated by RFC 7230 both are accepted.
+func newDeflateReader(r io.Reader) (io.Reader, error) {
+	br := bufio.NewReader(r)
+	if h, err := br.Peek(2); err == nil && h[0]&0x0f == 8 && (uint16(h[0])<<8|uint16(h[1]))%31 == 0 {
+		return zlib.NewReader(br)
+	}
+	return flate.NewReader(br), nil
+}
+
+// decompressedBody reads the decompressed data and
+// closes the original request body.
+type decompressedBody struct {
+	io.Reader
+	body io.Closer
+}
+
+func (b decompressedBody) Close() error {
+	return b.body.Close()
+}
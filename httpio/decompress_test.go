@@ -0,0 +1,132 @@
+package httpio
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/frk/compare"
+)
+
+func compressTestData(t *testing.T, data string, codings ...string) []byte {
+	b := []byte(data)
+	for _, c := range codings {
+		var buf bytes.Buffer
+		var w io.WriteCloser
+		switch c {
+		case "gzip":
+			w = gzip.NewWriter(&buf)
+		case "deflate":
+			w = zlib.NewWriter(&buf)
+		case "raw-deflate":
+			w, _ = flate.NewWriter(&buf, flate.DefaultCompression)
+		}
+		if _, err := w.Write(b); err != nil {
+			t.Fatal(err)
+		}
+		if err := w.Close(); err != nil {
+			t.Fatal(err)
+		}
+		b = buf.Bytes()
+	}
+	return b
+}
+
+func TestDecompress_ReadBody(t *testing.T) {
+	body := `{"foo":"test","bar":0.004,"baz":true}`
+
+	tests := []struct {
+		name     string
+		encoding string
+		data     []byte
+		maxBytes int64
+		want     *testBody
+		err      error
+	}{{
+		name: "should pass through uncompressed body",
+		data: []byte(body),
+		want: &testBody{Foo: "test", Bar: 0.004, Baz: true},
+	}, {
+		name:     "should decompress gzip body",
+		encoding: "gzip",
+		data:     compressTestData(t, body, "gzip"),
+		want:     &testBody{Foo: "test", Bar: 0.004, Baz: true},
+	}, {
+		name:     "should decompress zlib deflate body",
+		encoding: "deflate",
+		data:     compressTestData(t, body, "deflate"),
+		want:     &testBody{Foo: "test", Bar: 0.004, Baz: true},
+	}, {
+		name:     "should decompress raw deflate body",
+		encoding: "deflate",
+		data:     compressTestData(t, body, "raw-deflate"),
+		want:     &testBody{Foo: "test", Bar: 0.004, Baz: true},
+	}, {
+		name:     "should decompress multiple codings",
+		encoding: "deflate, gzip",
+		data:     compressTestData(t, body, "deflate", "gzip"),
+		want:     &testBody{Foo: "test", Bar: 0.004, Baz: true},
+	}, {
+		name:     "should fail with unsupported encoding",
+		encoding: "br",
+		data:     []byte(body),
+		want:     &testBody{},
+		err:      UnsupportedEncodingError{Encoding: "br", Accepted: []string{"gzip", "deflate"}},
+	}, {
+		name:     "should fail when decompressed body exceeds limit",
+		encoding: "gzip",
+		data:     compressTestData(t, `{"foo":"`+strings.Repeat("x", 1000)+`"}`, "gzip"),
+		maxBytes: 100,
+		want:     &testBody{},
+		err:      PayloadTooLargeError{Limit: 100},
+	}}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, err := http.NewRequest("POST", "/", bytes.NewReader(tt.data))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(tt.encoding) > 0 {
+				r.Header.Set("Content-Encoding", tt.encoding)
+			}
+
+			val := &testBody{}
+			err = Decompress{Body: JSON{Val: val}, MaxBytes: tt.maxBytes}.ReadBody(r)
+
+			var perr PayloadTooLargeError
+			if errors.As(err, &perr) {
+				err = perr
+			}
+			if e := compare.Compare(err, tt.err); e != nil {
+				t.Error(e)
+			}
+			if e := compare.Compare(val, tt.want); e != nil {
+				t.Error(e)
+			}
+		})
+	}
+}
+
+func TestRequestReader_Decompress(t *testing.T) {
+	r, err := http.NewRequest("POST", "/", bytes.NewReader(compressTestData(t, `{"foo":"test"}`, "gzip")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.Header.Set("Content-Encoding", "gzip")
+
+	val := &testBody{}
+	rr := RequestReader{Body: JSON{Val: val}, Decompress: true}
+	if err := rr.ReadRequest(r, r.Context()); err != nil {
+		t.Fatal(err)
+	}
+	if e := compare.Compare(val, &testBody{Foo: "test"}); e != nil {
+		t.Error(e)
+	}
+}
@@ -1,7 +1,10 @@
 package httpio
 
 import (
+	"errors"
 	"fmt"
+	"net/http"
+	"strings"
 )
 
 // WriteError represents an error returned by a BodyWriter.
@@ -14,6 +17,11 @@ func (e WriteError) Error() string {
 	return e.Err.Error()
 }
 
+// Unwrap returns the original error.
+func (e WriteError) Unwrap() error {
+	return e.Err
+}
+
 // ReadError represents an error returned by a BodyReader.
 type ReadError struct {
 	// The original error.
@@ -24,6 +32,11 @@ func (e ReadError) Error() string {
 	return e.Err.Error()
 }
 
+// Unwrap returns the original error.
+func (e ReadError) Unwrap() error {
+	return e.Err
+}
+
 // NoTemplateError is returned when no template with the given name was registered.
 type NoTemplateError struct {
 	// The provided template name.
@@ -33,3 +46,286 @@ type NoTemplateError struct {
 func (e NoTemplateError) Error() string {
 	return fmt.Sprintf("httpcrud/httpio: template %q not found", e.Name)
 }
+
+// NoCodecError is returned by the Body BodyWriter when
+// no Codec was registered for the media type of its Type.
+type NoCodecError struct {
+	// The provided media type.
+	MediaType string
+}
+
+func (e NoCodecError) Error() string {
+	return fmt.Sprintf("httpcrud/httpio: no codec registered for %q", e.MediaType)
+}
+
+// StatusCode returns http.StatusInternalServerError.
+func (NoCodecError) StatusCode() int {
+	return http.StatusInternalServerError
+}
+
+// CursorError is returned by the Cursor QueryReader when the cursor
+// query parameter is malformed or its signature cannot be verified.
+type CursorError struct {
+	// The cursor as provided by the client.
+	Cursor string
+}
+
+func (e CursorError) Error() string {
+	return "httpcrud/httpio: invalid cursor"
+}
+
+// StatusCode returns http.StatusBadRequest.
+func (CursorError) StatusCode() int {
+	return http.StatusBadRequest
+}
+
+// QueryError is returned by QueryReaders when a query parameter
+// refers to a field or an operator that is not allowed.
+type QueryError struct {
+	// The name of the offending query parameter.
+	Param string
+	// The field referenced by the query parameter, if any.
+	Field string
+	// The operator referenced by the query parameter, if any.
+	Op string
+	// The description of the problem.
+	Reason string
+}
+
+func (e QueryError) Error() string {
+	return fmt.Sprintf("httpcrud/httpio: invalid query parameter %q: %s", e.Param, e.Reason)
+}
+
+// StatusCode returns http.StatusBadRequest.
+func (QueryError) StatusCode() int {
+	return http.StatusBadRequest
+}
+
+// FieldsetError is returned by SparseJSON when the requested
+// fieldset contains a field that does not exist.
+type FieldsetError struct {
+	// The dot-delimited path of the unknown field.
+	Field string
+}
+
+func (e FieldsetError) Error() string {
+	return fmt.Sprintf("httpcrud/httpio: unknown field %q in fieldset", e.Field)
+}
+
+// StatusCode returns http.StatusBadRequest.
+func (FieldsetError) StatusCode() int {
+	return http.StatusBadRequest
+}
+
+// UnsupportedMediaTypeError is returned by BodyReaders when
+// the media type of the request's body is not supported.
+type UnsupportedMediaTypeError struct {
+	// The media type of the request's body.
+	MediaType string
+	// The list of supported media types.
+	Accepted []string
+}
+
+func (e UnsupportedMediaTypeError) Error() string {
+	return fmt.Sprintf("httpcrud/httpio: unsupported media type %q, expected one of: %s",
+		e.MediaType, strings.Join(e.Accepted, ", "))
+}
+
+// StatusCode returns http.StatusUnsupportedMediaType.
+func (UnsupportedMediaTypeError) StatusCode() int {
+	return http.StatusUnsupportedMediaType
+}
+
+// NotAcceptableError is returned by BodyWriters when none of the
+// available media types is acceptable to the client.
+type NotAcceptableError struct {
+	// The value of the request's Accept header.
+	Accept string
+	// The list of available media types.
+	Available []string
+}
+
+func (e NotAcceptableError) Error() string {
+	return fmt.Sprintf("httpcrud/httpio: not acceptable %q, available media types: %s",
+		e.Accept, strings.Join(e.Available, ", "))
+}
+
+// StatusCode returns http.StatusNotAcceptable.
+func (NotAcceptableError) StatusCode() int {
+	return http.StatusNotAcceptable
+}
+
+// JSONError is returned by the JSON BodyReader when the request's body
+// could not be decoded, it reports where in the body the failure occurred.
+type JSONError struct {
+	// The path to the offending value, e.g. "items[2].name". The path
+	// is empty if the failure occurred at the top-level value.
+	Path string
+	// The byte offset into the body at which the failure occurred.
+	Offset int64
+	// The original error.
+	Err error
+}
+
+func (e JSONError) Error() string {
+	if len(e.Path) == 0 {
+		return fmt.Sprintf("httpcrud/httpio: invalid json at offset %d: %v", e.Offset, e.Err)
+	}
+	return fmt.Sprintf("httpcrud/httpio: invalid json at %s (offset %d): %v", e.Path, e.Offset, e.Err)
+}
+
+// Unwrap returns the original error.
+func (e JSONError) Unwrap() error {
+	return e.Err
+}
+
+// StatusCode returns http.StatusBadRequest.
+func (JSONError) StatusCode() int {
+	return http.StatusBadRequest
+}
+
+// PayloadTooLargeError is returned by BodyReaders when the size
+// of the request's body exceeds the configured limit.
+type PayloadTooLargeError struct {
+	// The limit in bytes.
+	Limit int64
+}
+
+func (e PayloadTooLargeError) Error() string {
+	return fmt.Sprintf("httpcrud/httpio: request body exceeds the limit of %d bytes", e.Limit)
+}
+
+// StatusCode returns http.StatusRequestEntityTooLarge.
+func (PayloadTooLargeError) StatusCode() int {
+	return http.StatusRequestEntityTooLarge
+}
+
+// FileTooLargeError is returned by the Multipart BodyReader when
+// the size of an uploaded file exceeds the configured limit.
+type FileTooLargeError struct {
+	// The name of the form field.
+	Field string
+	// The name of the file as sent by the client.
+	Filename string
+	// The limit in bytes.
+	Limit int64
+}
+
+func (e FileTooLargeError) Error() string {
+	return fmt.Sprintf("httpcrud/httpio: file %q exceeds the limit of %d bytes", e.Filename, e.Limit)
+}
+
+// StatusCode returns http.StatusRequestEntityTooLarge.
+func (FileTooLargeError) StatusCode() int {
+	return http.StatusRequestEntityTooLarge
+}
+
+// UnsupportedEncodingError is returned by the Decompress BodyReader when
+// the request's body is encoded with an unsupported content coding.
+type UnsupportedEncodingError struct {
+	// The content coding of the request's body.
+	Encoding string
+	// The list of supported content codings.
+	Accepted []string
+}
+
+func (e UnsupportedEncodingError) Error() string {
+	return fmt.Sprintf("httpcrud/httpio: unsupported content encoding %q, expected one of: %s",
+		e.Encoding, strings.Join(e.Accepted, ", "))
+}
+
+// StatusCode returns http.StatusUnsupportedMediaType.
+func (UnsupportedEncodingError) StatusCode() int {
+	return http.StatusUnsupportedMediaType
+}
+
+// PreconditionFailedError is returned by the CheckIfMatch and CheckIfUnmodifiedSince
+// functions when the request's precondition evaluates to false.
+type PreconditionFailedError struct {
+	// The name of the header whose precondition failed.
+	Header string
+}
+
+func (e PreconditionFailedError) Error() string {
+	return fmt.Sprintf("httpcrud/httpio: %s precondition failed", e.Header)
+}
+
+// StatusCode returns http.StatusPreconditionFailed.
+func (PreconditionFailedError) StatusCode() int {
+	return http.StatusPreconditionFailed
+}
+
+// PatchError is returned when a JSON Patch document contains an invalid
+// operation or when one of its operations cannot be applied.
+type PatchError struct {
+	// The index of the operation in the document.
+	Index int
+	// The operation.
+	Op string
+	// The target location of the operation.
+	Path string
+	// The description of the problem.
+	Reason string
+	// The error that caused the operation to fail, if any.
+	Err error
+}
+
+func (e PatchError) Error() string {
+	return fmt.Sprintf("httpcrud/httpio: patch operation %d (%s %q): %s", e.Index, e.Op, e.Path, e.Reason)
+}
+
+// Unwrap returns the error that caused the operation to fail.
+func (e PatchError) Unwrap() error {
+	return e.Err
+}
+
+// StatusCode returns http.StatusConflict if a "test" operation failed,
+// otherwise it returns http.StatusUnprocessableEntity.
+func (e PatchError) StatusCode() int {
+	if errors.Is(e.Err, errPatchTestFailed) {
+		return http.StatusConflict
+	}
+	return http.StatusUnprocessableEntity
+}
+
+// CSVRowError describes a problem with a single row of a csv body.
+type CSVRowError struct {
+	// The line number of the row, counting the header row as line 1. Rows
+	// with quoted fields that span multiple lines are counted as a single
+	// line, the same way spreadsheet applications number their rows.
+	Line int
+	// The name of the offending column, if any.
+	Column string
+	// The description of the problem.
+	Message string
+}
+
+func (e CSVRowError) Error() string {
+	if len(e.Column) == 0 {
+		return fmt.Sprintf("line %d: %s", e.Line, e.Message)
+	}
+	return fmt.Sprintf("line %d, column %q: %s", e.Line, e.Column, e.Message)
+}
+
+// CSVError is returned by the CSVReader when the
+// header row or any of the rows are invalid.
+type CSVError struct {
+	// The errors of the invalid rows in the order they were read.
+	Errors []CSVRowError
+}
+
+func (e CSVError) Error() string {
+	if len(e.Errors) == 0 {
+		return "httpcrud/httpio: invalid csv"
+	}
+	msg := fmt.Sprintf("httpcrud/httpio: invalid csv: %v", e.Errors[0])
+	if n := len(e.Errors) - 1; n > 0 {
+		msg += fmt.Sprintf(" (and %d more errors)", n)
+	}
+	return msg
+}
+
+// StatusCode returns http.StatusUnprocessableEntity.
+func (CSVError) StatusCode() int {
+	return http.StatusUnprocessableEntity
+}
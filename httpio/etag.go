@@ -0,0 +1,292 @@
+package httpio
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// ETag represents an entity tag as defined by RFC 7232.
+type ETag struct {
+	// The opaque value of the tag, without the quotes.
+	Value string
+	// Indicates whether the tag is a weak validator.
+	Weak bool
+}
+
+// String returns the tag formatted as the value of an ETag header,
+// e.g. "xyz" or W/"xyz".
+func (t ETag) String() string {
+	if t.Weak {
+		return `W/"` + t.Value + `"`
+	}
+	return `"` + t.Value + `"`
+}
+
+// StrongMatch reports whether the two tags match using
+// the strong comparison function of RFC 7232.
+func (t ETag) StrongMatch(u ETag) bool {
+	return !t.Weak && !u.Weak && t.Value == u.Value
+}
+
+// WeakMatch reports whether the two tags match using
+// the weak comparison function of RFC 7232.
+func (t ETag) WeakMatch(u ETag) bool {
+	return t.Value == u.Value
+}
+
+// ETagList represents the parsed value of an If-Match or If-None-Match header.
+// The zero value represents an absent header.
+type ETagList struct {
+	// Set if the header's value is "*".
+	Any bool
+	// The list of entity tags.
+	Tags []ETag
+}
+
+// IsEmpty reports whether the list represents an absent header.
+func (l ETagList) IsEmpty() bool {
+	return !l.Any && len(l.Tags) == 0
+}
+
+// StrongMatch reports whether any of the list's tags matches the given
+// tag using the strong comparison function. A "*" list matches any tag
+// that is not empty.
+func (l ETagList) StrongMatch(t ETag) bool {
+	if l.Any {
+		return len(t.Value) > 0
+	}
+	for _, u := range l.Tags {
+		if u.StrongMatch(t) {
+			return true
+		}
+	}
+	return false
+}
+
+// WeakMatch reports whether any of the list's tags matches the given
+// tag using the weak comparison function. A "*" list matches any tag
+// that is not empty.
+func (l ETagList) WeakMatch(t ETag) bool {
+	if l.Any {
+		return len(t.Value) > 0
+	}
+	for _, u := range l.Tags {
+		if u.WeakMatch(t) {
+			return true
+		}
+	}
+	return false
+}
+
+// ParseETag parses the given ETag header value. The returned bool
+// will be false if the value is not a valid entity tag.
+func ParseETag(s string) (ETag, bool) {
+	t, rest, ok := scanETag(strings.TrimSpace(s))
+	return t, ok && len(rest) == 0
+}
+
+// parseETagList parses the given If-Match or If-None-Match header value.
+// Malformed entity tags, and anything after them, are ignored.
+func parseETagList(s string) (l ETagList) {
+	s = strings.TrimSpace(s)
+	if s == "*" {
+		return ETagList{Any: true}
+	}
+	for len(s) > 0 {
+		t, rest, ok := scanETag(s)
+		if !ok {
+			break
+		}
+		l.Tags = append(l.Tags, t)
+		s = strings.TrimLeft(rest, " \t,")
+	}
+	return l
+}
+
+// scanETag scans the entity tag at the start of s and returns it
+// together with the remainder of s.
+func scanETag(s string) (t ETag, rest string, ok bool) {
+	if strings.HasPrefix(s, "W/") {
+		t.Weak, s = true, s[2:]
+	}
+	if len(s) < 2 || s[0] != '"' {
+		return ETag{}, "", false
+	}
+	for i := 1; i < len(s); i++ {
+		switch c := s[i]; {
+		case c == '"':
+			t.Value = s[1:i]
+			return t, s[i+1:], true
+		case c == 0x21 || (c >= 0x23 && c != 0x7f):
+			// etagc
+		default:
+			return ETag{}, "", false
+		}
+	}
+	return ETag{}, "", false
+}
+
+// IfMatch implements the HeaderReader interface by reading
+// and parsing the value of the If-Match header.
+type IfMatch struct {
+	// The pointer to which to set the parsed header.
+	Val *ETagList
+}
+
+// ReadHeader implements the HeaderReader interface.
+func (rr IfMatch) ReadHeader(header http.Header) error {
+	*rr.Val = parseETagList(strings.Join(header["If-Match"], ","))
+	return nil
+}
+
+// IfNoneMatch implements the HeaderReader interface by reading
+// and parsing the value of the If-None-Match header.
+type IfNoneMatch struct {
+	// The pointer to which to set the parsed header.
+	Val *ETagList
+}
+
+// ReadHeader implements the HeaderReader interface.
+func (rr IfNoneMatch) ReadHeader(header http.Header) error {
+	*rr.Val = parseETagList(strings.Join(header["If-None-Match"], ","))
+	return nil
+}
+
+// IfModifiedSince implements the HeaderReader interface by reading and parsing
+// the value of the If-Modified-Since header. An invalid date is ignored, as
+// required by RFC 7232, leaving the time unchanged.
+type IfModifiedSince struct {
+	// The pointer to which to set the parsed header.
+	Val *time.Time
+}
+
+// ReadHeader implements the HeaderReader interface.
+func (rr IfModifiedSince) ReadHeader(header http.Header) error {
+	if t, err := http.ParseTime(header.Get("If-Modified-Since")); err == nil {
+		*rr.Val = t
+	}
+	return nil
+}
+
+// IfUnmodifiedSince implements the HeaderReader interface by reading and parsing
+// the value of the If-Unmodified-Since header. An invalid date is ignored, as
+// required by RFC 7232, leaving the time unchanged.
+type IfUnmodifiedSince struct {
+	// The pointer to which to set the parsed header.
+	Val *time.Time
+}
+
+// ReadHeader implements the HeaderReader interface.
+func (rr IfUnmodifiedSince) ReadHeader(header http.Header) error {
+	if t, err := http.ParseTime(header.Get("If-Unmodified-Since")); err == nil {
+		*rr.Val = t
+	}
+	return nil
+}
+
+// CheckIfMatch evaluates the If-Match precondition against the current
+// ETag of the target resource, where an empty ETag indicates that the
+// resource does not exist. It returns a PreconditionFailedError if the
+// header was sent and none of its tags matches the current ETag. It is
+// intended to be used in the Action's Validate method of handlers that
+// modify a resource, to implement optimistic concurrency control.
+func CheckIfMatch(ifMatch ETagList, current ETag) error {
+	if !ifMatch.IsEmpty() && !ifMatch.StrongMatch(current) {
+		return PreconditionFailedError{Header: "If-Match"}
+	}
+	return nil
+}
+
+// CheckIfUnmodifiedSince evaluates the If-Unmodified-Since precondition
+// against the modification time of the target resource. It returns
+// a PreconditionFailedError if the header was sent and the resource
+// has been modified since the header's date.
+func CheckIfUnmodifiedSince(ifUnmodifiedSince, modTime time.Time) error {
+	if !ifUnmodifiedSince.IsZero() && modTime.Truncate(time.Second).After(ifUnmodifiedSince) {
+		return PreconditionFailedError{Header: "If-Unmodified-Since"}
+	}
+	return nil
+}
+
+// ETagMode specifies whether, and what kind of, ETag the
+// ResponseWriter should compute from the response body.
+type ETagMode int
+
+const (
+	// No ETag is computed.
+	NoETag ETagMode = iota
+	// A strong ETag is computed.
+	StrongETag
+	// A weak ETag is computed.
+	WeakETag
+)
+
+// computeETag returns an ETag computed from the given body.
+func computeETag(body []byte, mode ETagMode) ETag {
+	sum := sha256.Sum256(body)
+	return ETag{Value: base64.RawURLEncoding.EncodeToString(sum[:16]), Weak: mode == WeakETag}
+}
+
+// notModified reports whether the response with the given header should
+// be answered with 304 (Not Modified) based on the request's If-None-Match
+// header or, if absent, its If-Modified-Since header.
+func notModified(r *http.Request, header http.Header) bool {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		return false
+	}
+	if inm := parseETagList(strings.Join(r.Header["If-None-Match"], ",")); !inm.IsEmpty() {
+		etag, ok := ParseETag(header.Get("ETag"))
+		return ok && inm.WeakMatch(etag)
+	}
+	ims, err := http.ParseTime(r.Header.Get("If-Modified-Since"))
+	if err != nil {
+		return false
+	}
+	lm, err := http.ParseTime(header.Get("Last-Modified"))
+	return err == nil && !lm.After(ims)
+}
+
+// bufferedResponse implements the http.ResponseWriter interface by
+// buffering the status code and body written to it. Its header is the
+// header of the underlying http.ResponseWriter.
+type bufferedResponse struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+func (b *bufferedResponse) Header() http.Header {
+	return b.header
+}
+
+func (b *bufferedResponse) WriteHeader(statusCode int) {
+	if b.status == 0 {
+		b.status = statusCode
+	}
+}
+
+func (b *bufferedResponse) Write(p []byte) (int, error) {
+	if b.status == 0 {
+		b.status = http.StatusOK
+	}
+	return b.body.Write(p)
+}
+
+// WriteInit is a noop, required only to satisfy the BodyWriter interface.
+func (b *bufferedResponse) WriteInit(_ http.ResponseWriter) error {
+	return nil
+}
+
+// WriteBody implements the BodyWriter interface by writing
+// the buffered status code and body to the given writer.
+func (b *bufferedResponse) WriteBody(w http.ResponseWriter, _ *http.Request, _ int) error {
+	w.WriteHeader(b.status)
+	if _, err := w.Write(b.body.Bytes()); err != nil {
+		return WriteError{err}
+	}
+	return nil
+}
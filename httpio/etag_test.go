@@ -0,0 +1,287 @@
+package httpio
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/frk/compare"
+)
+
+func TestParseETagList(t *testing.T) {
+	tests := []struct {
+		header string
+		want   ETagList
+	}{
+		{``, ETagList{}},
+		{`*`, ETagList{Any: true}},
+		{`"abc"`, ETagList{Tags: []ETag{{Value: "abc"}}}},
+		{`W/"abc", "d,e" ,"" `, ETagList{Tags: []ETag{{Value: "abc", Weak: true}, {Value: "d,e"}, {Value: ""}}}},
+		{`"abc", xyz, "def"`, ETagList{Tags: []ETag{{Value: "abc"}}}},
+		{`abc`, ETagList{}},
+		{`"abc`, ETagList{}},
+	}
+	for _, tt := range tests {
+		got := parseETagList(tt.header)
+		if e := compare.Compare(got, tt.want); e != nil {
+			t.Errorf("%q: %v", tt.header, e)
+		}
+	}
+}
+
+func TestETag(t *testing.T) {
+	strong, weak := ETag{Value: "1"}, ETag{Value: "1", Weak: true}
+
+	if e := compare.Compare([]string{strong.String(), weak.String()}, []string{`"1"`, `W/"1"`}); e != nil {
+		t.Error(e)
+	}
+	if !strong.StrongMatch(strong) || strong.StrongMatch(weak) || weak.StrongMatch(weak) {
+		t.Error("unexpected StrongMatch result")
+	}
+	if !strong.WeakMatch(weak) || strong.WeakMatch(ETag{Value: "2"}) {
+		t.Error("unexpected WeakMatch result")
+	}
+	if tag, ok := ParseETag(` W/"x" `); !ok || tag != (ETag{Value: "x", Weak: true}) {
+		t.Errorf("got %v, %t", tag, ok)
+	}
+	if _, ok := ParseETag(`"x" "y"`); ok {
+		t.Error("got ok for invalid ETag")
+	}
+}
+
+func TestConditionalHeaderReaders(t *testing.T) {
+	header := http.Header{
+		"If-Match":            {`"a"`, `"b"`},
+		"If-None-Match":       {`*`},
+		"If-Modified-Since":   {"Thu, 02 Jan 2020 03:04:05 GMT"},
+		"If-Unmodified-Since": {"not a date"},
+	}
+
+	var im, inm ETagList
+	var ims, ius time.Time
+	list := HeaderReaderList{IfMatch{&im}, IfNoneMatch{&inm}, IfModifiedSince{&ims}, IfUnmodifiedSince{&ius}}
+	if err := list.ReadHeader(header); err != nil {
+		t.Fatal(err)
+	}
+
+	if e := compare.Compare(im, ETagList{Tags: []ETag{{Value: "a"}, {Value: "b"}}}); e != nil {
+		t.Error(e)
+	}
+	if e := compare.Compare(inm, ETagList{Any: true}); e != nil {
+		t.Error(e)
+	}
+	if !ims.Equal(time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)) {
+		t.Errorf("got If-Modified-Since %v", ims)
+	}
+	if !ius.IsZero() {
+		t.Errorf("got If-Unmodified-Since %v, want zero time", ius)
+	}
+}
+
+func TestCheckIfMatch(t *testing.T) {
+	tests := []struct {
+		list    ETagList
+		current ETag
+		err     error
+	}{
+		{ETagList{}, ETag{Value: "1"}, nil},
+		{ETagList{Tags: []ETag{{Value: "1"}}}, ETag{Value: "1"}, nil},
+		{ETagList{Tags: []ETag{{Value: "0"}, {Value: "1"}}}, ETag{Value: "1"}, nil},
+		{ETagList{Tags: []ETag{{Value: "0"}}}, ETag{Value: "1"}, PreconditionFailedError{Header: "If-Match"}},
+		{ETagList{Tags: []ETag{{Value: "1", Weak: true}}}, ETag{Value: "1"}, PreconditionFailedError{Header: "If-Match"}},
+		{ETagList{Any: true}, ETag{Value: "1"}, nil},
+		{ETagList{Any: true}, ETag{}, PreconditionFailedError{Header: "If-Match"}},
+	}
+	for i, tt := range tests {
+		if e := compare.Compare(CheckIfMatch(tt.list, tt.current), tt.err); e != nil {
+			t.Errorf("#%d: %v", i, e)
+		}
+	}
+
+	err := PreconditionFailedError{Header: "If-Match"}
+	if e := compare.Compare(err.StatusCode(), http.StatusPreconditionFailed); e != nil {
+		t.Error(e)
+	}
+}
+
+func TestCheckIfUnmodifiedSince(t *testing.T) {
+	since := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	if err := CheckIfUnmodifiedSince(time.Time{}, since.Add(time.Hour)); err != nil {
+		t.Error(err)
+	}
+	if err := CheckIfUnmodifiedSince(since, since.Add(500*time.Millisecond)); err != nil {
+		t.Error(err)
+	}
+	want := PreconditionFailedError{Header: "If-Unmodified-Since"}
+	if e := compare.Compare(CheckIfUnmodifiedSince(since, since.Add(time.Second)), want); e != nil {
+		t.Error(e)
+	}
+}
+
+func TestResponseWriter_ETag(t *testing.T) {
+	val := map[string]string{"foo": "bar"}
+	etag := computeETag([]byte("{\"foo\":\"bar\"}\n"), StrongETag)
+
+	tests := []struct {
+		name    string
+		method  string
+		mode    ETagMode
+		status  int
+		header  map[string]string
+		body    BodyWriter
+		code    int
+		want    string
+		wantTag string
+	}{{
+		name:    "strong etag",
+		mode:    StrongETag,
+		code:    200,
+		want:    "{\"foo\":\"bar\"}\n",
+		wantTag: etag.String(),
+	}, {
+		name:    "weak etag",
+		mode:    WeakETag,
+		code:    200,
+		want:    "{\"foo\":\"bar\"}\n",
+		wantTag: `W/` + etag.String(),
+	}, {
+		name:    "if-none-match matches",
+		mode:    StrongETag,
+		header:  map[string]string{"If-None-Match": `"x", W/` + etag.String()},
+		code:    304,
+		wantTag: etag.String(),
+	}, {
+		name:    "if-none-match matches head",
+		method:  "HEAD",
+		mode:    WeakETag,
+		header:  map[string]string{"If-None-Match": etag.String()},
+		code:    304,
+		wantTag: `W/` + etag.String(),
+	}, {
+		name:    "if-none-match does not match",
+		mode:    StrongETag,
+		header:  map[string]string{"If-None-Match": `"x"`},
+		code:    200,
+		want:    "{\"foo\":\"bar\"}\n",
+		wantTag: etag.String(),
+	}, {
+		name:    "if-none-match ignored for post",
+		method:  "POST",
+		mode:    StrongETag,
+		header:  map[string]string{"If-None-Match": "*"},
+		code:    200,
+		want:    "{\"foo\":\"bar\"}\n",
+		wantTag: etag.String(),
+	}, {
+		name:   "non-200 status",
+		mode:   StrongETag,
+		status: 201,
+		header: map[string]string{"If-None-Match": "*"},
+		code:   201,
+		want:   "{\"foo\":\"bar\"}\n",
+	}, {
+		name:    "if-modified-since",
+		mode:    StrongETag,
+		body:    lastModifiedBody{JSON{Val: val}, "Thu, 02 Jan 2020 03:04:05 GMT"},
+		header:  map[string]string{"If-Modified-Since": "Thu, 02 Jan 2020 03:04:05 GMT"},
+		code:    304,
+		wantTag: etag.String(),
+	}, {
+		name:    "modified since",
+		mode:    StrongETag,
+		body:    lastModifiedBody{JSON{Val: val}, "Fri, 03 Jan 2020 03:04:05 GMT"},
+		header:  map[string]string{"If-Modified-Since": "Thu, 02 Jan 2020 03:04:05 GMT"},
+		code:    200,
+		want:    "{\"foo\":\"bar\"}\n",
+		wantTag: etag.String(),
+	}}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			method := tt.method
+			if len(method) == 0 {
+				method = "GET"
+			}
+			r := httptest.NewRequest(method, "/", nil)
+			for k, v := range tt.header {
+				r.Header.Set(k, v)
+			}
+			body := tt.body
+			if body == nil {
+				body = JSON{Val: val}
+			}
+
+			w := httptest.NewRecorder()
+			rw := ResponseWriter{Body: body, Status: tt.status, ETag: tt.mode}
+			if err := rw.WriteResponse(w, r); err != nil {
+				t.Fatal(err)
+			}
+
+			if e := compare.Compare(w.Code, tt.code); e != nil {
+				t.Error(e)
+			}
+			if e := compare.Compare(w.Body.String(), tt.want); e != nil {
+				t.Error(e)
+			}
+			if e := compare.Compare(w.Header().Get("ETag"), tt.wantTag); e != nil {
+				t.Error(e)
+			}
+			if tt.code == 304 && len(w.Header().Get("Content-Type")) > 0 {
+				t.Error("Content-Type set on 304 response")
+			}
+		})
+	}
+}
+
+func TestResponseWriter_ETagCompressed(t *testing.T) {
+	write := func(accept, inm string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest("GET", "/", nil)
+		r.Header.Set("Accept-Encoding", accept)
+		if len(inm) > 0 {
+			r.Header.Set("If-None-Match", inm)
+		}
+		w := httptest.NewRecorder()
+		rw := ResponseWriter{Body: JSON{Val: []int{1, 2, 3}}, ETag: StrongETag, Compress: &Compression{MinSize: 1}}
+		if err := rw.WriteResponse(w, r); err != nil {
+			t.Fatal(err)
+		}
+		return w
+	}
+
+	w := write("gzip", "")
+	if e := compare.Compare(w.Header().Get("Content-Encoding"), "gzip"); e != nil {
+		t.Error(e)
+	}
+	gzipTag := w.Header().Get("ETag")
+	if e := compare.Compare(gzipTag, computeETag(w.Body.Bytes(), StrongETag).String()); e != nil {
+		t.Error(e)
+	}
+
+	w = write("identity", "")
+	if e := compare.Compare(w.Header().Get("ETag"), computeETag([]byte("[1,2,3]\n"), StrongETag).String()); e != nil {
+		t.Error(e)
+	}
+	if w.Header().Get("ETag") == gzipTag {
+		t.Error("identity and gzip representations share the same ETag")
+	}
+
+	w = write("gzip", gzipTag)
+	if e := compare.Compare(w.Code, http.StatusNotModified); e != nil {
+		t.Error(e)
+	}
+	if e := compare.Compare(w.Header().Get("Vary"), "Accept-Encoding"); e != nil {
+		t.Error(e)
+	}
+}
+
+// lastModifiedBody is a BodyWriter that sets the Last-Modified header.
+type lastModifiedBody struct {
+	BodyWriter
+	lastModified string
+}
+
+func (b lastModifiedBody) WriteBody(w http.ResponseWriter, r *http.Request, status int) error {
+	w.Header().Set("Last-Modified", b.lastModified)
+	return b.BodyWriter.WriteBody(w, r, status)
+}
@@ -0,0 +1,218 @@
+package httpio
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+)
+
+// structField holds the encoding related information of a single struct field.
+type structField struct {
+	// The name of the field as it should appear in the encoded data.
+	name string
+	// The index sequence for reflect.Value.FieldByIndex.
+	index []int
+	// Indicates whether the field's tag has the "omitempty" option.
+	omitEmpty bool
+}
+
+type structFieldsKey struct {
+	typ  reflect.Type
+	tags string
+}
+
+// structFieldsCache maps structFieldsKeys to []structField.
+var structFieldsCache sync.Map
+
+// structFields returns the list of encodable fields of the given struct type.
+// The fields' names and options are taken from the first of the given struct
+// tag keys that is present in the field's tag, if none of the tag keys are present
+// the field's Go name is used. Fields with the tag value "-", and
+// unexported fields, are omitted. The fields of untagged embedded structs
+// are promoted to the outer struct following the encoding/json rules.
+func structFields(t reflect.Type, tags ...string) []structField {
+	key := structFieldsKey{t, strings.Join(tags, ",")}
+	if f, ok := structFieldsCache.Load(key); ok {
+		return f.([]structField)
+	}
+
+	fields := collectStructFields(t, tags, nil, map[reflect.Type]bool{})
+
+	// drop the fields hidden by a same-named field at a shallower depth,
+	// and those that are ambiguous at the same depth
+	byName := make(map[string][]structField)
+	for _, f := range fields {
+		byName[f.name] = append(byName[f.name], f)
+	}
+	out := fields[:0:0]
+	for _, f := range fields {
+		dominant := true
+		for _, g := range byName[f.name] {
+			if len(g.index) < len(f.index) || (len(g.index) == len(f.index) && !sameIndex(g.index, f.index)) {
+				dominant = false
+				break
+			}
+		}
+		if dominant {
+			out = append(out, f)
+		}
+	}
+
+	f, _ := structFieldsCache.LoadOrStore(key, out)
+	return f.([]structField)
+}
+
+func collectStructFields(t reflect.Type, tags []string, index []int, visited map[reflect.Type]bool) (fields []structField) {
+	if visited[t] {
+		return nil
+	}
+	visited[t] = true
+	defer delete(visited, t)
+
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		ft := sf.Type
+		if ft.Kind() == reflect.Ptr {
+			ft = ft.Elem()
+		}
+		if sf.PkgPath != "" && !(sf.Anonymous && ft.Kind() == reflect.Struct) {
+			continue // unexported
+		}
+
+		var tag string
+		for _, key := range tags {
+			if v, ok := sf.Tag.Lookup(key); ok {
+				tag = v
+				break
+			}
+		}
+		if tag == "-" {
+			continue
+		}
+
+		name, opts := tag, ""
+		if i := strings.IndexByte(tag, ','); i >= 0 {
+			name, opts = tag[:i], tag[i:]
+		}
+
+		idx := append(append([]int(nil), index...), i)
+		if sf.Anonymous && name == "" && ft.Kind() == reflect.Struct {
+			fields = append(fields, collectStructFields(ft, tags, idx, visited)...)
+			continue
+		}
+		if sf.PkgPath != "" {
+			continue
+		}
+		if name == "" {
+			name = sf.Name
+		}
+		fields = append(fields, structField{
+			name:      name,
+			index:     idx,
+			omitEmpty: strings.Contains(opts+",", ",omitempty,"),
+		})
+	}
+	return fields
+}
+
+func sameIndex(a, b []int) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// fieldByIndex is like reflect.Value.FieldByIndex but instead of panicking
+// on a nil embedded pointer it returns the zero reflect.Value.
+func fieldByIndex(v reflect.Value, index []int) reflect.Value {
+	for i, x := range index {
+		if i > 0 {
+			if v.Kind() == reflect.Ptr {
+				if v.IsNil() {
+					return reflect.Value{}
+				}
+				v = v.Elem()
+			}
+		}
+		v = v.Field(x)
+	}
+	return v
+}
+
+// fieldByIndexAlloc is like reflect.Value.FieldByIndex but it allocates
+// any nil embedded pointers along the way. The given value must be settable.
+// Like encoding/json, it returns an error if a nil embedded pointer cannot
+// be allocated because it points to an unexported struct type.
+func fieldByIndexAlloc(v reflect.Value, index []int) (reflect.Value, error) {
+	for i, x := range index {
+		if i > 0 {
+			if v.Kind() == reflect.Ptr {
+				if v.IsNil() {
+					if !v.CanSet() {
+						return reflect.Value{}, fmt.Errorf("cannot set embedded pointer to unexported struct %s", v.Type().Elem())
+					}
+					v.Set(reflect.New(v.Type().Elem()))
+				}
+				v = v.Elem()
+			}
+		}
+		v = v.Field(x)
+	}
+	return v, nil
+}
+
+// unhashableMapKey reports whether the given decoded map key cannot be used
+// as a key of a Go map, i.e. if it's an interface holding an incomparable value.
+func unhashableMapKey(kv reflect.Value) bool {
+	return kv.Kind() == reflect.Interface && !kv.IsNil() && !kv.Elem().Type().Comparable()
+}
+
+// isEmptyValue reports whether the given value is "empty" as defined
+// by the encoding/json package for the purposes of omitempty.
+func isEmptyValue(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Array, reflect.Map, reflect.Slice, reflect.String:
+		return v.Len() == 0
+	case reflect.Bool:
+		return !v.Bool()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return v.Int() == 0
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return v.Uint() == 0
+	case reflect.Float32, reflect.Float64:
+		return v.Float() == 0
+	case reflect.Interface, reflect.Ptr:
+		return v.IsNil()
+	}
+	return false
+}
+
+// findStructField returns the field with the given name.
+func findStructField(fields []structField, name string) (structField, bool) {
+	for _, f := range fields {
+		if f.name == name {
+			return f, true
+		}
+	}
+	return structField{}, false
+}
+
+// findStructFieldFold is like findStructField but if there's no exact match
+// it falls back to a case-insensitive match, similar to encoding/json.
+func findStructFieldFold(fields []structField, name string) (structField, bool) {
+	if f, ok := findStructField(fields, name); ok {
+		return f, true
+	}
+	for _, f := range fields {
+		if strings.EqualFold(f.name, name) {
+			return f, true
+		}
+	}
+	return structField{}, false
+}
@@ -0,0 +1,144 @@
+package httpio
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"path"
+	"strconv"
+	"time"
+)
+
+// The File type implements the BodyWriter interface by serving the content
+// of a file, or of any other io.ReadSeeker, using http.ServeContent. This
+// means that Range requests and the If-Match, If-Unmodified-Since,
+// If-None-Match, If-Modified-Since, and If-Range request headers are
+// handled as well, and the status code passed to WriteBody is ignored.
+type File struct {
+	// The content to be served. If Content also implements
+	// io.Closer it will be closed once it has been served.
+	Content io.ReadSeeker
+	// The name of the file. The name's extension is used to determine
+	// the Content-Type, unless it was already set, and the name's last
+	// element is used for the Content-Disposition header.
+	Name string
+	// The modification time of the file. If not zero, it is sent in
+	// the Last-Modified header and used to evaluate the conditional
+	// request headers.
+	ModTime time.Time
+	// If set, the Content-Disposition header will be set to "attachment"
+	// which makes browsers download the file instead of displaying it.
+	Attachment bool
+}
+
+// WriteInit is a noop, required only to satisfy the BodyWriter interface.
+func (f File) WriteInit(_ http.ResponseWriter) error {
+	return nil
+}
+
+// WriteBody implements the BodyWriter interface.
+func (f File) WriteBody(w http.ResponseWriter, r *http.Request, _ int) error {
+	if f.Content == nil {
+		return WriteError{errors.New("httpcrud/httpio: File.Content is nil")}
+	}
+	if c, ok := f.Content.(io.Closer); ok {
+		defer c.Close()
+	}
+
+	if f.Attachment {
+		setAttachment(w.Header(), f.Name)
+	}
+	http.ServeContent(w, r, f.Name, f.ModTime, f.Content)
+	return nil
+}
+
+// The Stream type implements the BodyWriter interface by copying the content
+// of an io.Reader to the response. Unlike File, Stream does not require the
+// content to be seekable and therefore does not support Range requests.
+type Stream struct {
+	// The content to be served. If Reader also implements
+	// io.Closer it will be closed once it has been served.
+	Reader io.Reader
+	// The size of the content in bytes, if known. If greater than zero it
+	// is sent in the Content-Length header, and WriteBody returns an error
+	// if the Reader does not yield exactly Size bytes.
+	Size int64
+	// The media type of the content. If not set, and the Content-Type header
+	// was not already set, the media type is determined from the extension
+	// of Name, or by sniffing the first 512 bytes of the content with
+	// http.DetectContentType.
+	ContentType string
+	// The name of the file, used for the Content-Disposition header.
+	Name string
+	// If set, the Content-Disposition header will be set to "attachment"
+	// which makes browsers download the content instead of displaying it.
+	Attachment bool
+}
+
+// WriteInit is a noop, required only to satisfy the BodyWriter interface.
+func (s Stream) WriteInit(_ http.ResponseWriter) error {
+	return nil
+}
+
+// WriteBody implements the BodyWriter interface. If the given statusCode
+// is 0, 200 (Status OK) will be used. The content is not copied if the
+// request's method is HEAD.
+func (s Stream) WriteBody(w http.ResponseWriter, r *http.Request, statusCode int) error {
+	if s.Reader == nil {
+		return WriteError{errors.New("httpcrud/httpio: Stream.Reader is nil")}
+	}
+	if c, ok := s.Reader.(io.Closer); ok {
+		defer c.Close()
+	}
+
+	h := w.Header()
+	src := s.Reader
+	if ctype := s.ContentType; len(ctype) > 0 {
+		h.Set("Content-Type", ctype)
+	} else if len(h.Get("Content-Type")) == 0 {
+		if ctype = mime.TypeByExtension(path.Ext(s.Name)); len(ctype) > 0 {
+			h.Set("Content-Type", ctype)
+		} else {
+			br := bufio.NewReaderSize(src, 512)
+			head, _ := br.Peek(512)
+			h.Set("Content-Type", http.DetectContentType(head))
+			src = br
+		}
+	}
+	if s.Size > 0 {
+		h.Set("Content-Length", strconv.FormatInt(s.Size, 10))
+	}
+	if s.Attachment {
+		setAttachment(h, s.Name)
+	}
+
+	if statusCode == 0 {
+		statusCode = http.StatusOK
+	}
+	w.WriteHeader(statusCode)
+	if r != nil && r.Method == http.MethodHead {
+		return nil
+	}
+
+	n, err := io.Copy(w, src)
+	if err != nil {
+		return WriteError{err}
+	}
+	if s.Size > 0 && n != s.Size {
+		return WriteError{fmt.Errorf("httpcrud/httpio: Stream.Size is %d but %d bytes were written", s.Size, n)}
+	}
+	return nil
+}
+
+// setAttachment sets the Content-Disposition header to "attachment" with
+// the last element of the given name, if any, as the file name.
+func setAttachment(h http.Header, name string) {
+	if len(name) > 0 {
+		h.Set("Content-Disposition", contentDisposition("attachment", path.Base(name)))
+	} else {
+		h.Set("Content-Disposition", "attachment")
+	}
+}
@@ -0,0 +1,193 @@
+package httpio
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/frk/compare"
+)
+
+type testReadCloser struct {
+	*strings.Reader
+	closed bool
+}
+
+func (rc *testReadCloser) Close() error {
+	rc.closed = true
+	return nil
+}
+
+func TestFile_WriteBody(t *testing.T) {
+	modtime := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	tests := []struct {
+		name   string
+		file   File
+		header map[string]string
+		code   int
+		want   string
+		wanth  http.Header
+	}{{
+		name: "full content",
+		file: File{Name: "docs/hello.txt", ModTime: modtime},
+		code: 200,
+		want: "hello, world",
+		wanth: http.Header{
+			"Accept-Ranges":  {"bytes"},
+			"Content-Length": {"12"},
+			"Content-Type":   {"text/plain; charset=utf-8"},
+			"Last-Modified":  {"Thu, 02 Jan 2020 03:04:05 GMT"},
+		},
+	}, {
+		name:   "range",
+		file:   File{Name: "hello.txt", ModTime: modtime, Attachment: true},
+		header: map[string]string{"Range": "bytes=7-"},
+		code:   206,
+		want:   "world",
+		wanth: http.Header{
+			"Accept-Ranges":       {"bytes"},
+			"Content-Disposition": {"attachment; filename=hello.txt"},
+			"Content-Length":      {"5"},
+			"Content-Range":       {"bytes 7-11/12"},
+			"Content-Type":        {"text/plain; charset=utf-8"},
+			"Last-Modified":       {"Thu, 02 Jan 2020 03:04:05 GMT"},
+		},
+	}, {
+		name:   "not modified",
+		file:   File{Name: "hello.txt", ModTime: modtime},
+		header: map[string]string{"If-Modified-Since": "Thu, 02 Jan 2020 03:04:05 GMT"},
+		code:   304,
+		wanth: http.Header{
+			"Last-Modified": {"Thu, 02 Jan 2020 03:04:05 GMT"},
+		},
+	}, {
+		name:   "precondition failed",
+		file:   File{Name: "hello.txt", ModTime: modtime},
+		header: map[string]string{"If-Unmodified-Since": "Wed, 01 Jan 2020 00:00:00 GMT"},
+		code:   412,
+		wanth: http.Header{
+			"Last-Modified": {"Thu, 02 Jan 2020 03:04:05 GMT"},
+		},
+	}}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rc := &testReadCloser{Reader: strings.NewReader("hello, world")}
+			tt.file.Content = rc
+
+			r := httptest.NewRequest("GET", "/", nil)
+			for k, v := range tt.header {
+				r.Header.Set(k, v)
+			}
+			w := httptest.NewRecorder()
+			if err := tt.file.WriteBody(w, r, 0); err != nil {
+				t.Fatal(err)
+			}
+
+			if e := compare.Compare(w.Code, tt.code); e != nil {
+				t.Error(e)
+			}
+			if e := compare.Compare(w.Body.String(), tt.want); e != nil {
+				t.Error(e)
+			}
+			if e := compare.Compare(w.Result().Header, tt.wanth); e != nil {
+				t.Error(e)
+			}
+			if !rc.closed {
+				t.Error("content not closed")
+			}
+		})
+	}
+}
+
+func TestStream_WriteBody(t *testing.T) {
+	tests := []struct {
+		name   string
+		stream Stream
+		method string
+		header map[string]string
+		code   int
+		want   string
+		wanth  http.Header
+		err    bool
+	}{{
+		name:   "sniffed content type",
+		stream: Stream{Reader: strings.NewReader("<html><body>hi</body></html>")},
+		code:   200,
+		want:   "<html><body>hi</body></html>",
+		wanth:  http.Header{"Content-Type": {"text/html; charset=utf-8"}},
+	}, {
+		name:   "explicit content type and size",
+		stream: Stream{Reader: strings.NewReader("a,b\n"), Size: 4, ContentType: "text/csv"},
+		code:   201,
+		want:   "a,b\n",
+		wanth:  http.Header{"Content-Type": {"text/csv"}, "Content-Length": {"4"}},
+	}, {
+		name:   "attachment with extension",
+		stream: Stream{Reader: strings.NewReader("{}"), Name: "export/résumé.json", Attachment: true},
+		code:   200,
+		want:   "{}",
+		wanth: http.Header{
+			"Content-Type":        {"application/json"},
+			"Content-Disposition": {`attachment; filename="r_sum_.json"; filename*=UTF-8''r%C3%A9sum%C3%A9.json`},
+		},
+	}, {
+		name:   "content type set by handler",
+		stream: Stream{Reader: strings.NewReader("{}"), Name: "data.json"},
+		header: map[string]string{"Content-Type": "application/vnd.api+json"},
+		code:   200,
+		want:   "{}",
+		wanth:  http.Header{"Content-Type": {"application/vnd.api+json"}},
+	}, {
+		name:   "head",
+		stream: Stream{Reader: strings.NewReader("abc"), Size: 3, ContentType: "text/plain"},
+		method: "HEAD",
+		code:   200,
+		wanth:  http.Header{"Content-Type": {"text/plain"}, "Content-Length": {"3"}},
+	}, {
+		name:   "size mismatch",
+		stream: Stream{Reader: strings.NewReader("abc"), Size: 5, ContentType: "text/plain"},
+		code:   200,
+		want:   "abc",
+		wanth:  http.Header{"Content-Type": {"text/plain"}, "Content-Length": {"5"}},
+		err:    true,
+	}}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			method := tt.method
+			if len(method) == 0 {
+				method = "GET"
+			}
+			r := httptest.NewRequest(method, "/", nil)
+			w := httptest.NewRecorder()
+			for k, v := range tt.header {
+				w.Header().Set(k, v)
+			}
+
+			code := tt.code
+			if code == 200 {
+				code = 0
+			}
+			err := tt.stream.WriteBody(w, r, code)
+			if (err != nil) != tt.err {
+				t.Errorf("got err %v, want err=%t", err, tt.err)
+			}
+
+			if e := compare.Compare(w.Code, tt.code); e != nil {
+				t.Error(e)
+			}
+			body, _ := ioutil.ReadAll(w.Body)
+			if e := compare.Compare(string(body), tt.want); e != nil {
+				t.Error(e)
+			}
+			if e := compare.Compare(w.Result().Header, tt.wanth); e != nil {
+				t.Error(e)
+			}
+		})
+	}
+}
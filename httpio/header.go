@@ -3,6 +3,9 @@ package httpio
 import (
 	"net/http"
 	"regexp"
+	"strconv"
+	"strings"
+	"time"
 )
 
 // CookieValues can be used to read the values from the Cookie header of the
@@ -111,3 +114,153 @@ func (rr SetCookie) WriteHeader(header http.Header) {
 		header.Add("Set-Cookie", v)
 	}
 }
+
+// CacheControl can be used to set the Cache-Control header of the outgoing
+// response. The header is not set if none of the directives are set.
+type CacheControl struct {
+	// The max-age directive, truncated to seconds. Omitted if zero,
+	// use NoCache to require caches to revalidate the response.
+	MaxAge time.Duration
+	// The s-maxage directive, truncated to seconds. Omitted if zero.
+	SMaxAge time.Duration
+	// The public directive.
+	Public bool
+	// The private directive.
+	Private bool
+	// The no-cache directive.
+	NoCache bool
+	// The no-store directive.
+	NoStore bool
+	// The must-revalidate directive.
+	MustRevalidate bool
+	// The stale-while-revalidate directive, truncated to seconds. Omitted if zero.
+	StaleWhileRevalidate time.Duration
+	// The immutable directive.
+	Immutable bool
+}
+
+// WriteHeader implements the HeaderWriter interface.
+func (cc CacheControl) WriteHeader(header http.Header) {
+	if v := cc.String(); len(v) > 0 {
+		header.Set("Cache-Control", v)
+	}
+}
+
+// String returns the value of the Cache-Control header.
+func (cc CacheControl) String() string {
+	var dirs []string
+	if cc.Public {
+		dirs = append(dirs, "public")
+	}
+	if cc.Private {
+		dirs = append(dirs, "private")
+	}
+	if cc.NoCache {
+		dirs = append(dirs, "no-cache")
+	}
+	if cc.NoStore {
+		dirs = append(dirs, "no-store")
+	}
+	if cc.MaxAge > 0 {
+		dirs = append(dirs, "max-age="+strconv.FormatInt(int64(cc.MaxAge/time.Second), 10))
+	}
+	if cc.SMaxAge > 0 {
+		dirs = append(dirs, "s-maxage="+strconv.FormatInt(int64(cc.SMaxAge/time.Second), 10))
+	}
+	if cc.MustRevalidate {
+		dirs = append(dirs, "must-revalidate")
+	}
+	if cc.StaleWhileRevalidate > 0 {
+		dirs = append(dirs, "stale-while-revalidate="+strconv.FormatInt(int64(cc.StaleWhileRevalidate/time.Second), 10))
+	}
+	if cc.Immutable {
+		dirs = append(dirs, "immutable")
+	}
+	return strings.Join(dirs, ", ")
+}
+
+// Vary can be used to add the listed header names to the Vary
+// header of the outgoing response. Names that are already
+// listed in the header are not added again.
+type Vary []string
+
+// WriteHeader implements the HeaderWriter interface.
+func (v Vary) WriteHeader(header http.Header) {
+	for _, name := range v {
+		addVary(header, name)
+	}
+}
+
+// Expires can be used to set the Expires header of the outgoing response.
+type Expires struct {
+	// The expiration time. If nil, or zero, the header is not set.
+	Val *time.Time
+}
+
+// WriteHeader implements the HeaderWriter interface.
+func (e Expires) WriteHeader(header http.Header) {
+	if e.Val != nil && !e.Val.IsZero() {
+		header.Set("Expires", e.Val.UTC().Format(http.TimeFormat))
+	}
+}
+
+// contentDisposition returns the value of a Content-Disposition header with
+// the given disposition type and file name, as specified by RFC 6266. File
+// names that contain characters outside of the ASCII range are sent in the
+// "filename*" parameter, encoded as specified by RFC 8187, preceded by a
+// "filename" parameter with an ASCII approximation for older clients.
+func contentDisposition(dtype, filename string) string {
+	if isToken(filename) {
+		return dtype + "; filename=" + filename
+	}
+
+	ascii := true
+	fallback := make([]byte, 0, len(filename))
+	for _, r := range filename {
+		if r < 0x20 || r > 0x7e {
+			ascii = false
+			r = '_'
+		}
+		fallback = append(fallback, byte(r))
+	}
+	value := dtype + "; filename=" + quoteString(string(fallback))
+	if ascii {
+		return value
+	}
+
+	var b strings.Builder
+	for i := 0; i < len(filename); i++ {
+		if c := filename[i]; isAttrChar(c) {
+			b.WriteByte(c)
+		} else {
+			b.WriteByte('%')
+			b.WriteByte("0123456789ABCDEF"[c>>4])
+			b.WriteByte("0123456789ABCDEF"[c&15])
+		}
+	}
+	return value + "; filename*=UTF-8''" + b.String()
+}
+
+// isToken reports whether s is a non-empty token as defined by RFC 7230.
+func isToken(s string) bool {
+	if len(s) == 0 {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		if c := s[i]; !isAttrChar(c) && !strings.ContainsRune("'*%", rune(c)) {
+			return false
+		}
+	}
+	return true
+}
+
+// isAttrChar reports whether c is an attr-char as defined by RFC 8187.
+func isAttrChar(c byte) bool {
+	return ('a' <= c && c <= 'z') || ('A' <= c && c <= 'Z') || ('0' <= c && c <= '9') ||
+		strings.IndexByte("!#$&+-.^_`|~", c) >= 0
+}
+
+// quoteString returns s as an RFC 7230 quoted-string.
+func quoteString(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s) + `"`
+}
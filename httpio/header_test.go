@@ -3,6 +3,7 @@ package httpio
 import (
 	"net/http"
 	"testing"
+	"time"
 
 	"github.com/frk/compare"
 )
@@ -35,3 +36,53 @@ func TestCookieValues_ReadHeader(t *testing.T) {
 		}
 	}
 }
+
+func TestCacheControl_WriteHeader(t *testing.T) {
+	tests := []struct {
+		cc   CacheControl
+		want http.Header
+	}{{
+		cc:   CacheControl{},
+		want: http.Header{},
+	}, {
+		cc:   CacheControl{NoStore: true},
+		want: http.Header{"Cache-Control": {"no-store"}},
+	}, {
+		cc:   CacheControl{Private: true, NoCache: true, MaxAge: 90 * time.Second},
+		want: http.Header{"Cache-Control": {"private, no-cache, max-age=90"}},
+	}, {
+		cc: CacheControl{Public: true, MaxAge: time.Hour, SMaxAge: 10*time.Minute + 500*time.Millisecond,
+			MustRevalidate: true, StaleWhileRevalidate: time.Minute, Immutable: true},
+		want: http.Header{"Cache-Control": {"public, max-age=3600, s-maxage=600, must-revalidate, stale-while-revalidate=60, immutable"}},
+	}}
+
+	for _, tt := range tests {
+		got := http.Header{}
+		tt.cc.WriteHeader(got)
+		if e := compare.Compare(got, tt.want); e != nil {
+			t.Error(e)
+		}
+	}
+}
+
+func TestHeaderWriterList_WriteHeader(t *testing.T) {
+	exp := time.Date(2020, 1, 2, 4, 4, 5, 0, time.FixedZone("CET", 3600))
+	list := HeaderWriterList{
+		CacheControl{Public: true, MaxAge: time.Minute},
+		Vary{"Accept", "accept-language", "Accept"},
+		Expires{&exp},
+		Expires{},
+	}
+
+	got := http.Header{"Vary": {"Accept-Encoding"}}
+	list.WriteHeader(got)
+
+	want := http.Header{
+		"Cache-Control": {"public, max-age=60"},
+		"Vary":          {"Accept-Encoding", "Accept", "accept-language"},
+		"Expires":       {"Thu, 02 Jan 2020 03:04:05 GMT"},
+	}
+	if e := compare.Compare(got, want); e != nil {
+		t.Error(e)
+	}
+}
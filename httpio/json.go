@@ -0,0 +1,233 @@
+package httpio
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+var errTrailingJSON = errors.New("unexpected data after top-level value")
+
+// jsonUnknownField is the prefix of the message of the error returned by
+// the encoding/json decoder for an unknown object key, the prefix is
+// followed by the quoted key. The package exports no type for this error
+// so its message has to be matched instead.
+const jsonUnknownField = "json: unknown field "
+
+// decode decodes the json from body into the receiver's Val field using
+// the encoding/json package configured according to the receiver's options.
+func (j JSON) decode(body io.Reader) error {
+	// The body is retained only if the errors need to be located.
+	var buf *bytes.Buffer
+	if j.LocateErrors {
+		buf = new(bytes.Buffer)
+		body = io.TeeReader(body, buf)
+	}
+
+	dec := json.NewDecoder(body)
+	if j.DisallowUnknownFields {
+		dec.DisallowUnknownFields()
+	}
+	if j.UseNumber {
+		dec.UseNumber()
+	}
+
+	if err := dec.Decode(j.Val); err != nil {
+		if err == io.EOF && j.AllowEmpty {
+			return nil
+		}
+		if buf != nil {
+			err = newJSONError(err, buf.Bytes(), reflect.TypeOf(j.Val))
+		}
+		return ReadError{err}
+	}
+
+	if j.DisallowTrailingData {
+		off := dec.InputOffset()
+		rest := bufio.NewReader(io.MultiReader(dec.Buffered(), body))
+		for {
+			c, err := rest.ReadByte()
+			if err == io.EOF {
+				break
+			} else if err != nil {
+				return ReadError{err}
+			}
+			if !isJSONSpace(c) {
+				return ReadError{JSONError{Offset: off, Err: errTrailingJSON}}
+			}
+			off++
+		}
+	}
+	return nil
+}
+
+// newJSONError returns a JSONError for the given error returned by the
+// encoding/json decoder. The data argument holds the body read so far and
+// t is the type of the destination value. Errors that cannot be located
+// in the body are returned as is.
+func newJSONError(err error, data []byte, t reflect.Type) error {
+	switch e := err.(type) {
+	case *json.SyntaxError:
+		return JSONError{Path: jsonPathAt(data, e.Offset), Offset: e.Offset, Err: err}
+	case *json.UnmarshalTypeError:
+		return JSONError{Path: jsonPathAt(data, e.Offset), Offset: e.Offset, Err: err}
+	}
+
+	if msg := err.Error(); strings.HasPrefix(msg, jsonUnknownField) {
+		key, uerr := strconv.Unquote(msg[len(jsonUnknownField):])
+		if uerr != nil {
+			return err
+		}
+
+		jerr := JSONError{Offset: -1, Err: err}
+		walkJSON(data, int64(len(data)), func(stack []jsonPathElem, k string, off int64) bool {
+			if k != key || hasJSONField(t, stack, k) {
+				return true
+			}
+			jerr.Path, jerr.Offset = joinFieldPath(formatJSONPath(stack), k), off
+			return false
+		})
+		if jerr.Offset >= 0 {
+			return jerr
+		}
+	}
+	return err
+}
+
+// jsonPathElem represents an object or array in the path to a json value.
+type jsonPathElem struct {
+	array     bool
+	index     int
+	key       string
+	expectKey bool
+}
+
+// jsonPathAt returns the path to the json value at the given offset in data.
+func jsonPathAt(data []byte, offset int64) string {
+	return formatJSONPath(walkJSON(data, offset, nil))
+}
+
+// walkJSON scans data up to the given offset while keeping track of the
+// path to the current value, and returns the path at which it stopped.
+// If onKey is not nil it is invoked for each object key, with the path
+// to the object and the offset of the key, and the scan stops
+// if onKey returns false.
+func walkJSON(data []byte, offset int64, onKey func(stack []jsonPathElem, key string, off int64) bool) []jsonPathElem {
+	var stack []jsonPathElem
+	if offset > int64(len(data)) {
+		offset = int64(len(data))
+	}
+
+	for i := int64(0); i < offset; i++ {
+		var top *jsonPathElem
+		if len(stack) > 0 {
+			top = &stack[len(stack)-1]
+		}
+
+		switch data[i] {
+		case '{':
+			stack = append(stack, jsonPathElem{expectKey: true})
+		case '[':
+			stack = append(stack, jsonPathElem{array: true})
+		case '}', ']':
+			if top != nil {
+				stack = stack[:len(stack)-1]
+			}
+		case ',':
+			if top != nil && top.array {
+				top.index++
+			} else if top != nil {
+				top.key, top.expectKey = "", true
+			}
+		case ':':
+			if top != nil {
+				top.expectKey = false
+			}
+		case '"':
+			end := i + 1
+			for end < int64(len(data)) && data[end] != '"' {
+				if data[end] == '\\' {
+					end++
+				}
+				end++
+			}
+			if end >= int64(len(data)) {
+				return stack
+			}
+			if top != nil && !top.array && top.expectKey {
+				var key string
+				json.Unmarshal(data[i:end+1], &key)
+				if onKey != nil && !onKey(stack, key, i) {
+					return stack
+				}
+				top.key = key
+			}
+			i = end
+		}
+	}
+	return stack
+}
+
+// formatJSONPath returns the string representation of the given path.
+func formatJSONPath(stack []jsonPathElem) string {
+	var path string
+	for _, e := range stack {
+		if e.array {
+			path += "[" + strconv.Itoa(e.index) + "]"
+		} else if len(e.key) > 0 {
+			path = joinFieldPath(path, e.key)
+		}
+	}
+	return path
+}
+
+// hasJSONField reports whether the object at the given path, within a json
+// value decoded into t, can hold the key. Objects that are decoded into
+// something other than a struct can hold any key.
+func hasJSONField(t reflect.Type, stack []jsonPathElem, key string) bool {
+	for i := 0; t != nil && i < len(stack); i++ {
+		for t.Kind() == reflect.Ptr {
+			t = t.Elem()
+		}
+
+		e := stack[i]
+		if i == len(stack)-1 {
+			e.key = key
+		}
+		switch {
+		case e.array && (t.Kind() == reflect.Slice || t.Kind() == reflect.Array):
+			t = t.Elem()
+		case !e.array && t.Kind() == reflect.Map:
+			t = t.Elem()
+		case !e.array && t.Kind() == reflect.Struct:
+			f, ok := findStructFieldFold(structFields(t, "json"), e.key)
+			if !ok {
+				return false
+			}
+			t = fieldType(t, f.index)
+		default:
+			return true
+		}
+	}
+	return true
+}
+
+// fieldType returns the type of the struct field with the given index.
+func fieldType(t reflect.Type, index []int) reflect.Type {
+	for i, x := range index {
+		if i > 0 && t.Kind() == reflect.Ptr {
+			t = t.Elem()
+		}
+		t = t.Field(x).Type
+	}
+	return t
+}
+
+func isJSONSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\r' || c == '\n'
+}
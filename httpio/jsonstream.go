@@ -0,0 +1,186 @@
+package httpio
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"time"
+)
+
+// The JSONStream type implements the BodyWriter interface by using a StreamWriter.
+type JSONStream struct {
+	Stream StreamWriter
+}
+
+// WriteInit opens the underlying StreamWriter.
+func (s JSONStream) WriteInit(w http.ResponseWriter) error {
+	s.Stream.Open(w)
+	return nil
+}
+
+// WriteBody flushes the underlying StreamWriter.
+func (s JSONStream) WriteBody(_ http.ResponseWriter, _ *http.Request, _ int) error {
+	if err := s.Stream.Flush(); err != nil {
+		return WriteError{err}
+	}
+	return nil
+}
+
+const contentTypeNDJSON = "application/x-ndjson"
+
+// JSONStreamWriter implements the StreamWriter interface and is intended to be
+// embedded by user-defined structs that want to implement custom json writers.
+//
+// The items are written either as newline delimited json, or as the elements
+// of a json array, optionally enclosed in an object envelope. The array, and
+// the envelope, are opened lazily by the first call to WriteItem, or by Flush
+// if no items were written, and they are closed by Flush.
+type JSONStreamWriter struct {
+	// If set, the items will be written as newline delimited json
+	// with the "application/x-ndjson" content type, otherwise
+	// the items will be written as a json array.
+	NDJSON bool
+	// If set, the json array will be enclosed in an object as the value
+	// of the member with this name, e.g. {"items":[...]}. Ignored if
+	// NDJSON is set.
+	Envelope string
+	// The HTTP status code to be sent with the response.
+	// SHOULD be set prior to the first call to WriteItem.
+	// If not set, 200 (Status OK) will be used.
+	StatusCode int
+	// If set, the response will be flushed to the client
+	// after every FlushEvery items have been written.
+	FlushEvery int
+	// If set, the response will be flushed to the client by WriteItem
+	// if at least FlushInterval has passed since the last flush.
+	FlushInterval time.Duration
+
+	// The http.ResponseWriter target into which the json data will be written.
+	rw http.ResponseWriter
+	// The buffered writer wrapping rw.
+	bw *bufio.Writer
+	// The number of items written so far.
+	n int
+	// The time of the last flush.
+	flushed time.Time
+	// Set once the json array has been closed by Flush.
+	closed bool
+}
+
+// Open prepares the JSONStreamWriter instance using the given http.ResponseWriter
+// as the target into which the json data will be written. Open will be invoked
+// by (JSONStream).WriteInit indirectly through the StreamWriter interface, if,
+// however, the embedding code overrides this method by providing its own
+// implementation then that implementation MUST invoke this method directly.
+func (w *JSONStreamWriter) Open(rw http.ResponseWriter) {
+	w.rw = rw
+	w.bw = nil
+	w.n = 0
+	w.closed = false
+}
+
+// Flush closes the json array, if any, and writes any buffered data to the
+// underlying http.ResponseWriter. Once the stream has been closed any
+// subsequent calls to Flush are a noop. Flush will be invoked by (JSONStream).WriteBody
+// indirectly through the StreamWriter interface, if, however, the embedding code
+// overrides this method by providing its own implementation then that
+// implementation MUST invoke this method directly.
+func (w *JSONStreamWriter) Flush() error {
+	if w.closed {
+		return nil
+	}
+	if w.bw == nil {
+		if err := w.open(); err != nil {
+			return err
+		}
+	}
+	if !w.NDJSON {
+		end := "]"
+		if len(w.Envelope) > 0 {
+			end = "]}"
+		}
+		if _, err := w.bw.WriteString(end + "\n"); err != nil {
+			return err
+		}
+	}
+	w.closed = true
+	return w.bw.Flush()
+}
+
+// WriteItem writes the json encoding of the given item to the underlying
+// http.ResponseWriter. This method SHOULD be invoked directly by the user code.
+func (w *JSONStreamWriter) WriteItem(v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	if w.bw == nil {
+		if err := w.open(); err != nil {
+			return err
+		}
+	}
+	if !w.NDJSON && w.n > 0 {
+		if err := w.bw.WriteByte(','); err != nil {
+			return err
+		}
+	}
+	if _, err := w.bw.Write(data); err != nil {
+		return err
+	}
+	if w.NDJSON {
+		if err := w.bw.WriteByte('\n'); err != nil {
+			return err
+		}
+	}
+	w.n += 1
+
+	if (w.FlushEvery > 0 && w.n%w.FlushEvery == 0) ||
+		(w.FlushInterval > 0 && time.Since(w.flushed) >= w.FlushInterval) {
+		return w.flush()
+	}
+	return nil
+}
+
+// open sets the json specific http headers, writes the header, and
+// then opens the json array and the envelope, if any.
+func (w *JSONStreamWriter) open() error {
+	if w.NDJSON {
+		w.rw.Header().Set("Content-Type", contentTypeNDJSON)
+	} else {
+		w.rw.Header().Set("Content-Type", contentTypeJSON)
+	}
+	if w.StatusCode == 0 {
+		w.StatusCode = http.StatusOK
+	}
+	w.rw.WriteHeader(w.StatusCode)
+
+	w.bw = bufio.NewWriter(w.rw)
+	w.flushed = time.Now()
+	if w.NDJSON {
+		return nil
+	}
+	if len(w.Envelope) > 0 {
+		key, err := json.Marshal(w.Envelope)
+		if err != nil {
+			return err
+		}
+		w.bw.WriteByte('{')
+		w.bw.Write(key)
+		w.bw.WriteByte(':')
+	}
+	return w.bw.WriteByte('[')
+}
+
+// flush writes the buffered data to the underlying http.ResponseWriter
+// and flushes it to the client if it implements the http.Flusher interface.
+func (w *JSONStreamWriter) flush() error {
+	if err := w.bw.Flush(); err != nil {
+		return err
+	}
+	if f, ok := w.rw.(http.Flusher); ok {
+		f.Flush()
+	}
+	w.flushed = time.Now()
+	return nil
+}
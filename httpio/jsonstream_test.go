@@ -0,0 +1,132 @@
+package httpio
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/frk/compare"
+)
+
+type testJSONStream struct {
+	JSONStreamWriter
+}
+
+func TestJSONStreamWriter(t *testing.T) {
+	items := []interface{}{
+		map[string]int{"a": 1},
+		map[string]int{"a": 2},
+		"x",
+	}
+
+	tests := []struct {
+		name   string
+		stream *testJSONStream
+		items  []interface{}
+		code   int
+		ctype  string
+		want   string
+	}{{
+		name:   "array",
+		stream: &testJSONStream{},
+		items:  items,
+		code:   http.StatusOK,
+		ctype:  contentTypeJSON,
+		want:   `[{"a":1},{"a":2},"x"]` + "\n",
+	}, {
+		name:   "empty array",
+		stream: &testJSONStream{},
+		code:   http.StatusOK,
+		ctype:  contentTypeJSON,
+		want:   "[]\n",
+	}, {
+		name:   "envelope",
+		stream: &testJSONStream{JSONStreamWriter{Envelope: "items", StatusCode: http.StatusPartialContent}},
+		items:  items,
+		code:   http.StatusPartialContent,
+		ctype:  contentTypeJSON,
+		want:   `{"items":[{"a":1},{"a":2},"x"]}` + "\n",
+	}, {
+		name:   "empty envelope",
+		stream: &testJSONStream{JSONStreamWriter{Envelope: "items"}},
+		code:   http.StatusOK,
+		ctype:  contentTypeJSON,
+		want:   `{"items":[]}` + "\n",
+	}, {
+		name:   "ndjson",
+		stream: &testJSONStream{JSONStreamWriter{NDJSON: true}},
+		items:  items,
+		code:   http.StatusOK,
+		ctype:  contentTypeNDJSON,
+		want:   "{\"a\":1}\n{\"a\":2}\n\"x\"\n",
+	}, {
+		name:   "empty ndjson",
+		stream: &testJSONStream{JSONStreamWriter{NDJSON: true}},
+		code:   http.StatusOK,
+		ctype:  contentTypeNDJSON,
+		want:   "",
+	}}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			body := JSONStream{tt.stream}
+			if err := body.WriteInit(w); err != nil {
+				t.Fatal(err)
+			}
+			for _, item := range tt.items {
+				if err := tt.stream.WriteItem(item); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err := body.WriteBody(w, nil, 0); err != nil {
+				t.Fatal(err)
+			}
+
+			if e := compare.Compare(w.Code, tt.code); e != nil {
+				t.Error(e)
+			}
+			if e := compare.Compare(w.Header().Get("Content-Type"), tt.ctype); e != nil {
+				t.Error(e)
+			}
+			if e := compare.Compare(w.Body.String(), tt.want); e != nil {
+				t.Error(e)
+			}
+		})
+	}
+}
+
+func TestJSONStreamWriter_FlushEvery(t *testing.T) {
+	w := httptest.NewRecorder()
+	stream := &JSONStreamWriter{NDJSON: true, FlushEvery: 2}
+	stream.Open(w)
+
+	stream.WriteItem(1)
+	if w.Flushed || w.Body.Len() != 0 {
+		t.Fatal("flushed after first item")
+	}
+	stream.WriteItem(2)
+	if !w.Flushed {
+		t.Fatal("not flushed after second item")
+	}
+	if e := compare.Compare(w.Body.String(), "1\n2\n"); e != nil {
+		t.Error(e)
+	}
+}
+
+func TestJSONStreamWriter_FlushTwice(t *testing.T) {
+	w := httptest.NewRecorder()
+	stream := &JSONStreamWriter{Envelope: "items"}
+	stream.Open(w)
+
+	stream.WriteItem(1)
+	if err := stream.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if err := stream.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if e := compare.Compare(w.Body.String(), `{"items":[1]}`+"\n"); e != nil {
+		t.Error(e)
+	}
+}
@@ -0,0 +1,68 @@
+package httpio
+
+import (
+	"io"
+	"net/http"
+)
+
+// LimitBody limits the size of the request's body to n bytes, reading past
+// the limit will fail with a PayloadTooLargeError. If n is not positive the
+// request's body is left unchanged.
+//
+// The body is wrapped with http.MaxBytesReader, if w is not nil it will be
+// passed to http.MaxBytesReader so that the server can close the connection
+// once the limit is exceeded. If the body was already limited by a previous
+// call to LimitBody and nothing has been read from it yet, the previous
+// limit is replaced by n, this allows more specific limits, e.g. that of
+// a BodyReader, to override more general ones, e.g. that of a route.
+func LimitBody(w http.ResponseWriter, r *http.Request, n int64) {
+	if n <= 0 || r == nil || r.Body == nil {
+		return
+	}
+
+	body := r.Body
+	if lb, ok := body.(*limitedBody); ok && lb.read == 0 {
+		body = lb.body
+		if w == nil {
+			w = lb.w
+		}
+	}
+	r.Body = &limitedBody{
+		body:     body,
+		w:        w,
+		r:        http.MaxBytesReader(w, body, n),
+		limit:    n,
+		tooLarge: r.ContentLength > n,
+	}
+}
+
+// limitedBody wraps an http.MaxBytesReader and translates
+// its error into a PayloadTooLargeError.
+type limitedBody struct {
+	// the original body and response writer
+	body io.ReadCloser
+	w    http.ResponseWriter
+	// the reader returned by http.MaxBytesReader
+	r io.ReadCloser
+	// the limit and the number of bytes read so far
+	limit int64
+	read  int64
+	// set if the request's Content-Length exceeds the limit
+	tooLarge bool
+}
+
+func (b *limitedBody) Read(p []byte) (int, error) {
+	if b.tooLarge {
+		return 0, PayloadTooLargeError{Limit: b.limit}
+	}
+	n, err := b.r.Read(p)
+	b.read += int64(n)
+	if err != nil && err != io.EOF && b.read >= b.limit {
+		err = PayloadTooLargeError{Limit: b.limit}
+	}
+	return n, err
+}
+
+func (b *limitedBody) Close() error {
+	return b.r.Close()
+}
@@ -0,0 +1,112 @@
+package httpio
+
+import (
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/frk/compare"
+)
+
+func TestLimitBody(t *testing.T) {
+	body := `{"foo":"test","bar":0.004,"baz":true}`
+	tests := []struct {
+		name   string
+		reader BodyReader
+		rr     RequestReader
+		cl     int64
+		err    error
+	}{{
+		name:   "json within limit",
+		reader: JSON{Val: &testBody{}, MaxBytes: int64(len(body))},
+	}, {
+		name:   "json exceeds limit",
+		reader: JSON{Val: &testBody{}, MaxBytes: 10},
+		err:    PayloadTooLargeError{Limit: 10},
+	}, {
+		name:   "json exceeds limit with strict options",
+		reader: JSON{Val: &testBody{}, MaxBytes: 10, DisallowTrailingData: true},
+		err:    PayloadTooLargeError{Limit: 10},
+	}, {
+		name:   "xml exceeds limit",
+		reader: XML{Val: &testBody{}, MaxBytes: 10},
+		err:    PayloadTooLargeError{Limit: 10},
+	}, {
+		name:   "form exceeds limit",
+		reader: Form{Val: &testBody{}, MaxBytes: 10},
+		err:    PayloadTooLargeError{Limit: 10},
+	}, {
+		name:   "dump exceeds limit",
+		reader: RequestDump{Val: &[]byte{}, Body: true, MaxBytes: 10},
+		err:    PayloadTooLargeError{Limit: 10},
+	}, {
+		name:   "content length exceeds limit",
+		reader: JSON{Val: &testBody{}, MaxBytes: 100},
+		cl:     101,
+		err:    PayloadTooLargeError{Limit: 100},
+	}, {
+		name: "request reader limit",
+		rr:   RequestReader{Body: JSON{Val: &testBody{}}, MaxBodyBytes: 5},
+		err:  PayloadTooLargeError{Limit: 5},
+	}, {
+		name: "body reader limit overrides request reader limit",
+		rr:   RequestReader{Body: JSON{Val: &testBody{}, MaxBytes: 100}, MaxBodyBytes: 5},
+	}}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, err := http.NewRequest("POST", "/", strings.NewReader(body))
+			if err != nil {
+				t.Fatal(err)
+			}
+			r.ContentLength = tt.cl
+			r.Header.Set("Content-Type", "application/json")
+
+			if tt.reader != nil {
+				err = tt.reader.ReadBody(r)
+			} else {
+				err = tt.rr.ReadRequest(r, r.Context())
+			}
+
+			var got error
+			var perr PayloadTooLargeError
+			if errors.As(err, &perr) {
+				got = perr
+			} else if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if e := compare.Compare(got, tt.err); e != nil {
+				t.Error(e)
+			}
+		})
+	}
+}
+
+func TestLimitBody_Replace(t *testing.T) {
+	r, err := http.NewRequest("POST", "/", strings.NewReader("0123456789"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	LimitBody(nil, r, 5)
+	LimitBody(nil, r, 10)
+	data, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e := compare.Compare(string(data), "0123456789"); e != nil {
+		t.Error(e)
+	}
+
+	// once read from, the limit can no longer be replaced
+	r, _ = http.NewRequest("POST", "/", strings.NewReader("0123456789"))
+	r.ContentLength = -1
+	LimitBody(nil, r, 5)
+	r.Body.Read(make([]byte, 1))
+	LimitBody(nil, r, 10)
+	if _, err := ioutil.ReadAll(r.Body); !errors.As(err, new(PayloadTooLargeError)) {
+		t.Errorf("got %v, want PayloadTooLargeError", err)
+	}
+}
@@ -0,0 +1,173 @@
+package httpio
+
+import (
+	"net/url"
+	"sort"
+	"strings"
+)
+
+// FilterOp represents a comparison operator of a filter condition.
+type FilterOp string
+
+const (
+	OpEq   FilterOp = "eq"   // equal to
+	OpNe   FilterOp = "ne"   // not equal to
+	OpGt   FilterOp = "gt"   // greater than
+	OpGte  FilterOp = "gte"  // greater than or equal to
+	OpLt   FilterOp = "lt"   // less than
+	OpLte  FilterOp = "lte"  // less than or equal to
+	OpIn   FilterOp = "in"   // equal to one of a comma separated list of values
+	OpLike FilterOp = "like" // matches a pattern
+)
+
+// filterOps is the list of the known filter operators.
+var filterOps = []FilterOp{OpEq, OpNe, OpGt, OpGte, OpLt, OpLte, OpIn, OpLike}
+
+// SortField represents a single field of a sort expression.
+type SortField struct {
+	// The name of the field by which to sort.
+	Field string
+	// Indicates whether the sort order is descending.
+	Desc bool
+}
+
+// FilterCond represents a single filter condition.
+type FilterCond struct {
+	// The name of the field to be filtered.
+	Field string
+	// The comparison operator.
+	Op FilterOp
+	// The raw value against which the field should be compared.
+	Value string
+}
+
+// Values returns the comma separated values of an OpIn condition.
+// For other operators the result contains just the condition's Value.
+func (c FilterCond) Values() []string {
+	if c.Op == OpIn {
+		return strings.Split(c.Value, ",")
+	}
+	return []string{c.Value}
+}
+
+// ListQuery is the result of parsing the sort and filter query parameters.
+type ListQuery struct {
+	// The sort fields in the order of precedence.
+	Sort []SortField
+	// The filter conditions, ordered by field name.
+	Filter []FilterCond
+}
+
+// SortFilter can be used to read the "sort" and "filter" query parameters of
+// the incoming HTTP request and set the result to the ListQuery pointed to by Val.
+//
+// The sort parameter is expected to hold a comma separated list of field names,
+// each optionally prefixed with "-" to indicate descending order, for example
+// "?sort=-created_at,name". The filter parameters are expected to use the
+// "filter[<field>]=<value>" or the "filter[<field>][<op>]=<value>" form, the
+// former being equivalent to "filter[<field>][eq]=<value>".
+//
+// Only the known operators, and only the fields and operators that were
+// explicitly allowed by SortFields and FilterFields, will be accepted,
+// anything else will result in ReadQuery returning a QueryError.
+type SortFilter struct {
+	// Pointer to the ListQuery which should be set from the query parameters.
+	Val *ListQuery
+	// The names of the fields that can be used for sorting.
+	SortFields []string
+	// The names of the fields that can be used for filtering mapped to
+	// the operators allowed for each field. A nil list of operators
+	// allows only the OpEq operator.
+	FilterFields map[string][]FilterOp
+}
+
+// ReadQuery implements the QueryReader interface.
+func (rr SortFilter) ReadQuery(query url.Values) error {
+	var lq ListQuery
+
+	for _, s := range strings.Split(query.Get("sort"), ",") {
+		if s = strings.TrimSpace(s); len(s) == 0 {
+			continue
+		}
+
+		sf := SortField{Field: s}
+		if s[0] == '-' {
+			sf = SortField{Field: s[1:], Desc: true}
+		}
+		if !containsString(rr.SortFields, sf.Field) {
+			return QueryError{Param: "sort", Field: sf.Field, Reason: "unknown sort field"}
+		}
+		lq.Sort = append(lq.Sort, sf)
+	}
+
+	keys := make([]string, 0, len(query))
+	for key := range query {
+		if strings.HasPrefix(key, "filter[") {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		field, op, ok := parseFilterKey(key)
+		if !ok {
+			return QueryError{Param: key, Reason: "malformed filter parameter"}
+		}
+		ops, ok := rr.FilterFields[field]
+		if !ok {
+			return QueryError{Param: key, Field: field, Reason: "unknown filter field"}
+		}
+		if !containsFilterOp(filterOps, op) {
+			return QueryError{Param: key, Field: field, Op: string(op), Reason: "unknown filter operator"}
+		}
+		if !(op == OpEq && ops == nil) && !containsFilterOp(ops, op) {
+			return QueryError{Param: key, Field: field, Op: string(op), Reason: "unsupported filter operator"}
+		}
+		for _, val := range query[key] {
+			lq.Filter = append(lq.Filter, FilterCond{Field: field, Op: op, Value: val})
+		}
+	}
+
+	*rr.Val = lq
+	return nil
+}
+
+// parseFilterKey parses the given "filter[<field>]" or "filter[<field>][<op>]"
+// query parameter key and returns the field and the operator.
+func parseFilterKey(key string) (field string, op FilterOp, ok bool) {
+	rest := strings.TrimPrefix(key, "filter[")
+	i := strings.IndexByte(rest, ']')
+	if i < 1 {
+		return "", "", false
+	}
+	field, rest = rest[:i], rest[i+1:]
+	if len(rest) == 0 {
+		return field, OpEq, true
+	}
+	if len(rest) < 3 || rest[0] != '[' || rest[len(rest)-1] != ']' {
+		return "", "", false
+	}
+	op = FilterOp(rest[1 : len(rest)-1])
+	if strings.ContainsAny(string(op), "[]") {
+		return "", "", false
+	}
+	return field, op, true
+}
+
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+func containsFilterOp(list []FilterOp, op FilterOp) bool {
+	for _, v := range list {
+		if v == op {
+			return true
+		}
+	}
+	return false
+}
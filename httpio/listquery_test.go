@@ -0,0 +1,92 @@
+package httpio
+
+import (
+	"net/url"
+	"testing"
+
+	"github.com/frk/compare"
+)
+
+func TestSortFilter_ReadQuery(t *testing.T) {
+	reader := func(lq *ListQuery) SortFilter {
+		return SortFilter{
+			Val:        lq,
+			SortFields: []string{"created_at", "name"},
+			FilterFields: map[string][]FilterOp{
+				"status": nil,
+				"age":    {OpGte, OpLt},
+				"id":     {OpEq, OpIn, "regex"},
+			},
+		}
+	}
+
+	tests := []struct {
+		name  string
+		query url.Values
+		want  ListQuery
+		err   error
+	}{{
+		name:  "empty",
+		query: url.Values{},
+		want:  ListQuery{},
+	}, {
+		name:  "sort",
+		query: url.Values{"sort": {"-created_at,name"}},
+		want: ListQuery{Sort: []SortField{
+			{Field: "created_at", Desc: true},
+			{Field: "name"},
+		}},
+	}, {
+		name: "filter",
+		query: url.Values{
+			"filter[status]":   {"active"},
+			"filter[age][gte]": {"18"},
+			"filter[id][in]":   {"1,2,3"},
+		},
+		want: ListQuery{Filter: []FilterCond{
+			{Field: "age", Op: OpGte, Value: "18"},
+			{Field: "id", Op: OpIn, Value: "1,2,3"},
+			{Field: "status", Op: OpEq, Value: "active"},
+		}},
+	}, {
+		name:  "unknown sort field",
+		query: url.Values{"sort": {"name,-password"}},
+		err:   QueryError{Param: "sort", Field: "password", Reason: "unknown sort field"},
+	}, {
+		name:  "unknown filter field",
+		query: url.Values{"filter[password]": {"x"}},
+		err:   QueryError{Param: "filter[password]", Field: "password", Reason: "unknown filter field"},
+	}, {
+		name:  "unsupported operator",
+		query: url.Values{"filter[status][gt]": {"x"}},
+		err: QueryError{Param: "filter[status][gt]", Field: "status", Op: "gt",
+			Reason: "unsupported filter operator"},
+	}, {
+		name:  "implicit eq not allowed",
+		query: url.Values{"filter[age]": {"18"}},
+		err: QueryError{Param: "filter[age]", Field: "age", Op: "eq",
+			Reason: "unsupported filter operator"},
+	}, {
+		name:  "unknown operator",
+		query: url.Values{"filter[id][regex]": {"^a"}},
+		err: QueryError{Param: "filter[id][regex]", Field: "id", Op: "regex",
+			Reason: "unknown filter operator"},
+	}, {
+		name:  "malformed filter",
+		query: url.Values{"filter[age][gte": {"18"}},
+		err:   QueryError{Param: "filter[age][gte", Reason: "malformed filter parameter"},
+	}}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var lq ListQuery
+			err := reader(&lq).ReadQuery(tt.query)
+			if e := compare.Compare(err, tt.err); e != nil {
+				t.Error(e)
+			}
+			if e := compare.Compare(lq, tt.want); e != nil {
+				t.Error(e)
+			}
+		})
+	}
+}
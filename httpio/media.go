@@ -0,0 +1,308 @@
+package httpio
+
+import (
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// MediaReader associates a media type with a BodyReader constructor.
+type MediaReader struct {
+	// The media type, without parameters, e.g. "application/json".
+	Type string
+	// New returns a BodyReader that decodes a request body
+	// of the associated media type into val.
+	New func(val interface{}) BodyReader
+}
+
+// The AnyBody type implements the BodyReader interface by decoding the request's
+// body using the MediaReader that matches the request's Content-Type header.
+//
+// If there's no MediaReader for the exact media type, but the media type has
+// a structured syntax suffix, e.g. "application/vnd.api+json", then the
+// MediaReader for the suffix's base type, e.g. "application/json", is used.
+type AnyBody struct {
+	// A pointer to the value to be decoded from an HTTP request's body.
+	Val interface{}
+	// The list of supported media types. If not set, the
+	// media types of the registered Codecs will be supported.
+	Readers []MediaReader
+}
+
+// ReadBody implements the BodyReader interface. If the request's media type
+// is not supported, an UnsupportedMediaTypeError will be returned.
+func (b AnyBody) ReadBody(r *http.Request) error {
+	readers := b.Readers
+	if readers == nil {
+		readers = codecMediaReaders()
+	}
+
+	mtype := requestMediaType(r)
+	if mr, ok := findMediaReader(readers, mtype); ok {
+		return mr.New(b.Val).ReadBody(r)
+	}
+
+	accepted := make([]string, len(readers))
+	for i, mr := range readers {
+		accepted[i] = mr.Type
+	}
+	return UnsupportedMediaTypeError{MediaType: mtype, Accepted: accepted}
+}
+
+// findMediaReader returns the MediaReader for the given media type.
+func findMediaReader(readers []MediaReader, mtype string) (MediaReader, bool) {
+	for _, mr := range readers {
+		if strings.EqualFold(mr.Type, mtype) {
+			return mr, true
+		}
+	}
+	if base := suffixMediaType(mtype); len(base) > 0 {
+		for _, mr := range readers {
+			if strings.EqualFold(mr.Type, base) {
+				return mr, true
+			}
+		}
+	}
+	return MediaReader{}, false
+}
+
+// requestMediaType returns the lower-cased media type of the given
+// request's Content-Type header, without parameters.
+func requestMediaType(r *http.Request) string {
+	return baseMediaType(r.Header.Get("Content-Type"))
+}
+
+// codecMediaReaders returns a MediaReader for each of the registered Codecs.
+func codecMediaReaders() []MediaReader {
+	codecs := Codecs()
+	readers := make([]MediaReader, len(codecs))
+	for i, c := range codecs {
+		c := c
+		readers[i] = MediaReader{Type: baseMediaType(c.MediaType()), New: func(v interface{}) BodyReader {
+			return codecReader{c, v}
+		}}
+	}
+	return readers
+}
+
+// codecMediaWriters returns a MediaWriter for each of the registered Codecs.
+func codecMediaWriters() []MediaWriter {
+	codecs := Codecs()
+	writers := make([]MediaWriter, len(codecs))
+	for i, c := range codecs {
+		c := c
+		writers[i] = MediaWriter{Type: baseMediaType(c.MediaType()), New: func(v interface{}) BodyWriter {
+			return Body{Val: v, Type: c.MediaType()}
+		}}
+	}
+	return writers
+}
+
+// codecReader implements the BodyReader interface using a specific Codec.
+type codecReader struct {
+	c Codec
+	v interface{}
+}
+
+func (cr codecReader) ReadBody(r *http.Request) error {
+	return decodeBody(cr.c, r, cr.v)
+}
+
+// suffixMediaType returns the base media type of the structured syntax suffix
+// of the given media type, e.g. "application/json" for "application/ld+json".
+// If the media type has no suffix, an empty string is returned.
+func suffixMediaType(mtype string) string {
+	i := strings.LastIndexByte(mtype, '+')
+	if i < 0 || strings.IndexByte(mtype, '/') > i {
+		return ""
+	}
+	return "application/" + mtype[i+1:]
+}
+
+// MediaWriter associates a media type with a BodyWriter constructor.
+type MediaWriter struct {
+	// The media type, without parameters, e.g. "application/json".
+	Type string
+	// New returns a BodyWriter that encodes val as
+	// a response body of the associated media type.
+	New func(val interface{}) BodyWriter
+}
+
+// The Negotiate type implements the BodyWriter interface by encoding the
+// value using the MediaWriter that best matches the request's Accept header.
+//
+// The Accept header's media ranges are matched by their specificity, with
+// wildcards and q-values interpreted as specified by RFC 7231. When multiple
+// MediaWriters are equally acceptable to the client the one listed first is
+// used, and if the request has no Accept header the first MediaWriter is used.
+type Negotiate struct {
+	// The value to be encoded and sent in an HTTP response body.
+	Val interface{}
+	// If set, the value can also be rendered as "text/html" using the
+	// template with this name as registered with RegisterHTMLTemplatesOnce.
+	Template string
+	// The list of supported media types. If not set, the media
+	// types of the registered Codecs will be supported.
+	Writers []MediaWriter
+}
+
+// WriteInit is a noop, required only to satisfy the BodyWriter interface.
+func (Negotiate) WriteInit(_ http.ResponseWriter) error {
+	return nil
+}
+
+// WriteBody implements the BodyWriter interface. If none of the supported media
+// types is acceptable to the client a NotAcceptableError will be returned
+// before anything is written to the response.
+func (n Negotiate) WriteBody(w http.ResponseWriter, r *http.Request, statusCode int) error {
+	writers := n.Writers
+	if writers == nil {
+		writers = codecMediaWriters()
+	}
+	if len(n.Template) > 0 {
+		writers = append(writers[:len(writers):len(writers)], MediaWriter{Type: "text/html",
+			New: func(v interface{}) BodyWriter { return HTML{n.Template, v} }})
+	}
+
+	addVary(w.Header(), "Accept")
+
+	var accept string
+	if r != nil {
+		accept = r.Header.Get("Accept")
+	}
+	if mw, ok := negotiateMediaWriter(writers, accept); ok {
+		return mw.New(n.Val).WriteBody(w, r, statusCode)
+	}
+
+	available := make([]string, len(writers))
+	for i, mw := range writers {
+		available[i] = mw.Type
+	}
+	return NotAcceptableError{Accept: accept, Available: available}
+}
+
+// negotiateMediaWriter returns the MediaWriter that best matches the given
+// Accept header value.
+func negotiateMediaWriter(writers []MediaWriter, accept string) (MediaWriter, bool) {
+	if len(writers) == 0 {
+		return MediaWriter{}, false
+	}
+	if len(strings.TrimSpace(accept)) == 0 {
+		return writers[0], true
+	}
+
+	ranges := parseAccept(accept)
+	best, bestq := -1, 0.0
+	for i, mw := range writers {
+		if q := acceptQuality(ranges, mw.Type); q > bestq {
+			best, bestq = i, q
+		}
+	}
+	if best < 0 {
+		return MediaWriter{}, false
+	}
+	return writers[best], true
+}
+
+// mediaRange represents a single media range of an Accept header.
+type mediaRange struct {
+	typ, subtype string
+	params       map[string]string
+	q            float64
+}
+
+// parseAccept parses the given Accept header value into a list
+// of media ranges. Malformed media ranges are skipped.
+func parseAccept(accept string) (ranges []mediaRange) {
+	for _, part := range strings.Split(accept, ",") {
+		fields := strings.Split(part, ";")
+		mtype := strings.ToLower(strings.TrimSpace(fields[0]))
+		i := strings.IndexByte(mtype, '/')
+		if i <= 0 || i == len(mtype)-1 {
+			continue
+		}
+
+		mr := mediaRange{typ: mtype[:i], subtype: mtype[i+1:], q: 1}
+		if mr.typ == "*" && mr.subtype != "*" {
+			continue
+		}
+		for _, p := range fields[1:] {
+			kv := strings.SplitN(p, "=", 2)
+			key := strings.ToLower(strings.TrimSpace(kv[0]))
+			if len(kv) != 2 || len(key) == 0 {
+				continue
+			}
+			val := strings.Trim(strings.TrimSpace(kv[1]), `"`)
+			if key == "q" {
+				// any parameters after q are accept-extensions
+				if q, err := strconv.ParseFloat(val, 64); err == nil && q >= 0 && q <= 1 {
+					mr.q = q
+				}
+				break
+			}
+			if mr.params == nil {
+				mr.params = make(map[string]string)
+			}
+			mr.params[key] = val
+		}
+		ranges = append(ranges, mr)
+	}
+	return ranges
+}
+
+// acceptQuality returns the q-value of the most specific media range
+// in ranges that matches the given media type.
+func acceptQuality(ranges []mediaRange, mtype string) float64 {
+	mtype, params, err := mime.ParseMediaType(mtype)
+	if err != nil {
+		return 0
+	}
+	i := strings.IndexByte(mtype, '/')
+	typ, subtype := mtype[:i], mtype[i+1:]
+
+	q, spec := 0.0, -1
+	for _, mr := range ranges {
+		var s int
+		switch {
+		case mr.typ == "*":
+			s = 0
+		case mr.typ == typ && mr.subtype == "*":
+			s = 1
+		case mr.typ == typ && mr.subtype == subtype:
+			s = 2
+		default:
+			continue
+		}
+
+		match := true
+		for k, v := range mr.params {
+			// The charset parameter is ignored since all
+			// of the package's BodyWriters produce utf-8.
+			if k == "charset" {
+				continue
+			}
+			if !strings.EqualFold(params[k], v) {
+				match = false
+				break
+			}
+			s++
+		}
+		if match && s > spec {
+			q, spec = mr.q, s
+		}
+	}
+	return q
+}
+
+// addVary adds the given header name to the Vary header unless already present.
+func addVary(header http.Header, name string) {
+	for _, v := range header["Vary"] {
+		for _, f := range strings.Split(v, ",") {
+			if f = strings.TrimSpace(f); f == "*" || strings.EqualFold(f, name) {
+				return
+			}
+		}
+	}
+	header.Add("Vary", name)
+}
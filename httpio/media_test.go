@@ -0,0 +1,193 @@
+package httpio
+
+import (
+	"encoding/xml"
+	"html/template"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/frk/compare"
+)
+
+func TestAnyBody_ReadBody(t *testing.T) {
+	tests := []struct {
+		name  string
+		ctype string
+		body  string
+		any   AnyBody
+		want  interface{}
+		err   error
+	}{{
+		name:  "json",
+		ctype: "application/json; charset=utf-8",
+		body:  `{"foo":"test","bar":0.004,"baz":true}`,
+		any:   AnyBody{Val: &testBody{}},
+		want:  &testBody{Foo: "test", Bar: 0.004, Baz: true},
+	}, {
+		name:  "json suffix",
+		ctype: "application/vnd.api+json",
+		body:  `{"foo":"test"}`,
+		any:   AnyBody{Val: &testBody{}},
+		want:  &testBody{Foo: "test"},
+	}, {
+		name:  "xml",
+		ctype: "text/xml",
+		body:  `<data><foo>test</foo><baz>true</baz></data>`,
+		any:   AnyBody{Val: &testBody{}},
+		want:  &testBody{XMLName: xml.Name{Local: "data"}, Foo: "test", Baz: true},
+	}, {
+		name:  "form",
+		ctype: "application/x-www-form-urlencoded",
+		body:  `foo=test&bar=0.004`,
+		any:   AnyBody{Val: &testBody{}},
+		want:  &testBody{Foo: "test", Bar: 0.004},
+	}, {
+		name:  "unsupported",
+		ctype: "image/png",
+		body:  `foo`,
+		any:   AnyBody{Val: &testBody{}},
+		want:  &testBody{},
+		err: UnsupportedMediaTypeError{MediaType: "image/png", Accepted: []string{
+			"application/json", "application/xml", "text/xml", "application/x-www-form-urlencoded",
+			"text/plain", "application/msgpack", "application/cbor"}},
+	}, {
+		name:  "custom readers",
+		ctype: "application/xml",
+		body:  `<data><foo>test</foo></data>`,
+		any: AnyBody{Val: &testBody{}, Readers: []MediaReader{
+			{Type: "application/json", New: func(v interface{}) BodyReader { return JSON{Val: v} }},
+		}},
+		want: &testBody{},
+		err:  UnsupportedMediaTypeError{MediaType: "application/xml", Accepted: []string{"application/json"}},
+	}, {
+		name: "missing content type",
+		body: `{}`,
+		any:  AnyBody{Val: &testBody{}, Readers: []MediaReader{}},
+		want: &testBody{},
+		err:  UnsupportedMediaTypeError{MediaType: "", Accepted: []string{}},
+	}}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := &http.Request{Header: http.Header{}, Body: strReadCloser{strings.NewReader(tt.body)}}
+			if len(tt.ctype) > 0 {
+				r.Header.Set("Content-Type", tt.ctype)
+			}
+
+			err := tt.any.ReadBody(r)
+			if e := compare.Compare(err, tt.err); e != nil {
+				t.Error(e)
+			}
+			if e := compare.Compare(tt.any.Val, tt.want); e != nil {
+				t.Error(e)
+			}
+		})
+	}
+}
+
+func TestNegotiate_WriteBody(t *testing.T) {
+	RegisterHTMLTemplatesOnce(map[string]*template.Template{
+		"page_a": template.Must(template.New("t").Parse(`<html><body>{{ . }}</body></html>`)),
+	})
+
+	val := testBody{Foo: "test", Bar: 0.004, Baz: true}
+	jsonBody := `{"foo":"test","bar":0.004,"baz":true}` + "\n"
+	xmlBody := `<data><foo>test</foo><bar>0.004</bar><baz>true</baz></data>`
+
+	tests := []struct {
+		name   string
+		accept string
+		neg    Negotiate
+		want   string
+		ctype  string
+		err    error
+	}{{
+		name:  "no accept header",
+		neg:   Negotiate{Val: val},
+		want:  jsonBody,
+		ctype: contentTypeJSON,
+	}, {
+		name:   "exact match",
+		accept: "application/xml",
+		neg:    Negotiate{Val: val},
+		want:   xmlBody,
+		ctype:  contentTypeXML,
+	}, {
+		name:   "q-values",
+		accept: "application/json;q=0.5, text/xml;q=0.9, */*;q=0.1",
+		neg:    Negotiate{Val: val},
+		want:   xmlBody,
+		ctype:  "text/xml; charset=utf-8",
+	}, {
+		name:   "specific range overrides wildcard",
+		accept: "application/*;q=0.2, application/json;q=0, text/plain;q=0.1",
+		neg:    Negotiate{Val: val},
+		want:   xmlBody,
+		ctype:  contentTypeXML,
+	}, {
+		name:   "wildcard",
+		accept: "*/*",
+		neg:    Negotiate{Val: val},
+		want:   jsonBody,
+		ctype:  contentTypeJSON,
+	}, {
+		name:   "charset parameter",
+		accept: "application/json; charset=utf-8",
+		neg:    Negotiate{Val: val},
+		want:   jsonBody,
+		ctype:  contentTypeJSON,
+	}, {
+		name:   "unmatched parameter",
+		accept: "application/json; version=2",
+		neg: Negotiate{Val: val, Writers: []MediaWriter{
+			{Type: "application/json", New: func(v interface{}) BodyWriter { return JSON{Val: v} }},
+		}},
+		err: NotAcceptableError{Accept: "application/json; version=2",
+			Available: []string{"application/json"}},
+	}, {
+		name:   "text",
+		accept: "text/plain",
+		neg:    Negotiate{Val: 123},
+		want:   "123",
+		ctype:  contentTypeText,
+	}, {
+		name:   "html template",
+		accept: "text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8",
+		neg:    Negotiate{Val: "Hello!", Template: "page_a"},
+		want:   `<html><body>Hello!</body></html>`,
+		ctype:  contentTypeHTML,
+	}, {
+		name:   "not acceptable",
+		accept: "image/png",
+		neg:    Negotiate{Val: val},
+		err: NotAcceptableError{Accept: "image/png", Available: []string{
+			"application/json", "application/xml", "text/xml", "application/x-www-form-urlencoded",
+			"text/plain", "application/msgpack", "application/cbor"}},
+	}}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/", nil)
+			if len(tt.accept) > 0 {
+				r.Header.Set("Accept", tt.accept)
+			}
+			w := httptest.NewRecorder()
+
+			err := tt.neg.WriteBody(w, r, http.StatusOK)
+			if e := compare.Compare(err, tt.err); e != nil {
+				t.Error(e)
+			}
+			if e := compare.Compare(w.Body.String(), tt.want); e != nil {
+				t.Error(e)
+			}
+			if e := compare.Compare(w.Header().Get("Content-Type"), tt.ctype); e != nil {
+				t.Error(e)
+			}
+			if e := compare.Compare(w.Header().Get("Vary"), "Accept"); e != nil {
+				t.Error(e)
+			}
+		})
+	}
+}
@@ -0,0 +1,926 @@
+package httpio
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"reflect"
+	"sort"
+	"time"
+)
+
+// The MsgPack type implements both the BodyWriter and the BodyReader interfaces.
+//
+// Values are encoded and decoded by reflection, struct fields are mapped using
+// the "msgpack" struct tag, falling back to the "json" struct tag, and falling
+// back to the field's name. Both tags support the "omitempty" option. The
+// time.Time values are encoded using the MessagePack timestamp extension type
+// and MsgPackExt can be used to encode and decode any other extension type.
+type MsgPack struct {
+	// The value to be msgpack encoded and sent in an HTTP response body or
+	// a pointer to the value to be msgpack decoded from an HTTP request's body.
+	Val interface{}
+}
+
+// ReadBody implements the BodyReader interface by decoding the request's
+// msgpack body into the reciever's Val field using the Codec registered
+// for the "application/msgpack" media type.
+func (m MsgPack) ReadBody(r *http.Request) error {
+	return decodeBody(mustLookupCodec(contentTypeMsgPack), r, m.Val)
+}
+
+// WriteInit is a noop, required only to satisfy the BodyWriter interface.
+func (MsgPack) WriteInit(_ http.ResponseWriter) error {
+	return nil
+}
+
+const contentTypeMsgPack = "application/msgpack"
+
+// WriteBody implements the BodyWriter interface by msgpack encoding the
+// receiver's Val field, using the Codec registered for the "application/msgpack"
+// media type, and sending the result in the response's body.
+func (m MsgPack) WriteBody(w http.ResponseWriter, r *http.Request, statusCode int) error {
+	return encodeBody(mustLookupCodec(contentTypeMsgPack), w, statusCode, m.Val)
+}
+
+// MsgPackExt represents a MessagePack extension type value.
+type MsgPackExt struct {
+	// The application-specific type of the extension, the negative
+	// values are reserved by the MessagePack specification.
+	Type int8
+	// The extension's data.
+	Data []byte
+}
+
+// msgpackCodec implements the Codec interface for the MessagePack format.
+type msgpackCodec struct{}
+
+func (msgpackCodec) MediaType() string              { return contentTypeMsgPack }
+func (msgpackCodec) NewDecoder(r io.Reader) Decoder { return &msgpackDecoder{r: bufio.NewReader(r)} }
+func (msgpackCodec) NewEncoder(w io.Writer) Encoder { return &msgpackEncoder{w: w} }
+
+// The MessagePack format codes.
+const (
+	mpNil      = 0xc0
+	mpFalse    = 0xc2
+	mpTrue     = 0xc3
+	mpBin8     = 0xc4
+	mpBin16    = 0xc5
+	mpBin32    = 0xc6
+	mpExt8     = 0xc7
+	mpExt16    = 0xc8
+	mpExt32    = 0xc9
+	mpFloat32  = 0xca
+	mpFloat64  = 0xcb
+	mpUint8    = 0xcc
+	mpUint16   = 0xcd
+	mpUint32   = 0xce
+	mpUint64   = 0xcf
+	mpInt8     = 0xd0
+	mpInt16    = 0xd1
+	mpInt32    = 0xd2
+	mpInt64    = 0xd3
+	mpFixExt1  = 0xd4
+	mpFixExt2  = 0xd5
+	mpFixExt4  = 0xd6
+	mpFixExt8  = 0xd7
+	mpFixExt16 = 0xd8
+	mpStr8     = 0xd9
+	mpStr16    = 0xda
+	mpStr32    = 0xdb
+	mpArray16  = 0xdc
+	mpArray32  = 0xdd
+	mpMap16    = 0xde
+	mpMap32    = 0xdf
+
+	// The extension type of the MessagePack timestamp.
+	mpTimestampExt = -1
+)
+
+var (
+	timeType       = reflect.TypeOf(time.Time{})
+	msgpackExtType = reflect.TypeOf(MsgPackExt{})
+)
+
+// msgpackEncoder implements the Encoder interface for the MessagePack format.
+type msgpackEncoder struct {
+	w   io.Writer
+	buf bytes.Buffer
+}
+
+// Encode writes the MessagePack encoding of v to the underlying io.Writer.
+func (e *msgpackEncoder) Encode(v interface{}) error {
+	e.buf.Reset()
+	if err := e.encode(reflect.ValueOf(v)); err != nil {
+		return err
+	}
+	_, err := e.w.Write(e.buf.Bytes())
+	return err
+}
+
+func (e *msgpackEncoder) encode(v reflect.Value) error {
+	if !v.IsValid() {
+		e.buf.WriteByte(mpNil)
+		return nil
+	}
+
+	switch v.Type() {
+	case timeType:
+		e.encodeTime(v.Interface().(time.Time))
+		return nil
+	case msgpackExtType:
+		ext := v.Interface().(MsgPackExt)
+		e.encodeExt(ext.Type, ext.Data)
+		return nil
+	}
+
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		if v.IsNil() {
+			e.buf.WriteByte(mpNil)
+			return nil
+		}
+		return e.encode(v.Elem())
+	case reflect.Bool:
+		if v.Bool() {
+			e.buf.WriteByte(mpTrue)
+		} else {
+			e.buf.WriteByte(mpFalse)
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		e.encodeInt(v.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		e.encodeUint(v.Uint())
+	case reflect.Float32:
+		e.buf.WriteByte(mpFloat32)
+		e.writeUint32(math.Float32bits(float32(v.Float())))
+	case reflect.Float64:
+		e.buf.WriteByte(mpFloat64)
+		e.writeUint64(math.Float64bits(v.Float()))
+	case reflect.String:
+		e.encodeStrHeader(v.Len())
+		e.buf.WriteString(v.String())
+	case reflect.Slice:
+		if v.IsNil() {
+			e.buf.WriteByte(mpNil)
+			return nil
+		}
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			e.encodeBinHeader(v.Len())
+			e.buf.Write(v.Bytes())
+			return nil
+		}
+		fallthrough
+	case reflect.Array:
+		if v.Type().Elem().Kind() == reflect.Uint8 && v.Kind() == reflect.Array {
+			e.encodeBinHeader(v.Len())
+			for i := 0; i < v.Len(); i++ {
+				e.buf.WriteByte(byte(v.Index(i).Uint()))
+			}
+			return nil
+		}
+		e.encodeArrayHeader(v.Len())
+		for i := 0; i < v.Len(); i++ {
+			if err := e.encode(v.Index(i)); err != nil {
+				return err
+			}
+		}
+	case reflect.Map:
+		if v.IsNil() {
+			e.buf.WriteByte(mpNil)
+			return nil
+		}
+		keys := v.MapKeys()
+		if v.Type().Key().Kind() == reflect.String {
+			// sort the keys to make the output deterministic
+			sort.Slice(keys, func(i, j int) bool { return keys[i].String() < keys[j].String() })
+		}
+		e.encodeMapHeader(len(keys))
+		for _, k := range keys {
+			if err := e.encode(k); err != nil {
+				return err
+			}
+			if err := e.encode(v.MapIndex(k)); err != nil {
+				return err
+			}
+		}
+	case reflect.Struct:
+		fields := structFields(v.Type(), "msgpack", "json")
+		vals := make([]reflect.Value, 0, len(fields))
+		names := make([]string, 0, len(fields))
+		for _, f := range fields {
+			fv := fieldByIndex(v, f.index)
+			if !fv.IsValid() || (f.omitEmpty && isEmptyValue(fv)) {
+				continue
+			}
+			vals = append(vals, fv)
+			names = append(names, f.name)
+		}
+		e.encodeMapHeader(len(vals))
+		for i, fv := range vals {
+			e.encodeStrHeader(len(names[i]))
+			e.buf.WriteString(names[i])
+			if err := e.encode(fv); err != nil {
+				return err
+			}
+		}
+	default:
+		return fmt.Errorf("msgpack: unsupported type %s", v.Type())
+	}
+	return nil
+}
+
+func (e *msgpackEncoder) encodeInt(i int64) {
+	switch {
+	case i >= 0:
+		e.encodeUint(uint64(i))
+	case i >= -32:
+		e.buf.WriteByte(byte(i))
+	case i >= math.MinInt8:
+		e.buf.WriteByte(mpInt8)
+		e.buf.WriteByte(byte(i))
+	case i >= math.MinInt16:
+		e.buf.WriteByte(mpInt16)
+		e.writeUint16(uint16(i))
+	case i >= math.MinInt32:
+		e.buf.WriteByte(mpInt32)
+		e.writeUint32(uint32(i))
+	default:
+		e.buf.WriteByte(mpInt64)
+		e.writeUint64(uint64(i))
+	}
+}
+
+func (e *msgpackEncoder) encodeUint(u uint64) {
+	switch {
+	case u <= 0x7f:
+		e.buf.WriteByte(byte(u))
+	case u <= math.MaxUint8:
+		e.buf.WriteByte(mpUint8)
+		e.buf.WriteByte(byte(u))
+	case u <= math.MaxUint16:
+		e.buf.WriteByte(mpUint16)
+		e.writeUint16(uint16(u))
+	case u <= math.MaxUint32:
+		e.buf.WriteByte(mpUint32)
+		e.writeUint32(uint32(u))
+	default:
+		e.buf.WriteByte(mpUint64)
+		e.writeUint64(u)
+	}
+}
+
+func (e *msgpackEncoder) encodeStrHeader(n int) {
+	switch {
+	case n < 32:
+		e.buf.WriteByte(0xa0 | byte(n))
+	case n <= math.MaxUint8:
+		e.buf.WriteByte(mpStr8)
+		e.buf.WriteByte(byte(n))
+	case n <= math.MaxUint16:
+		e.buf.WriteByte(mpStr16)
+		e.writeUint16(uint16(n))
+	default:
+		e.buf.WriteByte(mpStr32)
+		e.writeUint32(uint32(n))
+	}
+}
+
+func (e *msgpackEncoder) encodeBinHeader(n int) {
+	switch {
+	case n <= math.MaxUint8:
+		e.buf.WriteByte(mpBin8)
+		e.buf.WriteByte(byte(n))
+	case n <= math.MaxUint16:
+		e.buf.WriteByte(mpBin16)
+		e.writeUint16(uint16(n))
+	default:
+		e.buf.WriteByte(mpBin32)
+		e.writeUint32(uint32(n))
+	}
+}
+
+func (e *msgpackEncoder) encodeArrayHeader(n int) {
+	switch {
+	case n < 16:
+		e.buf.WriteByte(0x90 | byte(n))
+	case n <= math.MaxUint16:
+		e.buf.WriteByte(mpArray16)
+		e.writeUint16(uint16(n))
+	default:
+		e.buf.WriteByte(mpArray32)
+		e.writeUint32(uint32(n))
+	}
+}
+
+func (e *msgpackEncoder) encodeMapHeader(n int) {
+	switch {
+	case n < 16:
+		e.buf.WriteByte(0x80 | byte(n))
+	case n <= math.MaxUint16:
+		e.buf.WriteByte(mpMap16)
+		e.writeUint16(uint16(n))
+	default:
+		e.buf.WriteByte(mpMap32)
+		e.writeUint32(uint32(n))
+	}
+}
+
+func (e *msgpackEncoder) encodeExt(typ int8, data []byte) {
+	switch n := len(data); {
+	case n == 1:
+		e.buf.WriteByte(mpFixExt1)
+	case n == 2:
+		e.buf.WriteByte(mpFixExt2)
+	case n == 4:
+		e.buf.WriteByte(mpFixExt4)
+	case n == 8:
+		e.buf.WriteByte(mpFixExt8)
+	case n == 16:
+		e.buf.WriteByte(mpFixExt16)
+	case n <= math.MaxUint8:
+		e.buf.WriteByte(mpExt8)
+		e.buf.WriteByte(byte(n))
+	case n <= math.MaxUint16:
+		e.buf.WriteByte(mpExt16)
+		e.writeUint16(uint16(n))
+	default:
+		e.buf.WriteByte(mpExt32)
+		e.writeUint32(uint32(n))
+	}
+	e.buf.WriteByte(byte(typ))
+	e.buf.Write(data)
+}
+
+// encodeTime encodes t using the smallest of the timestamp 32, 64 and 96 formats.
+func (e *msgpackEncoder) encodeTime(t time.Time) {
+	sec, nsec := t.Unix(), int64(t.Nanosecond())
+	switch {
+	case sec>>34 == 0 && nsec == 0 && sec <= math.MaxUint32:
+		data := make([]byte, 4)
+		binary.BigEndian.PutUint32(data, uint32(sec))
+		e.encodeExt(mpTimestampExt, data)
+	case sec>>34 == 0:
+		data := make([]byte, 8)
+		binary.BigEndian.PutUint64(data, uint64(nsec)<<34|uint64(sec))
+		e.encodeExt(mpTimestampExt, data)
+	default:
+		data := make([]byte, 12)
+		binary.BigEndian.PutUint32(data, uint32(nsec))
+		binary.BigEndian.PutUint64(data[4:], uint64(sec))
+		e.encodeExt(mpTimestampExt, data)
+	}
+}
+
+func (e *msgpackEncoder) writeUint16(u uint16) {
+	var b [2]byte
+	binary.BigEndian.PutUint16(b[:], u)
+	e.buf.Write(b[:])
+}
+
+func (e *msgpackEncoder) writeUint32(u uint32) {
+	var b [4]byte
+	binary.BigEndian.PutUint32(b[:], u)
+	e.buf.Write(b[:])
+}
+
+func (e *msgpackEncoder) writeUint64(u uint64) {
+	var b [8]byte
+	binary.BigEndian.PutUint64(b[:], u)
+	e.buf.Write(b[:])
+}
+
+// msgpackDecoder implements the Decoder interface for the MessagePack format.
+type msgpackDecoder struct {
+	r *bufio.Reader
+	// the nesting depth of the value being decoded
+	depth int
+}
+
+// maxDecodeDepth is the maximum nesting depth of the values decoded
+// by the package's decoders, it protects the decoders from exhausting
+// the stack when decoding deeply nested input.
+const maxDecodeDepth = 10000
+
+// Decode reads the next MessagePack encoded value from the underlying
+// io.Reader and stores it in the value pointed to by v.
+func (d *msgpackDecoder) Decode(v interface{}) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() {
+		return fmt.Errorf("msgpack: cannot decode into non-pointer %T", v)
+	}
+	return d.decode(rv.Elem())
+}
+
+func (d *msgpackDecoder) decode(v reflect.Value) error {
+	if d.depth++; d.depth > maxDecodeDepth {
+		return errors.New("msgpack: exceeded max depth")
+	}
+	defer func() { d.depth-- }()
+
+	c, err := d.peekCode()
+	if err != nil {
+		return err
+	}
+
+	if c == mpNil {
+		d.r.ReadByte()
+		switch v.Kind() {
+		case reflect.Ptr, reflect.Interface, reflect.Map, reflect.Slice:
+			v.Set(reflect.Zero(v.Type()))
+		}
+		return nil
+	}
+
+	if v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			v.Set(reflect.New(v.Type().Elem()))
+		}
+		return d.decode(v.Elem())
+	}
+	if v.Kind() == reflect.Interface && v.NumMethod() == 0 {
+		x, err := d.decodeInterface()
+		if err != nil {
+			return err
+		}
+		if x != nil {
+			v.Set(reflect.ValueOf(x))
+		} else {
+			v.Set(reflect.Zero(v.Type()))
+		}
+		return nil
+	}
+
+	switch v.Type() {
+	case timeType, msgpackExtType:
+		typ, data, err := d.readExt()
+		if err != nil {
+			return err
+		}
+		if v.Type() == msgpackExtType {
+			v.Set(reflect.ValueOf(MsgPackExt{Type: typ, Data: data}))
+			return nil
+		}
+		if typ != mpTimestampExt {
+			return fmt.Errorf("msgpack: cannot decode extension type %d into time.Time", typ)
+		}
+		t, err := decodeMsgPackTime(data)
+		if err != nil {
+			return err
+		}
+		v.Set(reflect.ValueOf(t))
+		return nil
+	}
+
+	switch v.Kind() {
+	case reflect.Bool:
+		d.r.ReadByte()
+		switch c {
+		case mpTrue:
+			v.SetBool(true)
+		case mpFalse:
+			v.SetBool(false)
+		default:
+			return d.typeError(c, v.Type())
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		i, u, signed, err := d.readInt()
+		if err != nil {
+			return err
+		}
+		if (!signed && u > math.MaxInt64) || v.OverflowInt(i) {
+			return d.typeError(c, v.Type())
+		}
+		v.SetInt(i)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		i, u, signed, err := d.readInt()
+		if err != nil {
+			return err
+		}
+		if (signed && i < 0) || v.OverflowUint(u) {
+			return d.typeError(c, v.Type())
+		}
+		v.SetUint(u)
+	case reflect.Float32, reflect.Float64:
+		f, err := d.readFloat()
+		if err != nil {
+			return err
+		}
+		v.SetFloat(f)
+	case reflect.String:
+		b, err := d.readBytes()
+		if err != nil {
+			return err
+		}
+		v.SetString(string(b))
+	case reflect.Slice:
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			b, err := d.readBytes()
+			if err != nil {
+				return err
+			}
+			v.SetBytes(b)
+			return nil
+		}
+		n, err := d.readArrayLen()
+		if err != nil {
+			return err
+		}
+		s := reflect.MakeSlice(v.Type(), 0, capHint(n))
+		for i := 0; i < n; i++ {
+			ev := reflect.New(v.Type().Elem()).Elem()
+			if err := d.decode(ev); err != nil {
+				return err
+			}
+			s = reflect.Append(s, ev)
+		}
+		v.Set(s)
+	case reflect.Array:
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			b, err := d.readBytes()
+			if err != nil {
+				return err
+			}
+			reflect.Copy(v, reflect.ValueOf(b))
+			return nil
+		}
+		n, err := d.readArrayLen()
+		if err != nil {
+			return err
+		}
+		for i := 0; i < n; i++ {
+			if i < v.Len() {
+				if err := d.decode(v.Index(i)); err != nil {
+					return err
+				}
+			} else if _, err := d.decodeInterface(); err != nil {
+				return err
+			}
+		}
+	case reflect.Map:
+		n, err := d.readMapLen()
+		if err != nil {
+			return err
+		}
+		if v.IsNil() {
+			v.Set(reflect.MakeMap(v.Type()))
+		}
+		for i := 0; i < n; i++ {
+			kv := reflect.New(v.Type().Key()).Elem()
+			if err := d.decode(kv); err != nil {
+				return err
+			}
+			if unhashableMapKey(kv) {
+				return fmt.Errorf("msgpack: unhashable map key of type %s", kv.Elem().Type())
+			}
+			ev := reflect.New(v.Type().Elem()).Elem()
+			if err := d.decode(ev); err != nil {
+				return err
+			}
+			v.SetMapIndex(kv, ev)
+		}
+	case reflect.Struct:
+		n, err := d.readMapLen()
+		if err != nil {
+			return err
+		}
+		fields := structFields(v.Type(), "msgpack", "json")
+		for i := 0; i < n; i++ {
+			name, err := d.readBytes()
+			if err != nil {
+				return err
+			}
+			f, ok := findStructFieldFold(fields, string(name))
+			if !ok {
+				if _, err := d.decodeInterface(); err != nil {
+					return err
+				}
+				continue
+			}
+			fv, err := fieldByIndexAlloc(v, f.index)
+			if err != nil {
+				return fmt.Errorf("msgpack: %v", err)
+			}
+			if err := d.decode(fv); err != nil {
+				return err
+			}
+		}
+	default:
+		return d.typeError(c, v.Type())
+	}
+	return nil
+}
+
+// decodeInterface decodes the next value into its natural Go representation:
+// nil, bool, int64, uint64 (only if it overflows int64), float64, string, []byte,
+// []interface{}, map[string]interface{} (or map[interface{}]interface{} if
+// any of the keys is not a string), time.Time or MsgPackExt.
+func (d *msgpackDecoder) decodeInterface() (interface{}, error) {
+	if d.depth++; d.depth > maxDecodeDepth {
+		return nil, errors.New("msgpack: exceeded max depth")
+	}
+	defer func() { d.depth-- }()
+
+	c, err := d.peekCode()
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case c == mpNil:
+		d.r.ReadByte()
+		return nil, nil
+	case c == mpTrue || c == mpFalse:
+		d.r.ReadByte()
+		return c == mpTrue, nil
+	case c <= 0x7f || c >= 0xe0 || (c >= mpUint8 && c <= mpInt64):
+		i, u, signed, err := d.readInt()
+		if !signed && u > math.MaxInt64 {
+			return u, err
+		}
+		return i, err
+	case c == mpFloat32 || c == mpFloat64:
+		return d.readFloat()
+	case (c >= 0xa0 && c <= 0xbf) || (c >= mpStr8 && c <= mpStr32):
+		b, err := d.readBytes()
+		return string(b), err
+	case c >= mpBin8 && c <= mpBin32:
+		return d.readBytes()
+	case (c >= 0x90 && c <= 0x9f) || c == mpArray16 || c == mpArray32:
+		n, err := d.readArrayLen()
+		if err != nil {
+			return nil, err
+		}
+		s := make([]interface{}, 0, capHint(n))
+		for i := 0; i < n; i++ {
+			x, err := d.decodeInterface()
+			if err != nil {
+				return nil, err
+			}
+			s = append(s, x)
+		}
+		return s, nil
+	case (c >= 0x80 && c <= 0x8f) || c == mpMap16 || c == mpMap32:
+		n, err := d.readMapLen()
+		if err != nil {
+			return nil, err
+		}
+		keys := make([]interface{}, 0, capHint(n))
+		vals := make([]interface{}, 0, capHint(n))
+		strkeys := true
+		for i := 0; i < n; i++ {
+			k, err := d.decodeInterface()
+			if err != nil {
+				return nil, err
+			}
+			if _, ok := k.(string); !ok {
+				strkeys = false
+			}
+			v, err := d.decodeInterface()
+			if err != nil {
+				return nil, err
+			}
+			keys, vals = append(keys, k), append(vals, v)
+		}
+		if strkeys {
+			m := make(map[string]interface{}, len(keys))
+			for i, k := range keys {
+				m[k.(string)] = vals[i]
+			}
+			return m, nil
+		}
+		m := make(map[interface{}]interface{}, len(keys))
+		for i, k := range keys {
+			if k != nil && !reflect.TypeOf(k).Comparable() {
+				return nil, fmt.Errorf("msgpack: unhashable map key of type %T", k)
+			}
+			m[k] = vals[i]
+		}
+		return m, nil
+	case (c >= mpFixExt1 && c <= mpFixExt16) || (c >= mpExt8 && c <= mpExt32):
+		typ, data, err := d.readExt()
+		if err != nil {
+			return nil, err
+		}
+		if typ == mpTimestampExt {
+			return decodeMsgPackTime(data)
+		}
+		return MsgPackExt{Type: typ, Data: data}, nil
+	}
+	return nil, fmt.Errorf("msgpack: invalid format code 0x%x", c)
+}
+
+func (d *msgpackDecoder) peekCode() (byte, error) {
+	b, err := d.r.Peek(1)
+	if err != nil {
+		return 0, err
+	}
+	return b[0], nil
+}
+
+// readInt reads an integer value. The signed result reports whether
+// the value was encoded using one of the signed integer formats, if it
+// is false then u holds the value and i holds the value converted to int64,
+// otherwise i holds the value and u holds the value converted to uint64.
+func (d *msgpackDecoder) readInt() (i int64, u uint64, signed bool, err error) {
+	c, err := d.r.ReadByte()
+	if err != nil {
+		return 0, 0, false, err
+	}
+	switch {
+	case c <= 0x7f:
+		return int64(c), uint64(c), false, nil
+	case c >= 0xe0:
+		i = int64(int8(c))
+		return i, uint64(i), true, nil
+	case c == mpUint8, c == mpUint16, c == mpUint32, c == mpUint64:
+		u, err = d.readUint(1 << (c - mpUint8))
+		return int64(u), u, false, err
+	case c == mpInt8, c == mpInt16, c == mpInt32, c == mpInt64:
+		n := 1 << (c - mpInt8)
+		u, err = d.readUint(n)
+		// sign-extend the n-byte value
+		i = int64(u<<(64-8*uint(n))) >> (64 - 8*uint(n))
+		return i, uint64(i), true, err
+	}
+	return 0, 0, false, fmt.Errorf("msgpack: cannot decode format code 0x%x into an integer", c)
+}
+
+func (d *msgpackDecoder) readFloat() (float64, error) {
+	c, err := d.peekCode()
+	if err != nil {
+		return 0, err
+	}
+	switch c {
+	case mpFloat32:
+		d.r.ReadByte()
+		u, err := d.readUint(4)
+		return float64(math.Float32frombits(uint32(u))), err
+	case mpFloat64:
+		d.r.ReadByte()
+		u, err := d.readUint(8)
+		return math.Float64frombits(u), err
+	}
+
+	i, u, signed, err := d.readInt()
+	if !signed {
+		return float64(u), err
+	}
+	return float64(i), err
+}
+
+// readBytes reads a str or bin value.
+func (d *msgpackDecoder) readBytes() ([]byte, error) {
+	c, err := d.r.ReadByte()
+	if err != nil {
+		return nil, err
+	}
+
+	var n uint64
+	switch {
+	case c >= 0xa0 && c <= 0xbf:
+		n = uint64(c & 0x1f)
+	case c == mpStr8 || c == mpBin8:
+		n, err = d.readUint(1)
+	case c == mpStr16 || c == mpBin16:
+		n, err = d.readUint(2)
+	case c == mpStr32 || c == mpBin32:
+		n, err = d.readUint(4)
+	default:
+		return nil, fmt.Errorf("msgpack: cannot decode format code 0x%x into a string or bytes", c)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return d.readN(n)
+}
+
+func (d *msgpackDecoder) readArrayLen() (int, error) {
+	c, err := d.r.ReadByte()
+	if err != nil {
+		return 0, err
+	}
+	switch {
+	case c >= 0x90 && c <= 0x9f:
+		return int(c & 0x0f), nil
+	case c == mpArray16:
+		n, err := d.readUint(2)
+		return int(n), err
+	case c == mpArray32:
+		n, err := d.readUint(4)
+		return int(n), err
+	}
+	return 0, fmt.Errorf("msgpack: cannot decode format code 0x%x into an array", c)
+}
+
+func (d *msgpackDecoder) readMapLen() (int, error) {
+	c, err := d.r.ReadByte()
+	if err != nil {
+		return 0, err
+	}
+	switch {
+	case c >= 0x80 && c <= 0x8f:
+		return int(c & 0x0f), nil
+	case c == mpMap16:
+		n, err := d.readUint(2)
+		return int(n), err
+	case c == mpMap32:
+		n, err := d.readUint(4)
+		return int(n), err
+	}
+	return 0, fmt.Errorf("msgpack: cannot decode format code 0x%x into a map or struct", c)
+}
+
+func (d *msgpackDecoder) readExt() (typ int8, data []byte, err error) {
+	c, err := d.r.ReadByte()
+	if err != nil {
+		return 0, nil, err
+	}
+
+	var n uint64
+	switch c {
+	case mpFixExt1, mpFixExt2, mpFixExt4, mpFixExt8, mpFixExt16:
+		n = 1 << (c - mpFixExt1)
+	case mpExt8:
+		n, err = d.readUint(1)
+	case mpExt16:
+		n, err = d.readUint(2)
+	case mpExt32:
+		n, err = d.readUint(4)
+	default:
+		return 0, nil, fmt.Errorf("msgpack: cannot decode format code 0x%x into an extension", c)
+	}
+	if err != nil {
+		return 0, nil, err
+	}
+
+	t, err := d.r.ReadByte()
+	if err != nil {
+		return 0, nil, err
+	}
+	data, err = d.readN(n)
+	return int8(t), data, err
+}
+
+// readUint reads an n-byte big-endian unsigned integer.
+func (d *msgpackDecoder) readUint(n int) (uint64, error) {
+	var b [8]byte
+	if _, err := io.ReadFull(d.r, b[8-n:]); err != nil {
+		return 0, unexpectedEOF(err)
+	}
+	return binary.BigEndian.Uint64(b[:]), nil
+}
+
+// readN reads the next n bytes. The buffer is grown as the data arrives
+// so that a bogus length cannot cause a large upfront allocation.
+func (d *msgpackDecoder) readN(n uint64) ([]byte, error) {
+	var buf bytes.Buffer
+	if n < 1<<16 {
+		buf.Grow(int(n))
+	}
+	if _, err := io.CopyN(&buf, d.r, int64(n)); err != nil {
+		return nil, unexpectedEOF(err)
+	}
+	return buf.Bytes(), nil
+}
+
+func (d *msgpackDecoder) typeError(c byte, t reflect.Type) error {
+	return fmt.Errorf("msgpack: cannot decode format code 0x%x into Go value of type %s", c, t)
+}
+
+// decodeMsgPackTime decodes the data of a timestamp extension value.
+func decodeMsgPackTime(data []byte) (time.Time, error) {
+	switch len(data) {
+	case 4:
+		return time.Unix(int64(binary.BigEndian.Uint32(data)), 0).UTC(), nil
+	case 8:
+		u := binary.BigEndian.Uint64(data)
+		return time.Unix(int64(u&(1<<34-1)), int64(u>>34)).UTC(), nil
+	case 12:
+		nsec := binary.BigEndian.Uint32(data)
+		sec := binary.BigEndian.Uint64(data[4:])
+		return time.Unix(int64(sec), int64(nsec)).UTC(), nil
+	}
+	return time.Time{}, fmt.Errorf("msgpack: invalid timestamp length %d", len(data))
+}
+
+// capHint returns the initial capacity for a container of n elements, it
+// limits the capacity so that a bogus length cannot cause a large allocation.
+func capHint(n int) int {
+	if n > 1024 {
+		return 1024
+	}
+	return n
+}
+
+func unexpectedEOF(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
@@ -0,0 +1,233 @@
+package httpio
+
+import (
+	"bytes"
+	"io"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/frk/compare"
+)
+
+type testMsgPackInner struct {
+	A int    `msgpack:"a"`
+	B string `msgpack:"b,omitempty"`
+}
+
+type testMsgPackUnexported struct {
+	A int
+}
+
+type testMsgPackEmbedded struct {
+	*testMsgPackUnexported
+	X int
+}
+
+type testMsgPack struct {
+	Name   string            `msgpack:"name"`
+	Count  uint16            `json:"count"`
+	Ratio  float64           `msgpack:"ratio,omitempty"`
+	Skip   string            `msgpack:"-"`
+	Tags   []string          `msgpack:"tags"`
+	Inner  *testMsgPackInner `msgpack:"inner"`
+	Attrs  map[string]int    `msgpack:"attrs"`
+	When   time.Time         `msgpack:"when"`
+	Ext    MsgPackExt        `msgpack:"ext"`
+	Bytes  []byte            `msgpack:"bytes"`
+	Plain  bool
+	hidden int
+}
+
+func TestMsgPack_Encode(t *testing.T) {
+	tests := []struct {
+		name string
+		val  interface{}
+		want []byte
+	}{
+		{name: "nil", val: nil, want: []byte{0xc0}},
+		{name: "true", val: true, want: []byte{0xc3}},
+		{name: "positive fixint", val: 127, want: []byte{0x7f}},
+		{name: "negative fixint", val: -32, want: []byte{0xe0}},
+		{name: "uint8", val: 200, want: []byte{0xcc, 0xc8}},
+		{name: "int8", val: -33, want: []byte{0xd0, 0xdf}},
+		{name: "uint16", val: uint16(0x1234), want: []byte{0xcd, 0x12, 0x34}},
+		{name: "int32", val: int32(math.MinInt32), want: []byte{0xd2, 0x80, 0, 0, 0}},
+		{name: "uint64", val: uint64(math.MaxUint64), want: []byte{0xcf, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff}},
+		{name: "float32", val: float32(1.5), want: []byte{0xca, 0x3f, 0xc0, 0, 0}},
+		{name: "fixstr", val: "abc", want: []byte{0xa3, 'a', 'b', 'c'}},
+		{name: "str8", val: strings.Repeat("x", 32), want: append([]byte{0xd9, 32}, strings.Repeat("x", 32)...)},
+		{name: "bin8", val: []byte{1, 2}, want: []byte{0xc4, 2, 1, 2}},
+		{name: "fixarray", val: []int{1, 2}, want: []byte{0x92, 1, 2}},
+		{name: "fixmap", val: map[string]int{"b": 2, "a": 1}, want: []byte{0x82, 0xa1, 'a', 1, 0xa1, 'b', 2}},
+		{name: "timestamp32", val: time.Unix(1, 0), want: []byte{0xd6, 0xff, 0, 0, 0, 1}},
+		{name: "timestamp64", val: time.Unix(1, 1), want: []byte{0xd7, 0xff, 0, 0, 0, 0x04, 0, 0, 0, 1}},
+		{name: "timestamp96", val: time.Unix(-1, 0), want: []byte{0xc7, 12, 0xff, 0, 0, 0, 0,
+			0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff}},
+		{name: "ext", val: MsgPackExt{Type: 5, Data: []byte{1, 2, 3}}, want: []byte{0xc7, 3, 5, 1, 2, 3}},
+		{name: "struct", val: testMsgPackInner{A: 1}, want: []byte{0x81, 0xa1, 'a', 1}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := (msgpackCodec{}).NewEncoder(&buf).Encode(tt.val); err != nil {
+				t.Fatal(err)
+			}
+			if e := compare.Compare(buf.Bytes(), tt.want); e != nil {
+				t.Error(e)
+			}
+		})
+	}
+}
+
+func TestMsgPack_RoundTrip(t *testing.T) {
+	in := testMsgPack{
+		Name:   "foo",
+		Count:  300,
+		Skip:   "skipped",
+		Tags:   []string{"a", "b"},
+		Inner:  &testMsgPackInner{A: -5, B: "bar"},
+		Attrs:  map[string]int{"x": 1, "y": 70000},
+		When:   time.Date(2021, 3, 4, 5, 6, 7, 8, time.UTC),
+		Ext:    MsgPackExt{Type: 42, Data: []byte("data")},
+		Bytes:  []byte{0, 1, 2},
+		Plain:  true,
+		hidden: 1,
+	}
+
+	w := httptest.NewRecorder()
+	if err := (MsgPack{in}).WriteBody(w, nil, http.StatusOK); err != nil {
+		t.Fatal(err)
+	}
+	if e := compare.Compare(w.Header().Get("Content-Type"), contentTypeMsgPack); e != nil {
+		t.Error(e)
+	}
+
+	var out testMsgPack
+	r := &http.Request{Body: strReadCloser{strings.NewReader(w.Body.String())}}
+	if err := (MsgPack{&out}).ReadBody(r); err != nil {
+		t.Fatal(err)
+	}
+
+	in.Skip, in.hidden = "", 0
+	if e := compare.Compare(out, in); e != nil {
+		t.Error(e)
+	}
+}
+
+func TestMsgPack_DecodeInterface(t *testing.T) {
+	var buf bytes.Buffer
+	val := map[string]interface{}{
+		"n": nil, "b": false, "i": -7, "u": uint64(math.MaxUint64),
+		"f": 1.25, "s": "str", "a": []interface{}{1, "x"},
+		"t": time.Unix(10, 0).UTC(),
+	}
+	if err := (msgpackCodec{}).NewEncoder(&buf).Encode(val); err != nil {
+		t.Fatal(err)
+	}
+
+	var out interface{}
+	if err := (msgpackCodec{}).NewDecoder(&buf).Decode(&out); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]interface{}{
+		"n": nil, "b": false, "i": int64(-7), "u": uint64(math.MaxUint64),
+		"f": 1.25, "s": "str", "a": []interface{}{int64(1), "x"},
+		"t": time.Unix(10, 0).UTC(),
+	}
+	if e := compare.Compare(out, want); e != nil {
+		t.Error(e)
+	}
+}
+
+func TestMsgPack_DecodeNilKey(t *testing.T) {
+	var out interface{}
+	data := []byte{0x82, 0x01, 0x01, 0xc0, 0x01}
+	if err := (msgpackCodec{}).NewDecoder(bytes.NewReader(data)).Decode(&out); err != nil {
+		t.Fatal(err)
+	}
+	want := map[interface{}]interface{}{int64(1): int64(1), nil: int64(1)}
+	if e := compare.Compare(out, want); e != nil {
+		t.Error(e)
+	}
+}
+
+func TestMsgPack_DecodeErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		data []byte
+		dest interface{}
+		err  string
+	}{{
+		name: "empty",
+		data: []byte{},
+		dest: new(int),
+		err:  io.EOF.Error(),
+	}, {
+		name: "truncated",
+		data: []byte{0xcd, 0x12},
+		dest: new(int),
+		err:  io.ErrUnexpectedEOF.Error(),
+	}, {
+		name: "overflow",
+		data: []byte{0xcd, 0x12, 0x34},
+		dest: new(int8),
+		err:  "msgpack: cannot decode format code 0xcd into Go value of type int8",
+	}, {
+		name: "negative into uint",
+		data: []byte{0xff},
+		dest: new(uint),
+		err:  "msgpack: cannot decode format code 0xff into Go value of type uint",
+	}, {
+		name: "string into int",
+		data: []byte{0xa1, 'a'},
+		dest: new(int),
+		err:  "msgpack: cannot decode format code 0xa1 into an integer",
+	}, {
+		name: "non-pointer",
+		data: []byte{0x01},
+		dest: 1,
+		err:  "msgpack: cannot decode into non-pointer int",
+	}, {
+		name: "unhashable key",
+		data: []byte{0x81, 0x91, 0x01, 0x01},
+		dest: new(interface{}),
+		err:  "msgpack: unhashable map key of type []interface {}",
+	}, {
+		name: "unhashable key typed",
+		data: []byte{0x81, 0x91, 0x01, 0x01},
+		dest: new(map[interface{}]interface{}),
+		err:  "msgpack: unhashable map key of type []interface {}",
+	}, {
+		name: "unexported embedded pointer",
+		data: []byte{0x81, 0xa1, 'A', 0x01},
+		dest: new(testMsgPackEmbedded),
+		err:  "msgpack: cannot set embedded pointer to unexported struct httpio.testMsgPackUnexported",
+	}, {
+		name: "max depth",
+		data: bytes.Repeat([]byte{0x91}, 1<<20),
+		dest: new(interface{}),
+		err:  "msgpack: exceeded max depth",
+	}, {
+		name: "max depth typed",
+		data: bytes.Repeat([]byte{0x91}, 1<<20),
+		dest: new([]interface{}),
+		err:  "msgpack: exceeded max depth",
+	}}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := (msgpackCodec{}).NewDecoder(bytes.NewReader(tt.data)).Decode(tt.dest)
+			if err == nil {
+				t.Fatal("expected error")
+			}
+			if e := compare.Compare(err.Error(), tt.err); e != nil {
+				t.Error(e)
+			}
+		})
+	}
+}
@@ -0,0 +1,280 @@
+package httpio
+
+import (
+	"io"
+	"io/ioutil"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/frk/form"
+)
+
+const contentTypeMultipart = "multipart/form-data"
+
+// The default maximum number of bytes of the non-file fields of a multipart body.
+const defaultMaxMultipartFieldBytes = 10 << 20
+
+// The Multipart type implements the BodyReader interface by reading a
+// "multipart/form-data" body. The regular fields are decoded into a struct,
+// like the Form reader does, and the files are spooled, one part at a time,
+// to temporary files on disk that are then made available through a FileSet.
+//
+// The spooled files are removed automatically once the request's context is
+// done, i.e. when the server has finished handling the request, therefore the
+// handler must not retain the files beyond that point. The handler may also
+// remove the files earlier by invoking the FileSet's RemoveAll method. Note
+// that a request without a cancelable context, e.g. one created with
+// httptest.NewRequest, leaves the cleanup to the handler.
+type Multipart struct {
+	// A pointer to the struct into which the regular fields
+	// will be decoded. If nil, the regular fields are ignored.
+	Val interface{}
+	// A pointer to the FileSet to which the uploaded files will
+	// be added. If nil, the uploaded files are ignored.
+	Files *FileSet
+	// If set, limits the size of each individual file to MaxFileSize bytes.
+	MaxFileSize int64
+	// If set, limits the size of the whole request's body to MaxBytes bytes.
+	MaxBytes int64
+	// Limits the total size of the regular, non-file, fields to MaxFieldBytes
+	// bytes. If not set, a limit of 10 MiB will be used.
+	MaxFieldBytes int64
+	// The list of allowed media types of the files, e.g. "image/png", or
+	// "image/*". The media type of a file is determined by sniffing its
+	// content with http.DetectContentType, the Content-Type sent by the
+	// client is ignored. If not set, files of any media type are allowed.
+	AllowedTypes []string
+	// The directory in which to spool the files. If not set,
+	// the default directory for temporary files is used.
+	TempDir string
+}
+
+// ReadBody implements the BodyReader interface. If the request's media type is not
+// "multipart/form-data" an UnsupportedMediaTypeError will be returned. If a file is
+// larger than MaxFileSize a FileTooLargeError will be returned, and if its media type
+// is not allowed an UnsupportedMediaTypeError will be returned.
+func (m Multipart) ReadBody(r *http.Request) (err error) {
+	LimitBody(nil, r, m.MaxBytes)
+
+	if mtype := requestMediaType(r); mtype != contentTypeMultipart {
+		return UnsupportedMediaTypeError{MediaType: mtype, Accepted: []string{contentTypeMultipart}}
+	}
+	mr, err := r.MultipartReader()
+	if err != nil {
+		return ReadError{err}
+	}
+
+	var files []*UploadedFile
+	defer func() {
+		if err != nil {
+			removeUploadedFiles(files)
+		}
+	}()
+
+	maxFieldBytes := m.MaxFieldBytes
+	if maxFieldBytes <= 0 {
+		maxFieldBytes = defaultMaxMultipartFieldBytes
+	}
+
+	values := url.Values{}
+	fieldBytes := int64(0)
+	for {
+		part, err := mr.NextPart()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return ReadError{err}
+		}
+
+		name := part.FormName()
+		if len(name) == 0 {
+			continue
+		}
+
+		if len(part.FileName()) == 0 {
+			lr := io.LimitReader(part, maxFieldBytes-fieldBytes+1)
+			data, err := ioutil.ReadAll(lr)
+			if err != nil {
+				return ReadError{err}
+			}
+			if fieldBytes += int64(len(data)); fieldBytes > maxFieldBytes {
+				return PayloadTooLargeError{Limit: maxFieldBytes}
+			}
+			values.Add(name, string(data))
+			continue
+		}
+
+		if m.Files == nil {
+			continue
+		}
+		f, err := m.spool(part)
+		if err != nil {
+			return err
+		}
+		files = append(files, f)
+	}
+
+	if m.Val != nil {
+		if err := form.Transform(values, m.Val); err != nil {
+			return ReadError{err}
+		}
+	}
+	if m.Files != nil {
+		m.Files.files = append(m.Files.files, files...)
+	}
+	if done := r.Context().Done(); done != nil && len(files) > 0 {
+		go func() {
+			<-done
+			removeUploadedFiles(files)
+		}()
+	}
+	return nil
+}
+
+// removeUploadedFiles removes the given files' spooled files from disk.
+func removeUploadedFiles(files []*UploadedFile) {
+	for _, f := range files {
+		os.Remove(f.path)
+	}
+}
+
+// spool writes the given file part to a temporary file.
+func (m Multipart) spool(part *multipart.Part) (_ *UploadedFile, err error) {
+	f := &UploadedFile{Field: part.FormName(), Filename: part.FileName(), Header: part.Header}
+
+	head := make([]byte, 512)
+	n, err := io.ReadFull(part, head)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return nil, ReadError{err}
+	}
+	head = head[:n]
+
+	f.ContentType = baseMediaType(http.DetectContentType(head))
+	if !mediaTypeAllowed(m.AllowedTypes, f.ContentType) {
+		return nil, UnsupportedMediaTypeError{MediaType: f.ContentType, Accepted: m.AllowedTypes}
+	}
+	if m.MaxFileSize > 0 && int64(n) > m.MaxFileSize {
+		return nil, FileTooLargeError{Field: f.Field, Filename: f.Filename, Limit: m.MaxFileSize}
+	}
+
+	tmp, err := ioutil.TempFile(m.TempDir, "httpio-upload-")
+	if err != nil {
+		return nil, err
+	}
+	f.path = tmp.Name()
+	defer func() {
+		if cerr := tmp.Close(); err == nil && cerr != nil {
+			err = cerr
+		}
+		if err != nil {
+			os.Remove(f.path)
+		}
+	}()
+
+	if _, err := tmp.Write(head); err != nil {
+		return nil, err
+	}
+
+	var src io.Reader = part
+	if m.MaxFileSize > 0 {
+		src = io.LimitReader(part, m.MaxFileSize-int64(n)+1)
+	}
+	size, err := io.Copy(tmp, src)
+	if err != nil {
+		if _, ok := err.(*os.PathError); ok {
+			return nil, err
+		}
+		return nil, ReadError{err}
+	}
+	if f.Size = int64(n) + size; m.MaxFileSize > 0 && f.Size > m.MaxFileSize {
+		return nil, FileTooLargeError{Field: f.Field, Filename: f.Filename, Limit: m.MaxFileSize}
+	}
+	return f, nil
+}
+
+// mediaTypeAllowed reports whether the media type matches any of the
+// allowed media types. An empty list allows any media type.
+func mediaTypeAllowed(allowed []string, mtype string) bool {
+	if len(allowed) == 0 {
+		return true
+	}
+	for _, a := range allowed {
+		a = baseMediaType(a)
+		if a == mtype || a == "*/*" {
+			return true
+		}
+		if strings.HasSuffix(a, "/*") && strings.HasPrefix(mtype, a[:len(a)-1]) {
+			return true
+		}
+	}
+	return false
+}
+
+// UploadedFile represents a file uploaded as part of a multipart request body.
+type UploadedFile struct {
+	// The name of the form field.
+	Field string
+	// The name of the file as sent by the client.
+	Filename string
+	// The MIME header of the file's part.
+	Header textproto.MIMEHeader
+	// The media type of the file as determined by sniffing its content.
+	ContentType string
+	// The size of the file in bytes.
+	Size int64
+
+	// the path to the spooled file
+	path string
+}
+
+// Open returns an io.ReadCloser that reads the file's content.
+func (f *UploadedFile) Open() (io.ReadCloser, error) {
+	return os.Open(f.path)
+}
+
+// FileSet holds the files read by the Multipart BodyReader.
+type FileSet struct {
+	files []*UploadedFile
+}
+
+// Get returns the first file uploaded for the given form field,
+// or nil if there is none.
+func (fs *FileSet) Get(field string) *UploadedFile {
+	for _, f := range fs.files {
+		if f.Field == field {
+			return f
+		}
+	}
+	return nil
+}
+
+// GetAll returns all of the files uploaded for the given form field.
+func (fs *FileSet) GetAll(field string) (files []*UploadedFile) {
+	for _, f := range fs.files {
+		if f.Field == field {
+			files = append(files, f)
+		}
+	}
+	return files
+}
+
+// Files returns all of the files in the set in the order they were uploaded.
+func (fs *FileSet) Files() []*UploadedFile {
+	return append([]*UploadedFile(nil), fs.files...)
+}
+
+// RemoveAll removes the spooled files from disk and empties the set.
+// It returns the first error encountered, if any.
+func (fs *FileSet) RemoveAll() (err error) {
+	for _, f := range fs.files {
+		if rerr := os.Remove(f.path); rerr != nil && !os.IsNotExist(rerr) && err == nil {
+			err = rerr
+		}
+	}
+	fs.files = nil
+	return err
+}
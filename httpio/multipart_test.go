@@ -0,0 +1,227 @@
+package httpio
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/frk/compare"
+)
+
+type testMultipartFields struct {
+	Title string `form:"title"`
+	Count int    `form:"count"`
+}
+
+type testMultipartPart struct {
+	field, filename, content string
+}
+
+func newMultipartRequest(t *testing.T, parts []testMultipartPart) *http.Request {
+	var buf bytes.Buffer
+	mw := multipart.NewWriter(&buf)
+	for _, p := range parts {
+		var err error
+		if len(p.filename) > 0 {
+			w, cerr := mw.CreateFormFile(p.field, p.filename)
+			if cerr != nil {
+				t.Fatal(cerr)
+			}
+			_, err = w.Write([]byte(p.content))
+		} else {
+			err = mw.WriteField(p.field, p.content)
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := mw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := http.NewRequest("POST", "/", &buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.Header.Set("Content-Type", mw.FormDataContentType())
+	return r
+}
+
+func TestMultipart_ReadBody(t *testing.T) {
+	png := "\x89PNG\x0D\x0A\x1A\x0A" + "rest-of-png"
+
+	tests := []struct {
+		name   string
+		parts  []testMultipartPart
+		mp     Multipart
+		fields testMultipartFields
+		files  []UploadedFile
+		err    error
+	}{{
+		name: "should decode fields and spool files",
+		parts: []testMultipartPart{
+			{field: "title", content: "hello"},
+			{field: "count", content: "3"},
+			{field: "doc", filename: "a.txt", content: "some text"},
+			{field: "doc", filename: "b.png", content: png},
+		},
+		fields: testMultipartFields{Title: "hello", Count: 3},
+		files: []UploadedFile{
+			{Field: "doc", Filename: "a.txt", ContentType: "text/plain", Size: 9},
+			{Field: "doc", Filename: "b.png", ContentType: "image/png", Size: int64(len(png))},
+		},
+	}, {
+		name: "should allow wildcard media types",
+		parts: []testMultipartPart{
+			{field: "img", filename: "b.png", content: png},
+		},
+		mp:    Multipart{AllowedTypes: []string{"text/plain", "image/*"}},
+		files: []UploadedFile{{Field: "img", Filename: "b.png", ContentType: "image/png", Size: int64(len(png))}},
+	}, {
+		name: "should fail when media type is not allowed",
+		parts: []testMultipartPart{
+			{field: "img", filename: "b.png", content: png},
+			{field: "doc", filename: "a.txt", content: "some text"},
+		},
+		mp:  Multipart{AllowedTypes: []string{"image/png"}},
+		err: UnsupportedMediaTypeError{MediaType: "text/plain", Accepted: []string{"image/png"}},
+	}, {
+		name: "should fail when file exceeds limit",
+		parts: []testMultipartPart{
+			{field: "doc", filename: "a.txt", content: "some text"},
+		},
+		mp:  Multipart{MaxFileSize: 8},
+		err: FileTooLargeError{Field: "doc", Filename: "a.txt", Limit: 8},
+	}, {
+		name: "should fail when fields exceed limit",
+		parts: []testMultipartPart{
+			{field: "doc", filename: "a.txt", content: "some text"},
+			{field: "title", content: "hello"},
+		},
+		mp:  Multipart{MaxFieldBytes: 4},
+		err: PayloadTooLargeError{Limit: 4},
+	}}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir, err := ioutil.TempDir("", "httpio-test")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer os.RemoveAll(dir)
+
+			var fields testMultipartFields
+			var files FileSet
+			mp := tt.mp
+			mp.Val, mp.Files, mp.TempDir = &fields, &files, dir
+
+			err = mp.ReadBody(newMultipartRequest(t, tt.parts))
+			if e := compare.Compare(err, tt.err); e != nil {
+				t.Error(e)
+			}
+			if err != nil {
+				if infos, _ := ioutil.ReadDir(dir); len(infos) != 0 {
+					t.Errorf("got %d spooled files after failure, want 0", len(infos))
+				}
+				return
+			}
+			if e := compare.Compare(fields, tt.fields); e != nil {
+				t.Error(e)
+			}
+
+			got := files.Files()
+			if len(got) != len(tt.files) {
+				t.Fatalf("got %d files, want %d", len(got), len(tt.files))
+			}
+			for i, f := range got {
+				rc, err := f.Open()
+				if err != nil {
+					t.Fatal(err)
+				}
+				data, _ := ioutil.ReadAll(rc)
+				rc.Close()
+
+				content := ""
+				for _, p := range tt.parts {
+					if p.filename == f.Filename {
+						content = p.content
+					}
+				}
+				if e := compare.Compare(string(data), content); e != nil {
+					t.Error(e)
+				}
+
+				fc := *f
+				fc.Header, fc.path = nil, ""
+				if e := compare.Compare(fc, tt.files[i]); e != nil {
+					t.Error(e)
+				}
+			}
+
+			if err := files.RemoveAll(); err != nil {
+				t.Fatal(err)
+			}
+			if infos, _ := ioutil.ReadDir(dir); len(infos) != 0 {
+				t.Errorf("got %d spooled files after RemoveAll, want 0", len(infos))
+			}
+		})
+	}
+}
+
+func TestMultipart_ReadBody_RemoveOnDone(t *testing.T) {
+	dir, err := ioutil.TempDir("", "httpio-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	r := newMultipartRequest(t, []testMultipartPart{{field: "doc", filename: "a.txt", content: "some text"}})
+	r = r.WithContext(ctx)
+
+	var files FileSet
+	if err := (Multipart{Files: &files, TempDir: dir}).ReadBody(r); err != nil {
+		t.Fatal(err)
+	}
+	if infos, _ := ioutil.ReadDir(dir); len(infos) != 1 {
+		t.Fatalf("got %d spooled files, want 1", len(infos))
+	}
+
+	cancel()
+	for i := 0; i < 100; i++ {
+		if infos, _ := ioutil.ReadDir(dir); len(infos) == 0 {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Error("spooled files not removed after the request's context is done")
+}
+
+func TestMultipart_ReadBody_NotMultipart(t *testing.T) {
+	r, _ := http.NewRequest("POST", "/", bytes.NewReader([]byte(`{}`)))
+	r.Header.Set("Content-Type", "application/json")
+
+	err := Multipart{}.ReadBody(r)
+	want := UnsupportedMediaTypeError{MediaType: "application/json", Accepted: []string{contentTypeMultipart}}
+	if e := compare.Compare(err, want); e != nil {
+		t.Error(e)
+	}
+}
+
+func TestFileSet(t *testing.T) {
+	fs := FileSet{files: []*UploadedFile{{Field: "a", Filename: "1"}, {Field: "b", Filename: "2"}, {Field: "a", Filename: "3"}}}
+	if e := compare.Compare(fs.Get("a").Filename, "1"); e != nil {
+		t.Error(e)
+	}
+	if fs.Get("c") != nil {
+		t.Error("got file for unknown field")
+	}
+	if e := compare.Compare(len(fs.GetAll("a")), 2); e != nil {
+		t.Error(e)
+	}
+}
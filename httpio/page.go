@@ -0,0 +1,250 @@
+package httpio
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// The default number of items per page used by Pagination and Cursor
+// when their DefaultSize field is not set.
+const defaultPageSize = 20
+
+// Page represents the position and the size of a single page of a paginated list.
+type Page struct {
+	// The 1-based number of the page.
+	Number int
+	// The maximum number of items on the page.
+	Size int
+}
+
+// Offset returns the number of items that precede the page.
+func (p Page) Offset() int {
+	if p.Number < 1 {
+		return 0
+	}
+	return (p.Number - 1) * p.Size
+}
+
+// Limit returns the maximum number of items on the page.
+func (p Page) Limit() int {
+	return p.Size
+}
+
+// Pagination can be used to read the "page" and "per_page" query parameters
+// of the incoming HTTP request and set them to the Page pointed to by Val.
+//
+// Missing or invalid values are replaced with defaults, i.e. the page
+// number defaults to 1 and the page size defaults to DefaultSize.
+type Pagination struct {
+	// Pointer to the Page which should be set from the query parameters.
+	Val *Page
+	// The page size to be used if per_page is missing or invalid.
+	// If not set, a default of 20 will be used.
+	DefaultSize int
+	// If set, per_page values larger than MaxSize will be clamped to MaxSize.
+	MaxSize int
+}
+
+// ReadQuery implements the QueryReader interface.
+func (rr Pagination) ReadQuery(query url.Values) error {
+	num, err := strconv.Atoi(query.Get("page"))
+	if err != nil || num < 1 {
+		num = 1
+	}
+	rr.Val.Number = num
+	rr.Val.Size = readPageSize(query, rr.DefaultSize, rr.MaxSize)
+	return nil
+}
+
+// Cursor can be used to read the opaque "cursor" and the "per_page" query
+// parameters of the incoming HTTP request. The cursor is expected to have been
+// produced by EncodeCursor using the same Key, if the cursor's signature cannot
+// be verified ReadQuery will return a CursorError.
+type Cursor struct {
+	// Pointer to the byte slice which should be set to the decoded cursor
+	// payload. If the cursor parameter is absent the slice will be left as is.
+	Val *[]byte
+	// If set, will be set to the requested page size.
+	Size *int
+	// The secret key used to sign and verify the cursors.
+	Key []byte
+	// The page size to be used if per_page is missing or invalid.
+	// If not set, a default of 20 will be used.
+	DefaultSize int
+	// If set, per_page values larger than MaxSize will be clamped to MaxSize.
+	MaxSize int
+}
+
+// ReadQuery implements the QueryReader interface.
+func (rr Cursor) ReadQuery(query url.Values) error {
+	if rr.Size != nil {
+		*rr.Size = readPageSize(query, rr.DefaultSize, rr.MaxSize)
+	}
+
+	cur := query.Get("cursor")
+	if len(cur) == 0 {
+		return nil
+	}
+	payload, ok := DecodeCursor(rr.Key, cur)
+	if !ok {
+		return CursorError{cur}
+	}
+	*rr.Val = payload
+	return nil
+}
+
+// EncodeCursor signs the given payload using HMAC-SHA256 with the given key
+// and returns the payload together with the signature as a url-safe base64
+// encoded string.
+func EncodeCursor(key, payload []byte) string {
+	mac := hmac.New(sha256.New, key)
+	mac.Write(payload)
+	buf := append(append([]byte(nil), payload...), mac.Sum(nil)...)
+	return base64.RawURLEncoding.EncodeToString(buf)
+}
+
+// DecodeCursor decodes the given cursor, as produced by EncodeCursor, and
+// verifies its signature using the given key. DecodeCursor returns the
+// cursor's payload and true on success, or nil and false otherwise.
+func DecodeCursor(key []byte, cursor string) ([]byte, bool) {
+	buf, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil || len(buf) < sha256.Size {
+		return nil, false
+	}
+
+	payload, sum := buf[:len(buf)-sha256.Size], buf[len(buf)-sha256.Size:]
+	mac := hmac.New(sha256.New, key)
+	mac.Write(payload)
+	if !hmac.Equal(sum, mac.Sum(nil)) {
+		return nil, false
+	}
+	return payload, true
+}
+
+// readPageSize returns the value of the per_page query parameter
+// constrained by the given default and max values.
+func readPageSize(query url.Values, def, max int) int {
+	if def <= 0 {
+		def = defaultPageSize
+	}
+	if max > 0 && def > max {
+		def = max
+	}
+
+	size, err := strconv.Atoi(query.Get("per_page"))
+	if err != nil || size < 1 {
+		return def
+	}
+	if max > 0 && size > max {
+		return max
+	}
+	return size
+}
+
+// PageLinks can be used to set the Link (RFC 8288) and X-Total-Count headers
+// of an outgoing response to a request for a page of an offset-paginated list.
+//
+// The "first" and "prev" links are omitted for the first page, and the
+// "next" and "last" links are omitted for the last page. If the requested
+// page is past the last page, the "prev" link points to the last page.
+type PageLinks struct {
+	// The URL of the current request, the links are produced by
+	// replacing its page and per_page query parameters.
+	URL *url.URL
+	// The page that was requested.
+	Page Page
+	// The total number of items in the list. If negative, the total is
+	// considered unknown, the X-Total-Count header and the "last" link are
+	// omitted, and the "next" link is always written.
+	Total int
+}
+
+// WriteHeader implements the HeaderWriter interface.
+func (hw PageLinks) WriteHeader(header http.Header) {
+	num, size := hw.Page.Number, hw.Page.Size
+	if num < 1 {
+		num = 1
+	}
+	if size < 1 {
+		size = defaultPageSize
+	}
+
+	last := -1
+	if hw.Total >= 0 {
+		header.Set("X-Total-Count", strconv.Itoa(hw.Total))
+		if last = (hw.Total + size - 1) / size; last < 1 {
+			last = 1
+		}
+	}
+
+	var links []string
+	link := func(rel string, num int) {
+		q := hw.URL.Query()
+		q.Set("page", strconv.Itoa(num))
+		q.Set("per_page", strconv.Itoa(size))
+		links = append(links, formatLink(hw.URL, q, rel))
+	}
+	if num > 1 {
+		prev := num - 1
+		if last > 0 && prev > last {
+			prev = last
+		}
+		link("first", 1)
+		link("prev", prev)
+	}
+	if last < 0 || num < last {
+		link("next", num+1)
+	}
+	if last > 0 && num < last {
+		link("last", last)
+	}
+
+	if len(links) > 0 {
+		header.Set("Link", strings.Join(links, ", "))
+	}
+}
+
+// CursorLinks can be used to set the Link (RFC 8288) header of an outgoing
+// response to a request for a page of a cursor-paginated list.
+type CursorLinks struct {
+	// The URL of the current request, the links are produced by
+	// replacing its cursor query parameter.
+	URL *url.URL
+	// The cursors, as produced by EncodeCursor, of the next and previous
+	// pages. If empty, the corresponding link will be omitted.
+	Next, Prev string
+}
+
+// WriteHeader implements the HeaderWriter interface.
+func (hw CursorLinks) WriteHeader(header http.Header) {
+	var links []string
+	link := func(rel string, cursor string) {
+		q := hw.URL.Query()
+		q.Set("cursor", cursor)
+		links = append(links, formatLink(hw.URL, q, rel))
+	}
+
+	q := hw.URL.Query()
+	q.Del("cursor")
+	links = append(links, formatLink(hw.URL, q, "first"))
+	if len(hw.Prev) > 0 {
+		link("prev", hw.Prev)
+	}
+	if len(hw.Next) > 0 {
+		link("next", hw.Next)
+	}
+	header.Set("Link", strings.Join(links, ", "))
+}
+
+// formatLink returns a single link-value of the Link header
+// for the given url with its query replaced by q.
+func formatLink(u *url.URL, q url.Values, rel string) string {
+	v := *u
+	v.RawQuery = q.Encode()
+	return "<" + v.String() + `>; rel="` + rel + `"`
+}
@@ -0,0 +1,185 @@
+package httpio
+
+import (
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/frk/compare"
+)
+
+func TestPagination_ReadQuery(t *testing.T) {
+	tests := []struct {
+		name  string
+		query url.Values
+		pag   Pagination
+		want  Page
+	}{{
+		name:  "defaults",
+		query: url.Values{},
+		pag:   Pagination{Val: &Page{}},
+		want:  Page{Number: 1, Size: 20},
+	}, {
+		name:  "custom default",
+		query: url.Values{"page": {"abc"}, "per_page": {"-5"}},
+		pag:   Pagination{Val: &Page{}, DefaultSize: 50},
+		want:  Page{Number: 1, Size: 50},
+	}, {
+		name:  "explicit values",
+		query: url.Values{"page": {"3"}, "per_page": {"10"}},
+		pag:   Pagination{Val: &Page{}, MaxSize: 100},
+		want:  Page{Number: 3, Size: 10},
+	}, {
+		name:  "clamp to max",
+		query: url.Values{"page": {"2"}, "per_page": {"1000"}},
+		pag:   Pagination{Val: &Page{}, MaxSize: 100},
+		want:  Page{Number: 2, Size: 100},
+	}}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.pag.ReadQuery(tt.query); err != nil {
+				t.Fatal(err)
+			}
+			if e := compare.Compare(*tt.pag.Val, tt.want); e != nil {
+				t.Error(e)
+			}
+		})
+	}
+
+	if got := (Page{Number: 3, Size: 10}).Offset(); got != 20 {
+		t.Errorf("Offset() got %d, want 20", got)
+	}
+}
+
+func TestCursor_ReadQuery(t *testing.T) {
+	key := []byte("secret")
+	cur := EncodeCursor(key, []byte(`{"id":42}`))
+
+	tests := []struct {
+		name  string
+		query url.Values
+		key   []byte
+		want  []byte
+		size  int
+		err   error
+	}{{
+		name:  "no cursor",
+		query: url.Values{"per_page": {"5"}},
+		key:   key,
+		size:  5,
+	}, {
+		name:  "valid cursor",
+		query: url.Values{"cursor": {cur}},
+		key:   key,
+		want:  []byte(`{"id":42}`),
+		size:  20,
+	}, {
+		name:  "wrong key",
+		query: url.Values{"cursor": {cur}},
+		key:   []byte("other"),
+		size:  20,
+		err:   CursorError{cur},
+	}, {
+		name:  "malformed cursor",
+		query: url.Values{"cursor": {"%%%"}},
+		key:   key,
+		size:  20,
+		err:   CursorError{"%%%"},
+	}}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var val []byte
+			var size int
+
+			err := Cursor{Val: &val, Size: &size, Key: tt.key}.ReadQuery(tt.query)
+			if e := compare.Compare(err, tt.err); e != nil {
+				t.Error(e)
+			}
+			if e := compare.Compare(val, tt.want); e != nil {
+				t.Error(e)
+			}
+			if e := compare.Compare(size, tt.size); e != nil {
+				t.Error(e)
+			}
+		})
+	}
+}
+
+func TestPageLinks_WriteHeader(t *testing.T) {
+	u, _ := url.Parse("/items?q=foo&page=2")
+
+	tests := []struct {
+		name  string
+		links PageLinks
+		want  http.Header
+	}{{
+		name:  "first page",
+		links: PageLinks{URL: u, Page: Page{1, 10}, Total: 25},
+		want: http.Header{
+			"X-Total-Count": {"25"},
+			"Link": {`</items?page=2&per_page=10&q=foo>; rel="next", ` +
+				`</items?page=3&per_page=10&q=foo>; rel="last"`},
+		},
+	}, {
+		name:  "middle page",
+		links: PageLinks{URL: u, Page: Page{2, 10}, Total: 25},
+		want: http.Header{
+			"X-Total-Count": {"25"},
+			"Link": {`</items?page=1&per_page=10&q=foo>; rel="first", ` +
+				`</items?page=1&per_page=10&q=foo>; rel="prev", ` +
+				`</items?page=3&per_page=10&q=foo>; rel="next", ` +
+				`</items?page=3&per_page=10&q=foo>; rel="last"`},
+		},
+	}, {
+		name:  "last page",
+		links: PageLinks{URL: u, Page: Page{3, 10}, Total: 25},
+		want: http.Header{
+			"X-Total-Count": {"25"},
+			"Link": {`</items?page=1&per_page=10&q=foo>; rel="first", ` +
+				`</items?page=2&per_page=10&q=foo>; rel="prev"`},
+		},
+	}, {
+		name:  "past the last page",
+		links: PageLinks{URL: u, Page: Page{7, 10}, Total: 25},
+		want: http.Header{
+			"X-Total-Count": {"25"},
+			"Link": {`</items?page=1&per_page=10&q=foo>; rel="first", ` +
+				`</items?page=3&per_page=10&q=foo>; rel="prev"`},
+		},
+	}, {
+		name:  "unknown total",
+		links: PageLinks{URL: u, Page: Page{1, 10}, Total: -1},
+		want: http.Header{
+			"Link": {`</items?page=2&per_page=10&q=foo>; rel="next"`},
+		},
+	}, {
+		name:  "empty list",
+		links: PageLinks{URL: u, Page: Page{1, 10}, Total: 0},
+		want:  http.Header{"X-Total-Count": {"0"}},
+	}}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := http.Header{}
+			tt.links.WriteHeader(h)
+			if e := compare.Compare(h, tt.want); e != nil {
+				t.Error(e)
+			}
+		})
+	}
+}
+
+func TestCursorLinks_WriteHeader(t *testing.T) {
+	u, _ := url.Parse("/items?cursor=abc&per_page=5")
+
+	h := http.Header{}
+	CursorLinks{URL: u, Next: "def", Prev: "xyz"}.WriteHeader(h)
+	want := http.Header{"Link": {`</items?per_page=5>; rel="first", ` +
+		`</items?cursor=xyz&per_page=5>; rel="prev", ` +
+		`</items?cursor=def&per_page=5>; rel="next"`}}
+	if e := compare.Compare(h, want); e != nil {
+		t.Error(e)
+	}
+}
@@ -0,0 +1,510 @@
+package httpio
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+const (
+	contentTypeJSONPatch  = "application/json-patch+json"
+	contentTypeMergePatch = "application/merge-patch+json"
+)
+
+// PatchOperation represents a single operation of a JSON Patch document.
+type PatchOperation struct {
+	// The operation, one of "add", "remove", "replace", "move", "copy" or "test".
+	Op string `json:"op"`
+	// The JSON Pointer to the target location.
+	Path string `json:"path"`
+	// The JSON Pointer to the source location of the "move" and "copy" operations.
+	From string `json:"from,omitempty"`
+	// The value of the "add", "replace" and "test" operations.
+	Value json.RawMessage `json:"value,omitempty"`
+}
+
+// PatchDocument represents a JSON Patch document as specified by RFC 6902.
+type PatchDocument []PatchOperation
+
+// The JSONPatch type implements the BodyReader interface by decoding a JSON
+// Patch document from the request's body. Since the value that is to be patched
+// is usually not available until after the request has been read, the decoded
+// document should be applied by the handler once it has loaded the value,
+// e.g. in BeforeValidate, using the document's Apply method.
+type JSONPatch struct {
+	// A pointer to the JSON Patch document to be decoded from the request's body.
+	Val *PatchDocument
+}
+
+// ReadBody implements the BodyReader interface. If the request's media type is not
+// "application/json-patch+json" an UnsupportedMediaTypeError will be returned,
+// and if the document contains an invalid operation a PatchError will be returned.
+func (p JSONPatch) ReadBody(r *http.Request) error {
+	if mtype := requestMediaType(r); mtype != contentTypeJSONPatch {
+		return UnsupportedMediaTypeError{MediaType: mtype, Accepted: []string{contentTypeJSONPatch}}
+	}
+	if err := (JSON{Val: p.Val, LocateErrors: true}).ReadBody(r); err != nil {
+		return err
+	}
+	return p.Val.validate()
+}
+
+// validate checks that each operation of the document is well-formed.
+func (doc PatchDocument) validate() error {
+	for i, op := range doc {
+		perr := PatchError{Index: i, Op: op.Op, Path: op.Path}
+		switch op.Op {
+		case "add", "remove", "replace", "move", "copy", "test":
+		default:
+			perr.Reason = "unknown operation"
+			return perr
+		}
+		if _, err := parsePointer(op.Path); err != nil {
+			perr.Reason = err.Error()
+			return perr
+		}
+		switch op.Op {
+		case "move", "copy":
+			if _, err := parsePointer(op.From); err != nil {
+				perr.Reason = "invalid from: " + err.Error()
+				return perr
+			}
+		case "add", "replace", "test":
+			if op.Value == nil {
+				perr.Reason = "missing value"
+				return perr
+			}
+		}
+	}
+	return nil
+}
+
+// Apply applies the document's operations, in order, to the value pointed
+// to by v. The value is patched as a whole, if any of the operations fails
+// the value is left unchanged and a PatchError is returned.
+//
+// The operations are applied to the json representation of the value which
+// is then decoded into a new value of the same type that replaces the original
+// one, hence any fields that are not represented in json will be reset.
+func (doc PatchDocument) Apply(v interface{}) error {
+	return patchValue(v, func(tree interface{}) (interface{}, error) {
+		return doc.apply(tree)
+	})
+}
+
+func (doc PatchDocument) apply(tree interface{}) (interface{}, error) {
+	for i, op := range doc {
+		var err error
+		if tree, err = op.apply(tree); err != nil {
+			return nil, PatchError{Index: i, Op: op.Op, Path: op.Path, Reason: err.Error(), Err: err}
+		}
+	}
+	return tree, nil
+}
+
+var (
+	errPatchPathNotFound  = errors.New("path not found")
+	errPatchTestFailed    = errors.New("test failed")
+	errPatchMoveIntoChild = errors.New("cannot move a value into one of its children")
+)
+
+func (op PatchOperation) apply(tree interface{}) (interface{}, error) {
+	path, err := parsePointer(op.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	var val interface{}
+	if op.Value != nil {
+		if val, err = decodeJSONTree(op.Value); err != nil {
+			return nil, err
+		}
+	}
+
+	switch op.Op {
+	case "add":
+		return pointerAdd(tree, path, val)
+	case "remove":
+		tree, _, err := pointerRemove(tree, path)
+		return tree, err
+	case "replace":
+		if len(path) == 0 {
+			return val, nil
+		}
+		return pointerAt(tree, path, func(node interface{}, key string) (interface{}, error) {
+			switch n := node.(type) {
+			case map[string]interface{}:
+				if _, ok := n[key]; !ok {
+					return nil, errPatchPathNotFound
+				}
+				n[key] = val
+				return n, nil
+			case []interface{}:
+				i, err := arrayIndex(key, len(n)-1)
+				if err != nil {
+					return nil, err
+				}
+				n[i] = val
+				return n, nil
+			}
+			return nil, errPatchPathNotFound
+		})
+	case "move":
+		from, err := parsePointer(op.From)
+		if err != nil {
+			return nil, err
+		}
+		if op.From == op.Path {
+			_, err := pointerGet(tree, from)
+			return tree, err
+		}
+		if strings.HasPrefix(op.Path, op.From+"/") {
+			return nil, errPatchMoveIntoChild
+		}
+		tree, val, err := pointerRemove(tree, from)
+		if err != nil {
+			return nil, err
+		}
+		return pointerAdd(tree, path, val)
+	case "copy":
+		from, err := parsePointer(op.From)
+		if err != nil {
+			return nil, err
+		}
+		val, err := pointerGet(tree, from)
+		if err != nil {
+			return nil, err
+		}
+		return pointerAdd(tree, path, copyJSONTree(val))
+	case "test":
+		cur, err := pointerGet(tree, path)
+		if err != nil {
+			return nil, err
+		}
+		if !equalJSONTree(cur, val) {
+			return nil, errPatchTestFailed
+		}
+		return tree, nil
+	}
+	return nil, errors.New("unknown operation")
+}
+
+// The MergePatch type implements the BodyReader interface by decoding a JSON
+// Merge Patch document from the request's body. Since the value that is to be
+// patched is usually not available until after the request has been read, the
+// decoded document should be applied by the handler once it has loaded the
+// value, e.g. in BeforeValidate, using the document's Apply method.
+type MergePatch struct {
+	// A pointer to the JSON Merge Patch document to be decoded from the request's body.
+	Val *MergeDocument
+}
+
+// MergeDocument represents a JSON Merge Patch document as specified by RFC 7386.
+type MergeDocument json.RawMessage
+
+// ReadBody implements the BodyReader interface. If the request's media type is
+// not "application/merge-patch+json" an UnsupportedMediaTypeError will be returned.
+func (p MergePatch) ReadBody(r *http.Request) error {
+	if mtype := requestMediaType(r); mtype != contentTypeMergePatch {
+		return UnsupportedMediaTypeError{MediaType: mtype, Accepted: []string{contentTypeMergePatch}}
+	}
+	return JSON{Val: (*json.RawMessage)(p.Val), LocateErrors: true}.ReadBody(r)
+}
+
+// Apply merges the document into the value pointed to by v. Members of the
+// document that are set to null are removed from the value, objects are
+// merged recursively, and any other members replace those of the value.
+//
+// The document is merged into the json representation of the value which
+// is then decoded into a new value of the same type that replaces the original
+// one, hence any fields that are not represented in json will be reset.
+func (doc MergeDocument) Apply(v interface{}) error {
+	patch, err := decodeJSONTree(doc)
+	if err != nil {
+		return err
+	}
+	return patchValue(v, func(tree interface{}) (interface{}, error) {
+		return mergeJSONTree(tree, patch), nil
+	})
+}
+
+// mergeJSONTree implements the MergePatch algorithm of RFC 7386.
+func mergeJSONTree(target, patch interface{}) interface{} {
+	p, ok := patch.(map[string]interface{})
+	if !ok {
+		return patch
+	}
+	t, ok := target.(map[string]interface{})
+	if !ok {
+		t = make(map[string]interface{}, len(p))
+	}
+	for k, v := range p {
+		if v == nil {
+			delete(t, k)
+		} else {
+			t[k] = mergeJSONTree(t[k], v)
+		}
+	}
+	return t
+}
+
+// patchValue applies fn to the json representation of the value pointed to
+// by v and then replaces the value with the decoded result.
+func patchValue(v interface{}, fn func(tree interface{}) (interface{}, error)) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() {
+		return fmt.Errorf("httpcrud/httpio: cannot patch non-pointer %T", v)
+	}
+
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	tree, err := decodeJSONTree(data)
+	if err != nil {
+		return err
+	}
+	if tree, err = fn(tree); err != nil {
+		return err
+	}
+	if data, err = json.Marshal(tree); err != nil {
+		return err
+	}
+
+	nv := reflect.New(rv.Elem().Type())
+	if err := json.Unmarshal(data, nv.Interface()); err != nil {
+		return err
+	}
+	rv.Elem().Set(nv.Elem())
+	return nil
+}
+
+// decodeJSONTree decodes data into a tree of interface{} values, numbers
+// are decoded as json.Number to preserve their precision.
+func decodeJSONTree(data []byte) (interface{}, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+
+	var tree interface{}
+	if err := dec.Decode(&tree); err != nil {
+		return nil, err
+	}
+	return tree, nil
+}
+
+// copyJSONTree returns a deep copy of the given tree.
+func copyJSONTree(tree interface{}) interface{} {
+	switch t := tree.(type) {
+	case map[string]interface{}:
+		m := make(map[string]interface{}, len(t))
+		for k, v := range t {
+			m[k] = copyJSONTree(v)
+		}
+		return m
+	case []interface{}:
+		s := make([]interface{}, len(t))
+		for i, v := range t {
+			s[i] = copyJSONTree(v)
+		}
+		return s
+	}
+	return tree
+}
+
+// equalJSONTree reports whether the two trees are equal, numbers
+// are considered equal if their values are numerically equal.
+func equalJSONTree(a, b interface{}) bool {
+	switch x := a.(type) {
+	case map[string]interface{}:
+		y, ok := b.(map[string]interface{})
+		if !ok || len(x) != len(y) {
+			return false
+		}
+		for k, v := range x {
+			if w, ok := y[k]; !ok || !equalJSONTree(v, w) {
+				return false
+			}
+		}
+		return true
+	case []interface{}:
+		y, ok := b.([]interface{})
+		if !ok || len(x) != len(y) {
+			return false
+		}
+		for i := range x {
+			if !equalJSONTree(x[i], y[i]) {
+				return false
+			}
+		}
+		return true
+	case json.Number:
+		y, ok := b.(json.Number)
+		if !ok {
+			return false
+		}
+		if x == y {
+			return true
+		}
+		fx, okx := new(big.Float).SetString(string(x))
+		fy, oky := new(big.Float).SetString(string(y))
+		return okx && oky && fx.Cmp(fy) == 0
+	}
+	return a == b
+}
+
+// parsePointer parses the given JSON Pointer, as specified by
+// RFC 6901, into its list of unescaped reference tokens.
+func parsePointer(ptr string) ([]string, error) {
+	if len(ptr) == 0 {
+		return nil, nil
+	}
+	if ptr[0] != '/' {
+		return nil, fmt.Errorf("invalid json pointer %q", ptr)
+	}
+
+	tokens := strings.Split(ptr[1:], "/")
+	for i, tok := range tokens {
+		if strings.Contains(strings.NewReplacer("~0", "", "~1", "").Replace(tok), "~") {
+			return nil, fmt.Errorf("invalid json pointer %q", ptr)
+		}
+		tokens[i] = strings.NewReplacer("~1", "/", "~0", "~").Replace(tok)
+	}
+	return tokens, nil
+}
+
+// arrayIndex parses the given reference token as an index into an array,
+// the index must not be greater than max.
+func arrayIndex(tok string, max int) (int, error) {
+	if len(tok) == 0 || (len(tok) > 1 && tok[0] == '0') {
+		return 0, fmt.Errorf("invalid array index %q", tok)
+	}
+	i, err := strconv.Atoi(tok)
+	if err != nil || i < 0 {
+		return 0, fmt.Errorf("invalid array index %q", tok)
+	}
+	if i > max {
+		return 0, errPatchPathNotFound
+	}
+	return i, nil
+}
+
+// pointerAt invokes fn with the container of the value referenced by path
+// and the path's last reference token, the container is then replaced by
+// the value returned from fn. The path must not be empty.
+func pointerAt(node interface{}, path []string, fn func(node interface{}, key string) (interface{}, error)) (interface{}, error) {
+	if len(path) == 1 {
+		return fn(node, path[0])
+	}
+
+	switch n := node.(type) {
+	case map[string]interface{}:
+		child, ok := n[path[0]]
+		if !ok {
+			return nil, errPatchPathNotFound
+		}
+		c, err := pointerAt(child, path[1:], fn)
+		if err != nil {
+			return nil, err
+		}
+		n[path[0]] = c
+		return n, nil
+	case []interface{}:
+		i, err := arrayIndex(path[0], len(n)-1)
+		if err != nil {
+			return nil, err
+		}
+		c, err := pointerAt(n[i], path[1:], fn)
+		if err != nil {
+			return nil, err
+		}
+		n[i] = c
+		return n, nil
+	}
+	return nil, errPatchPathNotFound
+}
+
+// pointerGet returns the value referenced by path.
+func pointerGet(node interface{}, path []string) (interface{}, error) {
+	for _, tok := range path {
+		switch n := node.(type) {
+		case map[string]interface{}:
+			v, ok := n[tok]
+			if !ok {
+				return nil, errPatchPathNotFound
+			}
+			node = v
+		case []interface{}:
+			i, err := arrayIndex(tok, len(n)-1)
+			if err != nil {
+				return nil, err
+			}
+			node = n[i]
+		default:
+			return nil, errPatchPathNotFound
+		}
+	}
+	return node, nil
+}
+
+// pointerAdd adds val at the location referenced by path.
+func pointerAdd(tree interface{}, path []string, val interface{}) (interface{}, error) {
+	if len(path) == 0 {
+		return val, nil
+	}
+	return pointerAt(tree, path, func(node interface{}, key string) (interface{}, error) {
+		switch n := node.(type) {
+		case map[string]interface{}:
+			n[key] = val
+			return n, nil
+		case []interface{}:
+			if key == "-" {
+				return append(n, val), nil
+			}
+			i, err := arrayIndex(key, len(n))
+			if err != nil {
+				return nil, err
+			}
+			n = append(n, nil)
+			copy(n[i+1:], n[i:])
+			n[i] = val
+			return n, nil
+		}
+		return nil, errPatchPathNotFound
+	})
+}
+
+// pointerRemove removes the value referenced by path and returns it.
+func pointerRemove(tree interface{}, path []string) (interface{}, interface{}, error) {
+	if len(path) == 0 {
+		return nil, nil, errors.New("cannot remove the whole document")
+	}
+
+	var removed interface{}
+	tree, err := pointerAt(tree, path, func(node interface{}, key string) (interface{}, error) {
+		switch n := node.(type) {
+		case map[string]interface{}:
+			v, ok := n[key]
+			if !ok {
+				return nil, errPatchPathNotFound
+			}
+			removed = v
+			delete(n, key)
+			return n, nil
+		case []interface{}:
+			i, err := arrayIndex(key, len(n)-1)
+			if err != nil {
+				return nil, err
+			}
+			removed = n[i]
+			return append(n[:i:i], n[i+1:]...), nil
+		}
+		return nil, errPatchPathNotFound
+	})
+	return tree, removed, err
+}
@@ -0,0 +1,225 @@
+package httpio
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/frk/compare"
+)
+
+type testPatchValue struct {
+	Foo  string            `json:"foo"`
+	Bar  []int             `json:"bar,omitempty"`
+	Baz  *testPatchValue   `json:"baz,omitempty"`
+	Tags map[string]string `json:"tags,omitempty"`
+	Qux  int               `json:"-"`
+}
+
+func TestJSONPatch_ReadBody(t *testing.T) {
+	tests := []struct {
+		name  string
+		ctype string
+		body  string
+		want  PatchDocument
+		err   error
+	}{{
+		name:  "should fail with wrong content type",
+		ctype: "application/json",
+		body:  `[]`,
+		err:   UnsupportedMediaTypeError{MediaType: "application/json", Accepted: []string{contentTypeJSONPatch}},
+	}, {
+		name:  "should fail with unknown operation",
+		ctype: contentTypeJSONPatch,
+		body:  `[{"op":"add","path":"/a","value":1},{"op":"frob","path":"/a"}]`,
+		want: PatchDocument{
+			{Op: "add", Path: "/a", Value: []byte(`1`)},
+			{Op: "frob", Path: "/a"},
+		},
+		err: PatchError{Index: 1, Op: "frob", Path: "/a", Reason: "unknown operation"},
+	}, {
+		name:  "should fail with missing value",
+		ctype: contentTypeJSONPatch,
+		body:  `[{"op":"replace","path":"/a"}]`,
+		want:  PatchDocument{{Op: "replace", Path: "/a"}},
+		err:   PatchError{Index: 0, Op: "replace", Path: "/a", Reason: "missing value"},
+	}, {
+		name:  "should fail with invalid pointer",
+		ctype: contentTypeJSONPatch,
+		body:  `[{"op":"copy","path":"/a","from":"b"}]`,
+		want:  PatchDocument{{Op: "copy", Path: "/a", From: "b"}},
+		err:   PatchError{Index: 0, Op: "copy", Path: "/a", Reason: `invalid from: invalid json pointer "b"`},
+	}, {
+		name:  "should decode patch document",
+		ctype: contentTypeJSONPatch,
+		body:  `[{"op":"test","path":"/a~1b","value":null},{"op":"move","path":"/c","from":"/d"}]`,
+		want: PatchDocument{
+			{Op: "test", Path: "/a~1b", Value: []byte(`null`)},
+			{Op: "move", Path: "/c", From: "/d"},
+		},
+	}}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := &http.Request{Header: http.Header{"Content-Type": {tt.ctype}},
+				Body: strReadCloser{strings.NewReader(tt.body)}}
+
+			var doc PatchDocument
+			err := JSONPatch{&doc}.ReadBody(r)
+			if e := compare.Compare(err, tt.err); e != nil {
+				t.Error(e)
+			}
+			if e := compare.Compare(doc, tt.want); e != nil {
+				t.Error(e)
+			}
+		})
+	}
+}
+
+func TestPatchDocument_Apply(t *testing.T) {
+	tests := []struct {
+		name string
+		doc  string
+		val  testPatchValue
+		want testPatchValue
+		err  error
+	}{{
+		name: "add member",
+		doc:  `[{"op":"add","path":"/baz","value":{"foo":"x"}}]`,
+		val:  testPatchValue{Foo: "a"},
+		want: testPatchValue{Foo: "a", Baz: &testPatchValue{Foo: "x"}},
+	}, {
+		name: "add array element",
+		doc:  `[{"op":"add","path":"/bar/1","value":9},{"op":"add","path":"/bar/-","value":10}]`,
+		val:  testPatchValue{Bar: []int{1, 2}},
+		want: testPatchValue{Bar: []int{1, 9, 2, 10}},
+	}, {
+		name: "remove",
+		doc:  `[{"op":"remove","path":"/bar/0"},{"op":"remove","path":"/tags/a~1b"}]`,
+		val:  testPatchValue{Bar: []int{1, 2}, Tags: map[string]string{"a/b": "x", "c": "y"}},
+		want: testPatchValue{Bar: []int{2}, Tags: map[string]string{"c": "y"}},
+	}, {
+		name: "replace",
+		doc:  `[{"op":"replace","path":"/foo","value":"b"}]`,
+		val:  testPatchValue{Foo: "a"},
+		want: testPatchValue{Foo: "b"},
+	}, {
+		name: "move",
+		doc:  `[{"op":"move","path":"/foo","from":"/baz/foo"}]`,
+		val:  testPatchValue{Foo: "a", Baz: &testPatchValue{Foo: "b"}},
+		want: testPatchValue{Foo: "b", Baz: &testPatchValue{}},
+	}, {
+		name: "copy",
+		doc:  `[{"op":"copy","path":"/baz/bar","from":"/bar"},{"op":"add","path":"/bar/0","value":0}]`,
+		val:  testPatchValue{Bar: []int{1}, Baz: &testPatchValue{}},
+		want: testPatchValue{Bar: []int{0, 1}, Baz: &testPatchValue{Bar: []int{1}}},
+	}, {
+		name: "test passes with numerically equal values",
+		doc:  `[{"op":"test","path":"/bar","value":[1.0,2e0]},{"op":"replace","path":"/foo","value":"b"}]`,
+		val:  testPatchValue{Foo: "a", Bar: []int{1, 2}},
+		want: testPatchValue{Foo: "b", Bar: []int{1, 2}},
+	}, {
+		name: "test fails and leaves value unchanged",
+		doc:  `[{"op":"replace","path":"/foo","value":"b"},{"op":"test","path":"/foo","value":"c"}]`,
+		val:  testPatchValue{Foo: "a", Qux: 1},
+		want: testPatchValue{Foo: "a", Qux: 1},
+		err:  PatchError{Index: 1, Op: "test", Path: "/foo", Reason: "test failed", Err: errPatchTestFailed},
+	}, {
+		name: "path not found",
+		doc:  `[{"op":"replace","path":"/baz/foo","value":"b"}]`,
+		val:  testPatchValue{Foo: "a"},
+		want: testPatchValue{Foo: "a"},
+		err:  PatchError{Index: 0, Op: "replace", Path: "/baz/foo", Reason: "path not found", Err: errPatchPathNotFound},
+	}, {
+		name: "array index out of range",
+		doc:  `[{"op":"add","path":"/bar/3","value":1}]`,
+		val:  testPatchValue{Bar: []int{1}},
+		want: testPatchValue{Bar: []int{1}},
+		err:  PatchError{Index: 0, Op: "add", Path: "/bar/3", Reason: "path not found", Err: errPatchPathNotFound},
+	}, {
+		name: "move into own child",
+		doc:  `[{"op":"move","path":"/baz/baz","from":"/baz"}]`,
+		val:  testPatchValue{Baz: &testPatchValue{}},
+		want: testPatchValue{Baz: &testPatchValue{}},
+		err: PatchError{Index: 0, Op: "move", Path: "/baz/baz",
+			Reason: "cannot move a value into one of its children", Err: errPatchMoveIntoChild},
+	}}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := &http.Request{Header: http.Header{"Content-Type": {contentTypeJSONPatch}},
+				Body: strReadCloser{strings.NewReader(tt.doc)}}
+
+			var doc PatchDocument
+			if err := (JSONPatch{&doc}).ReadBody(r); err != nil {
+				t.Fatal(err)
+			}
+
+			val := tt.val
+			err := doc.Apply(&val)
+			if e := compare.Compare(err, tt.err); e != nil {
+				t.Error(e)
+			}
+			if e := compare.Compare(val, tt.want); e != nil {
+				t.Error(e)
+			}
+		})
+	}
+}
+
+func TestPatchError_StatusCode(t *testing.T) {
+	if got := (PatchError{Op: "test", Reason: "test failed", Err: errPatchTestFailed}).StatusCode(); got != http.StatusConflict {
+		t.Errorf("got %d, want %d", got, http.StatusConflict)
+	}
+	if got := (PatchError{Op: "add", Reason: "path not found", Err: errPatchPathNotFound}).StatusCode(); got != http.StatusUnprocessableEntity {
+		t.Errorf("got %d, want %d", got, http.StatusUnprocessableEntity)
+	}
+}
+
+func TestMergePatch(t *testing.T) {
+	tests := []struct {
+		name  string
+		ctype string
+		doc   string
+		val   testPatchValue
+		want  testPatchValue
+		err   error
+	}{{
+		name:  "should fail with wrong content type",
+		ctype: contentTypeJSONPatch,
+		doc:   `{}`,
+		err:   UnsupportedMediaTypeError{MediaType: contentTypeJSONPatch, Accepted: []string{contentTypeMergePatch}},
+	}, {
+		name:  "should merge document",
+		ctype: contentTypeMergePatch,
+		doc:   `{"foo":"b","bar":null,"baz":{"foo":"y","tags":{"k":"v"}},"tags":{"a":null,"c":"d"}}`,
+		val: testPatchValue{Foo: "a", Bar: []int{1}, Baz: &testPatchValue{Foo: "x", Bar: []int{2}},
+			Tags: map[string]string{"a": "b"}},
+		want: testPatchValue{Foo: "b", Baz: &testPatchValue{Foo: "y", Bar: []int{2}, Tags: map[string]string{"k": "v"}},
+			Tags: map[string]string{"c": "d"}},
+	}}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := &http.Request{Header: http.Header{"Content-Type": {tt.ctype}},
+				Body: strReadCloser{strings.NewReader(tt.doc)}}
+
+			var doc MergeDocument
+			err := MergePatch{&doc}.ReadBody(r)
+			if e := compare.Compare(err, tt.err); e != nil {
+				t.Error(e)
+			}
+			if err != nil {
+				return
+			}
+
+			val := tt.val
+			if err := doc.Apply(&val); err != nil {
+				t.Fatal(err)
+			}
+			if e := compare.Compare(val, tt.want); e != nil {
+				t.Error(e)
+			}
+		})
+	}
+}
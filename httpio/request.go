@@ -41,6 +41,14 @@ type RequestReader struct {
 	Path PathReader
 	// If set, will read the body from the incoming request.
 	Body BodyReader
+	// If set, limits the size of the incoming request's body to MaxBodyBytes
+	// bytes. A limit set on the BodyReader itself takes precedence.
+	MaxBodyBytes int64
+	// If set, the incoming request's body will be decompressed according
+	// to its Content-Encoding header before being read by the BodyReader,
+	// see the Decompress type. The MaxBodyBytes limit, if set, is
+	// applied to both the compressed and the decompressed body.
+	Decompress bool
 
 	// the original request, set by ReadRequest
 	r *http.Request
@@ -72,6 +80,10 @@ func (rr *RequestReader) ReadRequest(r *http.Request, c context.Context) error {
 	}
 
 	if rr.Body != nil {
+		LimitBody(nil, r, rr.MaxBodyBytes)
+		if rr.Decompress {
+			return Decompress{Body: rr.Body, MaxBytes: rr.MaxBodyBytes}.ReadBody(r)
+		}
 		return rr.Body.ReadBody(r)
 	}
 
@@ -24,6 +24,21 @@ type ResponseWriter struct {
 	Body BodyWriter
 	// If set, will be used as the HTTP status code of the outgoing response.
 	Status int
+	// If set, the body of the outgoing response will be compressed
+	// according to the request's Accept-Encoding header.
+	Compress *Compression
+	// If set, an ETag will be computed from the body of a 200 (Status OK)
+	// response, unless the BodyWriter set the ETag header itself, and a GET
+	// or HEAD request whose If-None-Match header matches the ETag, or whose
+	// If-Modified-Since header is not older than the Last-Modified header,
+	// will be answered with 304 (Not Modified) instead.
+	//
+	// Since the body needs to be buffered to compute the ETag, this applies
+	// only to the data written by the BodyWriter's WriteBody method, StreamWriters
+	// write to the http.ResponseWriter directly and are therefore not covered.
+	// If the body is compressed, the ETag is computed from the compressed body,
+	// so that each content coding has its own entity tag.
+	ETag ETagMode
 }
 
 // ResponseWriter implements the InitResponse method of the Handler interface.
@@ -41,12 +56,89 @@ func (rw *ResponseWriter) WriteResponse(w http.ResponseWriter, r *http.Request)
 	}
 
 	if rw.Body != nil {
-		if rw.Status > 0 {
-			return rw.Body.WriteBody(w, r, rw.Status)
+		status := rw.Status
+		if status <= 0 {
+			status = http.StatusOK // default to 200
 		}
-		return rw.Body.WriteBody(w, r, http.StatusOK) // default to 200
+		if rw.ETag != NoETag && r != nil {
+			return rw.writeTagged(w, r, status)
+		}
+		return rw.writeBody(w, r, status, rw.Body)
 	} else if rw.Status > 0 {
 		w.WriteHeader(rw.Status)
 	}
 	return nil
 }
+
+// writeBody writes the body using the given BodyWriter,
+// compressing it if the Compress field is set.
+func (rw *ResponseWriter) writeBody(w http.ResponseWriter, r *http.Request, status int, body BodyWriter) error {
+	if rw.Compress != nil && r != nil {
+		return rw.writeCompressed(w, r, status, body)
+	}
+	return body.WriteBody(w, r, status)
+}
+
+// writeTagged buffers the body, sets the ETag header, and then writes
+// either the buffered body or, if the request's conditional headers
+// allow it, a 304 (Not Modified) response without a body.
+func (rw *ResponseWriter) writeTagged(w http.ResponseWriter, r *http.Request, status int) error {
+	buf := &bufferedResponse{header: w.Header()}
+	if err := rw.Body.WriteBody(buf, r, status); err != nil {
+		return err
+	}
+	if buf.status == 0 {
+		buf.status = http.StatusOK
+	}
+	if buf.status != http.StatusOK {
+		return rw.writeBody(w, r, buf.status, buf)
+	}
+
+	// The body is encoded before the ETag is computed since the
+	// compressed and the identity representations must not share
+	// the same strong validator. This also sets the Vary header
+	// which must be sent with the 304 response as well.
+	h := w.Header()
+	if rw.Compress != nil {
+		enc := &bufferedResponse{header: h}
+		if err := rw.writeCompressed(enc, r, buf.status, buf); err != nil {
+			return err
+		}
+		buf = enc
+	}
+	if len(h.Get("ETag")) == 0 {
+		h.Set("ETag", computeETag(buf.body.Bytes(), rw.ETag).String())
+	}
+	if notModified(r, h) {
+		h.Del("Content-Type")
+		h.Del("Content-Length")
+		h.Del("Content-Encoding")
+		w.WriteHeader(http.StatusNotModified)
+		return nil
+	}
+	return buf.WriteBody(w, r, buf.status)
+}
+
+// writeCompressed writes the body through a compressWriter. If the BodyWriter
+// fails before anything has been written, the buffered data is discarded so
+// that the error can still be written to the original http.ResponseWriter.
+func (rw *ResponseWriter) writeCompressed(w http.ResponseWriter, r *http.Request, status int, body BodyWriter) error {
+	addVary(w.Header(), "Accept-Encoding")
+
+	enc := negotiateEncoding(r.Header.Get("Accept-Encoding"))
+	if len(enc) == 0 {
+		return body.WriteBody(w, r, status)
+	}
+
+	cw := rw.Compress.newWriter(w, enc)
+	if err := body.WriteBody(cw, r, status); err != nil {
+		if cw.decided {
+			cw.Close()
+		}
+		return err
+	}
+	if err := cw.Close(); err != nil {
+		return WriteError{err}
+	}
+	return nil
+}
@@ -0,0 +1,227 @@
+package httpio
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// The defaults used by SecurityHeaders.
+const (
+	defaultHSTSMaxAge        = 365 * 24 * time.Hour
+	defaultReferrerPolicy    = "strict-origin-when-cross-origin"
+	defaultPermissionsPolicy = "camera=(), microphone=(), geolocation=(), payment=()"
+)
+
+// defaultCSP is the Content-Security-Policy used by SecurityHeaders if none was provided.
+var defaultCSP = CSP{
+	DefaultSrc:     []string{"'self'"},
+	ScriptSrc:      []string{"'self'"},
+	ObjectSrc:      []string{"'none'"},
+	BaseURI:        []string{"'self'"},
+	FrameAncestors: []string{"'none'"},
+	ScriptNonce:    true,
+}
+
+// SecurityHeaders can be used to set the security related headers of the
+// outgoing response, i.e. Strict-Transport-Security, X-Content-Type-Options,
+// X-Frame-Options, Referrer-Policy, Permissions-Policy, and the
+// Content-Security-Policy. The zero value sets all of the headers
+// using sane defaults.
+//
+// If the CSP's ScriptNonce or StyleNonce is set, a new nonce is generated
+// every time the header is written, i.e. once per request, and added to the
+// policy. The HTML BodyWriter then makes the nonce available to its templates
+// through the cspNonce function, see HTMLFuncs.
+type SecurityHeaders struct {
+	// The max-age of the Strict-Transport-Security header, truncated to
+	// seconds. If zero, one year will be used. If negative, the header
+	// is not set.
+	HSTSMaxAge time.Duration
+	// The includeSubDomains directive of the Strict-Transport-Security header.
+	HSTSIncludeSubdomains bool
+	// The preload directive of the Strict-Transport-Security header.
+	HSTSPreload bool
+	// The value of the X-Frame-Options header. If not set, "DENY"
+	// will be used. If set to "-", the header is not set.
+	FrameOptions string
+	// The value of the Referrer-Policy header. If not set,
+	// "strict-origin-when-cross-origin" will be used. If
+	// set to "-", the header is not set.
+	ReferrerPolicy string
+	// The value of the Permissions-Policy header. If not set, the camera,
+	// microphone, geolocation, and payment features will be disabled.
+	// If set to "-", the header is not set.
+	PermissionsPolicy string
+	// The Content-Security-Policy. If nil, a policy that allows only
+	// same-origin resources, and scripts with the request's nonce,
+	// will be used.
+	CSP *CSP
+	// If set, the policy will be sent in the Content-Security-Policy-Report-Only
+	// header, instead of the Content-Security-Policy header.
+	CSPReportOnly bool
+}
+
+// WriteHeader implements the HeaderWriter interface.
+func (sh SecurityHeaders) WriteHeader(header http.Header) {
+	if sh.HSTSMaxAge >= 0 {
+		maxAge := sh.HSTSMaxAge
+		if maxAge == 0 {
+			maxAge = defaultHSTSMaxAge
+		}
+		hsts := "max-age=" + strconv.FormatInt(int64(maxAge/time.Second), 10)
+		if sh.HSTSIncludeSubdomains {
+			hsts += "; includeSubDomains"
+		}
+		if sh.HSTSPreload {
+			hsts += "; preload"
+		}
+		header.Set("Strict-Transport-Security", hsts)
+	}
+
+	header.Set("X-Content-Type-Options", "nosniff")
+	setSecurityHeader(header, "X-Frame-Options", sh.FrameOptions, "DENY")
+	setSecurityHeader(header, "Referrer-Policy", sh.ReferrerPolicy, defaultReferrerPolicy)
+	setSecurityHeader(header, "Permissions-Policy", sh.PermissionsPolicy, defaultPermissionsPolicy)
+
+	csp := sh.CSP
+	if csp == nil {
+		csp = &defaultCSP
+	}
+	var nonce string
+	if csp.ScriptNonce || csp.StyleNonce {
+		nonce = newNonce()
+	}
+	if v := csp.String(nonce); len(v) > 0 {
+		if sh.CSPReportOnly {
+			header.Set("Content-Security-Policy-Report-Only", v)
+		} else {
+			header.Set("Content-Security-Policy", v)
+		}
+	}
+}
+
+// setSecurityHeader sets the named header to value, or to def if the value
+// is empty. If the value is "-", the header is not set.
+func setSecurityHeader(header http.Header, name, value, def string) {
+	if value == "-" {
+		return
+	}
+	if len(value) == 0 {
+		value = def
+	}
+	header.Set(name, value)
+}
+
+// CSP can be used to build the value of a Content-Security-Policy header.
+// The source lists are written as is, therefore keywords need to be quoted,
+// e.g. "'self'", "'none'", or "'unsafe-inline'".
+type CSP struct {
+	// The default-src directive.
+	DefaultSrc []string
+	// The script-src directive.
+	ScriptSrc []string
+	// The style-src directive.
+	StyleSrc []string
+	// The img-src directive.
+	ImgSrc []string
+	// The connect-src directive.
+	ConnectSrc []string
+	// The font-src directive.
+	FontSrc []string
+	// The media-src directive.
+	MediaSrc []string
+	// The object-src directive.
+	ObjectSrc []string
+	// The frame-src directive.
+	FrameSrc []string
+	// The worker-src directive.
+	WorkerSrc []string
+	// The base-uri directive.
+	BaseURI []string
+	// The form-action directive.
+	FormAction []string
+	// The frame-ancestors directive.
+	FrameAncestors []string
+	// The upgrade-insecure-requests directive.
+	UpgradeInsecureRequests bool
+	// The report-uri directive.
+	ReportURI string
+	// If set, the nonce will be added to the script-src directive.
+	ScriptNonce bool
+	// If set, the nonce will be added to the style-src directive.
+	StyleNonce bool
+}
+
+// String returns the value of the Content-Security-Policy header. If
+// the nonce is not empty it is added to the script-src and style-src
+// directives as configured by the ScriptNonce and StyleNonce fields.
+func (csp CSP) String(nonce string) string {
+	scriptSrc, styleSrc := csp.ScriptSrc, csp.StyleSrc
+	if len(nonce) > 0 {
+		if csp.ScriptNonce {
+			scriptSrc = append(scriptSrc[:len(scriptSrc):len(scriptSrc)], "'nonce-"+nonce+"'")
+		}
+		if csp.StyleNonce {
+			styleSrc = append(styleSrc[:len(styleSrc):len(styleSrc)], "'nonce-"+nonce+"'")
+		}
+	}
+
+	var dirs []string
+	add := func(name string, sources []string) {
+		if len(sources) > 0 {
+			dirs = append(dirs, name+" "+strings.Join(sources, " "))
+		}
+	}
+	add("default-src", csp.DefaultSrc)
+	add("script-src", scriptSrc)
+	add("style-src", styleSrc)
+	add("img-src", csp.ImgSrc)
+	add("connect-src", csp.ConnectSrc)
+	add("font-src", csp.FontSrc)
+	add("media-src", csp.MediaSrc)
+	add("object-src", csp.ObjectSrc)
+	add("frame-src", csp.FrameSrc)
+	add("worker-src", csp.WorkerSrc)
+	add("base-uri", csp.BaseURI)
+	add("form-action", csp.FormAction)
+	add("frame-ancestors", csp.FrameAncestors)
+	if csp.UpgradeInsecureRequests {
+		dirs = append(dirs, "upgrade-insecure-requests")
+	}
+	if len(csp.ReportURI) > 0 {
+		dirs = append(dirs, "report-uri "+csp.ReportURI)
+	}
+	return strings.Join(dirs, "; ")
+}
+
+// newNonce returns a new random nonce. If the random source
+// fails an empty string is returned, in which case no nonce
+// is added to the policy and the nonced scripts are blocked.
+func newNonce() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return ""
+	}
+	return base64.StdEncoding.EncodeToString(b)
+}
+
+// cspNonce returns the nonce from the Content-Security-Policy header,
+// or the Content-Security-Policy-Report-Only header, or an empty string
+// if the policy has no nonce.
+func cspNonce(header http.Header) string {
+	csp := header.Get("Content-Security-Policy")
+	if len(csp) == 0 {
+		csp = header.Get("Content-Security-Policy-Report-Only")
+	}
+	if i := strings.Index(csp, "'nonce-"); i >= 0 {
+		csp = csp[i+len("'nonce-"):]
+		if j := strings.IndexByte(csp, '\''); j >= 0 {
+			return csp[:j]
+		}
+	}
+	return ""
+}
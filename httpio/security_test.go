@@ -0,0 +1,101 @@
+package httpio
+
+import (
+	"net/http"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/frk/compare"
+)
+
+func TestSecurityHeaders_WriteHeader(t *testing.T) {
+	tests := []struct {
+		name string
+		sh   SecurityHeaders
+		want http.Header
+	}{{
+		name: "defaults",
+		sh:   SecurityHeaders{},
+		want: http.Header{
+			"Strict-Transport-Security": {"max-age=31536000"},
+			"X-Content-Type-Options":    {"nosniff"},
+			"X-Frame-Options":           {"DENY"},
+			"Referrer-Policy":           {"strict-origin-when-cross-origin"},
+			"Permissions-Policy":        {"camera=(), microphone=(), geolocation=(), payment=()"},
+			"Content-Security-Policy": {"default-src 'self'; script-src 'self' 'nonce-NONCE'; " +
+				"object-src 'none'; base-uri 'self'; frame-ancestors 'none'"},
+		},
+	}, {
+		name: "custom",
+		sh: SecurityHeaders{
+			HSTSMaxAge:            time.Hour,
+			HSTSIncludeSubdomains: true,
+			HSTSPreload:           true,
+			FrameOptions:          "-",
+			ReferrerPolicy:        "no-referrer",
+			PermissionsPolicy:     "-",
+			CSP: &CSP{
+				DefaultSrc:              []string{"'none'"},
+				StyleSrc:                []string{"'self'", "https://fonts.example.com"},
+				ImgSrc:                  []string{"*"},
+				UpgradeInsecureRequests: true,
+				ReportURI:               "/csp-report",
+				StyleNonce:              true,
+			},
+			CSPReportOnly: true,
+		},
+		want: http.Header{
+			"Strict-Transport-Security": {"max-age=3600; includeSubDomains; preload"},
+			"X-Content-Type-Options":    {"nosniff"},
+			"Referrer-Policy":           {"no-referrer"},
+			"Content-Security-Policy-Report-Only": {"default-src 'none'; " +
+				"style-src 'self' https://fonts.example.com 'nonce-NONCE'; img-src *; " +
+				"upgrade-insecure-requests; report-uri /csp-report"},
+		},
+	}, {
+		name: "no hsts, no nonce",
+		sh:   SecurityHeaders{HSTSMaxAge: -1, CSP: &CSP{DefaultSrc: []string{"'self'"}}},
+		want: http.Header{
+			"X-Content-Type-Options":  {"nosniff"},
+			"X-Frame-Options":         {"DENY"},
+			"Referrer-Policy":         {"strict-origin-when-cross-origin"},
+			"Permissions-Policy":      {"camera=(), microphone=(), geolocation=(), payment=()"},
+			"Content-Security-Policy": {"default-src 'self'"},
+		},
+	}}
+
+	rx := regexp.MustCompile(`'nonce-[A-Za-z0-9+/]{22}=='`)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := http.Header{}
+			tt.sh.WriteHeader(got)
+			for k, v := range got {
+				if k == "Content-Security-Policy" || k == "Content-Security-Policy-Report-Only" {
+					got[k] = []string{rx.ReplaceAllString(v[0], "'nonce-NONCE'")}
+				}
+			}
+			if e := compare.Compare(got, tt.want); e != nil {
+				t.Error(e)
+			}
+		})
+	}
+}
+
+func TestSecurityHeaders_Nonce(t *testing.T) {
+	sh := SecurityHeaders{}
+	h1, h2 := http.Header{}, http.Header{}
+	sh.WriteHeader(h1)
+	sh.WriteHeader(h2)
+
+	n1, n2 := cspNonce(h1), cspNonce(h2)
+	if len(n1) == 0 || len(n2) == 0 {
+		t.Fatalf("got empty nonces %q, %q", n1, n2)
+	}
+	if n1 == n2 {
+		t.Errorf("got the same nonce %q for two requests", n1)
+	}
+	if e := compare.Compare(defaultCSP.ScriptSrc, []string{"'self'"}); e != nil {
+		t.Error(e)
+	}
+}
@@ -0,0 +1,292 @@
+package httpio
+
+import (
+	"bytes"
+	"encoding"
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// The SparseJSON type implements the BodyWriter interface by projecting the
+// value onto the fieldset requested by the client before json encoding it.
+//
+// The fieldset is read from the "fields" query parameter of the request as a
+// comma separated list of field names, as specified by the values' json tags,
+// with nested fields denoted by dot-separated paths, e.g. "?fields=id,owner.email".
+// If the fieldset is absent the whole value will be encoded. Slices and arrays
+// are projected element-wise.
+type SparseJSON struct {
+	// The value to be projected, json encoded and sent in an HTTP response body.
+	Val interface{}
+	// The name of the query parameter holding the fieldset.
+	// If not set, "fields" will be used.
+	Param string
+}
+
+// WriteInit is a noop, required only to satisfy the BodyWriter interface.
+func (SparseJSON) WriteInit(_ http.ResponseWriter) error {
+	return nil
+}
+
+// WriteBody implements the BodyWriter interface by projecting the receiver's
+// Val field onto the requested fieldset and then json encoding the result.
+// If the fieldset contains an unknown field a FieldsetError will be returned
+// before anything is written to the response.
+func (s SparseJSON) WriteBody(w http.ResponseWriter, r *http.Request, statusCode int) error {
+	param := s.Param
+	if len(param) == 0 {
+		param = "fields"
+	}
+
+	var fields string
+	if r != nil && r.URL != nil {
+		fields = r.URL.Query().Get(param)
+	}
+	fs := parseFieldset(fields)
+	if len(fs) == 0 {
+		return JSON{Val: s.Val}.WriteBody(w, r, statusCode)
+	}
+
+	if err := validateFieldset(reflect.TypeOf(s.Val), fs, ""); err != nil {
+		return err
+	}
+	v, err := projectFields(reflect.ValueOf(s.Val), fs, "")
+	if err != nil {
+		return err
+	}
+	return JSON{Val: v}.WriteBody(w, r, statusCode)
+}
+
+// fieldset is a tree of requested fields, a nil fieldset
+// represents the selection of a whole value.
+type fieldset map[string]fieldset
+
+// parseFieldset parses the given list of comma separated, dot-delimited
+// field paths into a fieldset tree.
+func parseFieldset(s string) fieldset {
+	root := fieldset{}
+	for _, path := range strings.Split(s, ",") {
+		if path = strings.TrimSpace(path); len(path) == 0 {
+			continue
+		}
+
+		fs := root
+		names := strings.Split(path, ".")
+		for i, name := range names {
+			sub, ok := fs[name]
+			if ok && sub == nil {
+				break // whole value already selected
+			}
+			if i == len(names)-1 {
+				fs[name] = nil
+				break
+			}
+			if !ok {
+				sub = fieldset{}
+				fs[name] = sub
+			}
+			fs = sub
+		}
+	}
+	return root
+}
+
+var (
+	jsonMarshalerType = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+	textMarshalerType = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+)
+
+// isMarshalerType reports whether the given type, or a pointer to it,
+// implements the json.Marshaler or the encoding.TextMarshaler interface.
+func isMarshalerType(t reflect.Type) bool {
+	return t.Implements(jsonMarshalerType) || t.Implements(textMarshalerType) ||
+		reflect.PtrTo(t).Implements(jsonMarshalerType) || reflect.PtrTo(t).Implements(textMarshalerType)
+}
+
+// validateFieldset checks that all the fields present in the given fieldset
+// can be selected from a value of type t. Fields of interface types cannot be
+// validated statically, they are validated against the dynamic type of their
+// value by projectFields. The path argument is the dot-delimited path to the
+// value of type t, used for error reporting.
+func validateFieldset(t reflect.Type, fs fieldset, path string) error {
+	for t != nil && t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t == nil || t.Kind() == reflect.Interface {
+		return nil
+	}
+	if isMarshalerType(t) {
+		return FieldsetError{joinFieldPath(path, fs.names()[0])}
+	}
+
+	switch t.Kind() {
+	case reflect.Struct:
+		fields := structFields(t, "json")
+		for _, name := range fs.names() {
+			f, ok := findStructField(fields, name)
+			if !ok {
+				return FieldsetError{joinFieldPath(path, name)}
+			}
+			if sub := fs[name]; sub != nil {
+				if err := validateFieldset(t.FieldByIndex(f.index).Type, sub, joinFieldPath(path, name)); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	case reflect.Map:
+		if t.Key().Kind() != reflect.String {
+			break
+		}
+		for _, name := range fs.names() {
+			if sub := fs[name]; sub != nil {
+				if err := validateFieldset(t.Elem(), sub, joinFieldPath(path, name)); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			break
+		}
+		return validateFieldset(t.Elem(), fs, path)
+	}
+
+	return FieldsetError{joinFieldPath(path, fs.names()[0])}
+}
+
+// projectFields returns a representation of v that contains only the fields
+// present in the given fieldset. The fieldset is expected to have been checked
+// against the type of v with validateFieldset. The path argument is the
+// dot-delimited path to v, used for error reporting.
+func projectFields(v reflect.Value, fs fieldset, path string) (interface{}, error) {
+	for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return nil, nil
+		}
+		if v.Kind() == reflect.Interface {
+			if err := validateFieldset(v.Elem().Type(), fs, path); err != nil {
+				return nil, err
+			}
+		}
+		v = v.Elem()
+	}
+	if !v.IsValid() {
+		return nil, nil
+	}
+
+	switch v.Kind() {
+	case reflect.Struct:
+		fields := structFields(v.Type(), "json")
+		out := make(sparseObject, 0, len(fs))
+		for _, f := range fields {
+			sub, ok := fs[f.name]
+			if !ok {
+				continue
+			}
+
+			fv := fieldByIndex(v, f.index)
+			if !fv.IsValid() || (f.omitEmpty && isEmptyValue(fv)) {
+				continue // nil embedded pointer or empty value
+			}
+			if sub == nil {
+				out = append(out, sparseField{f.name, fv.Interface()})
+				continue
+			}
+			pv, err := projectFields(fv, sub, joinFieldPath(path, f.name))
+			if err != nil {
+				return nil, err
+			}
+			out = append(out, sparseField{f.name, pv})
+		}
+		return out, nil
+	case reflect.Map:
+		t := v.Type()
+		out := make(map[string]interface{}, len(fs))
+		for name, sub := range fs {
+			mv := v.MapIndex(reflect.ValueOf(name).Convert(t.Key()))
+			if !mv.IsValid() {
+				continue
+			}
+			if sub == nil {
+				out[name] = mv.Interface()
+				continue
+			}
+			pv, err := projectFields(mv, sub, joinFieldPath(path, name))
+			if err != nil {
+				return nil, err
+			}
+			out[name] = pv
+		}
+		return out, nil
+	case reflect.Slice, reflect.Array:
+		if v.Kind() == reflect.Slice && v.IsNil() {
+			return nil, nil
+		}
+		out := make([]interface{}, v.Len())
+		for i := 0; i < v.Len(); i++ {
+			pv, err := projectFields(v.Index(i), fs, path)
+			if err != nil {
+				return nil, err
+			}
+			out[i] = pv
+		}
+		return out, nil
+	}
+
+	return nil, FieldsetError{joinFieldPath(path, fs.names()[0])}
+}
+
+// sparseObject is the projection of a struct, it is json encoded as an
+// object with the fields in the same order as they appear in the struct.
+type sparseObject []sparseField
+
+type sparseField struct {
+	name string
+	val  interface{}
+}
+
+// MarshalJSON implements the json.Marshaler interface.
+func (o sparseObject) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for i, f := range o {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		name, err := json.Marshal(f.name)
+		if err != nil {
+			return nil, err
+		}
+		val, err := json.Marshal(f.val)
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(name)
+		buf.WriteByte(':')
+		buf.Write(val)
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+func joinFieldPath(path, name string) string {
+	if len(path) == 0 {
+		return name
+	}
+	return path + "." + name
+}
+
+// names returns the sorted names of the fields in the fieldset.
+func (fs fieldset) names() []string {
+	names := make([]string, 0, len(fs))
+	for name := range fs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
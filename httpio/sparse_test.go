@@ -0,0 +1,133 @@
+package httpio
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/frk/compare"
+)
+
+type testOwner struct {
+	ID    int    `json:"id"`
+	Email string `json:"email"`
+}
+
+type testAudit struct {
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type testItem struct {
+	ID     int        `json:"id"`
+	Name   string     `json:"name"`
+	Secret string     `json:"-"`
+	Owner  *testOwner `json:"owner"`
+	Tags   []string   `json:"tags"`
+	Note   string     `json:"note,omitempty"`
+	testAudit
+}
+
+func TestSparseJSON_WriteBody(t *testing.T) {
+	created := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	item := testItem{ID: 1, Name: "foo", Secret: "x", Owner: &testOwner{7, "a@b.c"},
+		Tags: []string{"a"}, testAudit: testAudit{created}}
+
+	tests := []struct {
+		name string
+		url  string
+		val  interface{}
+		want string
+		err  error
+	}{{
+		name: "no fieldset",
+		url:  "/items/1",
+		val:  testOwner{7, "a@b.c"},
+		want: `{"id":7,"email":"a@b.c"}` + "\n",
+	}, {
+		name: "top level fields",
+		url:  "/items/1?fields=id,tags",
+		val:  item,
+		want: `{"id":1,"tags":["a"]}` + "\n",
+	}, {
+		name: "nested fields",
+		url:  "/items/1?fields=name,owner.email",
+		val:  &item,
+		want: `{"name":"foo","owner":{"email":"a@b.c"}}` + "\n",
+	}, {
+		name: "promoted field",
+		url:  "/items/1?fields=created_at",
+		val:  item,
+		want: `{"created_at":"2020-01-02T03:04:05Z"}` + "\n",
+	}, {
+		name: "slice",
+		url:  "/items?fields=id,owner",
+		val:  []testItem{item, {ID: 2}},
+		want: `[{"id":1,"owner":{"id":7,"email":"a@b.c"}},{"id":2,"owner":null}]` + "\n",
+	}, {
+		name: "map",
+		url:  "/items/1?fields=a.id,c",
+		val:  map[string]interface{}{"a": testOwner{ID: 3}, "b": 2},
+		want: `{"a":{"id":3}}` + "\n",
+	}, {
+		name: "struct field order",
+		url:  "/items/1?fields=tags,name,id",
+		val:  item,
+		want: `{"id":1,"name":"foo","tags":["a"]}` + "\n",
+	}, {
+		name: "omitempty",
+		url:  "/items/1?fields=id,note",
+		val:  item,
+		want: `{"id":1}` + "\n",
+	}, {
+		name: "unknown field of nil pointer",
+		url:  "/items/1?fields=owner.name",
+		val:  testItem{ID: 1},
+		err:  FieldsetError{"owner.name"},
+	}, {
+		name: "unknown field of empty slice",
+		url:  "/items?fields=id,secret",
+		val:  []testItem{},
+		err:  FieldsetError{"secret"},
+	}, {
+		name: "unknown field of interface value",
+		url:  "/items/1?fields=a.name",
+		val:  map[string]interface{}{"a": testOwner{ID: 3}},
+		err:  FieldsetError{"a.name"},
+	}, {
+		name: "unknown field",
+		url:  "/items/1?fields=id,secret",
+		val:  item,
+		err:  FieldsetError{"secret"},
+	}, {
+		name: "unknown nested field",
+		url:  "/items/1?fields=owner.name",
+		val:  item,
+		err:  FieldsetError{"owner.name"},
+	}, {
+		name: "field of scalar",
+		url:  "/items/1?fields=name.first",
+		val:  item,
+		err:  FieldsetError{"name.first"},
+	}, {
+		name: "field of marshaler",
+		url:  "/items/1?fields=created_at.year",
+		val:  item,
+		err:  FieldsetError{"created_at.year"},
+	}}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", tt.url, nil)
+			w := httptest.NewRecorder()
+
+			err := SparseJSON{Val: tt.val}.WriteBody(w, r, http.StatusOK)
+			if e := compare.Compare(err, tt.err); e != nil {
+				t.Error(e)
+			}
+			if e := compare.Compare(w.Body.String(), tt.want); e != nil {
+				t.Error(e)
+			}
+		})
+	}
+}
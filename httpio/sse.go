@@ -0,0 +1,232 @@
+package httpio
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// The SSE type implements the BodyWriter interface by using a StreamWriter.
+type SSE struct {
+	Stream StreamWriter
+}
+
+// WriteInit opens the underlying StreamWriter.
+func (s SSE) WriteInit(w http.ResponseWriter) error {
+	s.Stream.Open(w)
+	return nil
+}
+
+// WriteBody flushes the underlying StreamWriter.
+func (s SSE) WriteBody(_ http.ResponseWriter, _ *http.Request, _ int) error {
+	if err := s.Stream.Flush(); err != nil {
+		return WriteError{err}
+	}
+	return nil
+}
+
+const contentTypeEventStream = "text/event-stream"
+
+// SSEWriter implements the StreamWriter interface for Server-Sent Events and
+// is intended to be embedded by user-defined structs that want to implement
+// custom event stream writers.
+//
+// The stream is opened lazily, the header is written by the first call to Send
+// or Comment, hence a handler can still fail with a regular error response
+// until it sends its first event. Each event is flushed to the client as
+// soon as it's written.
+type SSEWriter struct {
+	// If set, the stream stops once the context is done, i.e. Send and Comment
+	// will return the context's error. Usually set to the request's context.
+	Context context.Context
+	// If set, will be sent to the client as the reconnection time
+	// when the stream is opened.
+	Retry time.Duration
+	// If set, a comment will be sent to the client every Heartbeat interval
+	// to keep the connection alive. The heartbeat is stopped by Flush, or
+	// when the Context is done, and therefore it requires the Context to be set.
+	Heartbeat time.Duration
+
+	// The http.ResponseWriter target into which the events will be written.
+	rw http.ResponseWriter
+	// Guards the writes to rw, which can be concurrent with heartbeats.
+	mu sync.Mutex
+	// Set once the header has been written.
+	opened bool
+	// Used to stop, and wait for, the heartbeat goroutine.
+	stop chan struct{}
+	wg   sync.WaitGroup
+}
+
+// Open prepares the SSEWriter instance using the given http.ResponseWriter
+// as the target into which the events will be written. Open will be invoked
+// by (SSE).WriteInit indirectly through the StreamWriter interface, if, however,
+// the embedding code overrides this method by providing its own implementation
+// then that implementation MUST invoke this method directly.
+func (w *SSEWriter) Open(rw http.ResponseWriter) {
+	w.rw = rw
+}
+
+// Flush stops the heartbeat and flushes the stream. Flush will be invoked by
+// (SSE).WriteBody indirectly through the StreamWriter interface, if, however,
+// the embedding code overrides this method by providing its own implementation
+// then that implementation MUST invoke this method directly.
+func (w *SSEWriter) Flush() error {
+	if w.stop != nil {
+		close(w.stop)
+		w.wg.Wait()
+		w.stop = nil
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if !w.opened {
+		w.open()
+	}
+	w.flush()
+	return nil
+}
+
+var errSSEField = errors.New("httpcrud/httpio: sse event and id must not contain line breaks")
+
+// Send sends an event with the given name, id and data to the client. The event
+// name and the id are optional and are omitted if empty. The data is sent as is
+// if it's a string or a []byte, otherwise it's sent json encoded. This method
+// SHOULD be invoked directly by the user code.
+func (w *SSEWriter) Send(event, id string, data interface{}) error {
+	if strings.ContainsAny(event, "\r\n") || strings.ContainsAny(id, "\r\n\x00") {
+		return errSSEField
+	}
+
+	var text string
+	switch v := data.(type) {
+	case string:
+		text = v
+	case []byte:
+		text = string(v)
+	default:
+		b, err := json.Marshal(v)
+		if err != nil {
+			return err
+		}
+		text = string(b)
+	}
+
+	var b strings.Builder
+	if len(event) > 0 {
+		b.WriteString("event: " + event + "\n")
+	}
+	if len(id) > 0 {
+		b.WriteString("id: " + id + "\n")
+	}
+	text = strings.NewReplacer("\r\n", "\n", "\r", "\n").Replace(text)
+	for _, line := range strings.Split(text, "\n") {
+		b.WriteString("data: " + line + "\n")
+	}
+	b.WriteString("\n")
+	return w.write(b.String())
+}
+
+// Comment sends a comment to the client, comments are ignored
+// by clients but can be used to keep the connection alive.
+func (w *SSEWriter) Comment(text string) error {
+	var b strings.Builder
+	for _, line := range strings.Split(strings.NewReplacer("\r\n", "\n", "\r", "\n").Replace(text), "\n") {
+		b.WriteString(": " + line + "\n")
+	}
+	b.WriteString("\n")
+	return w.write(b.String())
+}
+
+// write writes s to the stream, opening the stream if necessary, and flushes it.
+func (w *SSEWriter) write(s string) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.Context != nil {
+		if err := w.Context.Err(); err != nil {
+			return err
+		}
+	}
+
+	if !w.opened {
+		w.open()
+		w.startHeartbeat()
+	}
+	if _, err := w.rw.Write([]byte(s)); err != nil {
+		return err
+	}
+	w.flush()
+	return nil
+}
+
+// open sets the event stream specific http headers, and writes
+// the header and the retry hint. Must be invoked with mu held.
+func (w *SSEWriter) open() {
+	h := w.rw.Header()
+	h.Set("Content-Type", contentTypeEventStream)
+	h.Set("Cache-Control", "no-cache")
+	h.Set("X-Accel-Buffering", "no")
+	w.rw.WriteHeader(http.StatusOK)
+	w.opened = true
+
+	if w.Retry > 0 {
+		w.rw.Write([]byte("retry: " + strconv.FormatInt(int64(w.Retry/time.Millisecond), 10) + "\n\n"))
+	}
+}
+
+// startHeartbeat starts the heartbeat goroutine if the Heartbeat and
+// the Context are set. It must not be invoked by Flush since nothing
+// would stop the heartbeat after that.
+func (w *SSEWriter) startHeartbeat() {
+	if w.Heartbeat > 0 && w.Context != nil {
+		w.stop = make(chan struct{})
+		w.wg.Add(1)
+		go w.heartbeat(w.stop)
+	}
+}
+
+// heartbeat sends a comment every Heartbeat interval until stop is closed
+// or the Context is done.
+func (w *SSEWriter) heartbeat(stop chan struct{}) {
+	defer w.wg.Done()
+
+	t := time.NewTicker(w.Heartbeat)
+	defer t.Stop()
+	for {
+		select {
+		case <-t.C:
+			if err := w.Comment("heartbeat"); err != nil {
+				return
+			}
+		case <-stop:
+			return
+		case <-w.Context.Done():
+			return
+		}
+	}
+}
+
+// flush flushes the http.ResponseWriter if it implements the http.Flusher interface.
+func (w *SSEWriter) flush() {
+	if f, ok := w.rw.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// LastEventID implements the HeaderReader interface by
+// reading the value of the Last-Event-ID header.
+type LastEventID struct {
+	// The pointer to which to set the header's value.
+	Val *string
+}
+
+// ReadHeader implements the HeaderReader interface.
+func (l LastEventID) ReadHeader(header http.Header) error {
+	*l.Val = header.Get("Last-Event-ID")
+	return nil
+}
@@ -0,0 +1,122 @@
+package httpio
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/frk/compare"
+)
+
+func TestSSEWriter(t *testing.T) {
+	w := httptest.NewRecorder()
+	stream := &SSEWriter{Retry: 3 * time.Second}
+	body := SSE{stream}
+	if err := body.WriteInit(w); err != nil {
+		t.Fatal(err)
+	}
+	if w.Flushed || w.Body.Len() > 0 {
+		t.Fatal("stream opened before first event")
+	}
+
+	if err := stream.Send("progress", "1", map[string]int{"done": 50}); err != nil {
+		t.Fatal(err)
+	}
+	if !w.Flushed {
+		t.Error("event not flushed")
+	}
+	if err := stream.Send("", "", "line 1\nline 2"); err != nil {
+		t.Fatal(err)
+	}
+	if err := stream.Comment("hi"); err != nil {
+		t.Fatal(err)
+	}
+	if err := body.WriteBody(w, nil, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	want := "retry: 3000\n\n" +
+		"event: progress\nid: 1\ndata: {\"done\":50}\n\n" +
+		"data: line 1\ndata: line 2\n\n" +
+		": hi\n\n"
+	if e := compare.Compare(w.Body.String(), want); e != nil {
+		t.Error(e)
+	}
+	if e := compare.Compare(w.Header().Get("Content-Type"), contentTypeEventStream); e != nil {
+		t.Error(e)
+	}
+	if e := compare.Compare(w.Header().Get("Cache-Control"), "no-cache"); e != nil {
+		t.Error(e)
+	}
+}
+
+func TestSSEWriter_InvalidField(t *testing.T) {
+	stream := &SSEWriter{}
+	stream.Open(httptest.NewRecorder())
+	if err := stream.Send("a\nb", "", "x"); err != errSSEField {
+		t.Errorf("got %v, want %v", err, errSSEField)
+	}
+	if err := stream.Send("", "1\r", "x"); err != errSSEField {
+		t.Errorf("got %v, want %v", err, errSSEField)
+	}
+}
+
+func TestSSEWriter_Context(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	w := httptest.NewRecorder()
+	stream := &SSEWriter{Context: ctx, Heartbeat: time.Millisecond}
+	stream.Open(w)
+
+	if err := stream.Send("", "", "x"); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(20 * time.Millisecond)
+	cancel()
+
+	if err := stream.Send("", "", "y"); err != context.Canceled {
+		t.Errorf("got %v, want %v", err, context.Canceled)
+	}
+	if err := stream.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(w.Body.String(), ": heartbeat\n\n") {
+		t.Errorf("no heartbeat in %q", w.Body.String())
+	}
+	if strings.Contains(w.Body.String(), "data: y") {
+		t.Error("event sent after context was cancelled")
+	}
+}
+
+func TestSSEWriter_NoEvents(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	w := httptest.NewRecorder()
+	stream := &SSEWriter{Context: ctx, Heartbeat: time.Millisecond}
+	stream.Open(w)
+	if err := stream.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(20 * time.Millisecond)
+
+	if e := compare.Compare(w.Header().Get("Content-Type"), contentTypeEventStream); e != nil {
+		t.Error(e)
+	}
+	if e := compare.Compare(w.Body.String(), ""); e != nil {
+		t.Error(e)
+	}
+}
+
+func TestLastEventID(t *testing.T) {
+	var id string
+	h := http.Header{"Last-Event-Id": {"42"}}
+	if err := (LastEventID{&id}).ReadHeader(h); err != nil {
+		t.Fatal(err)
+	}
+	if e := compare.Compare(id, "42"); e != nil {
+		t.Error(e)
+	}
+}
@@ -47,6 +47,16 @@ func (list HeaderReaderList) ReadHeader(header http.Header) error {
 	return nil
 }
 
+// HeaderWriterList can be used to write the HTTP headers of different types.
+type HeaderWriterList []HeaderWriter
+
+// WriteHeader implements the HeaderWriter interface.
+func (list HeaderWriterList) WriteHeader(header http.Header) {
+	for _, hw := range list {
+		hw.WriteHeader(header)
+	}
+}
+
 // Bool is a map that can be used to read the values, using the map's keys,
 // from an incoming request's header, path or query parameters and indirectly
 // set them to the bools pointed to by the map's values.
@@ -0,0 +1,423 @@
+package websocket
+
+import (
+	"bufio"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// MessageType represents the type of a data message.
+type MessageType int
+
+const (
+	TextMessage   MessageType = 1
+	BinaryMessage MessageType = 2
+)
+
+// The close codes defined by RFC 6455, section 7.4.1.
+const (
+	CloseNormalClosure           = 1000
+	CloseGoingAway               = 1001
+	CloseProtocolError           = 1002
+	CloseUnsupportedData         = 1003
+	CloseNoStatusReceived        = 1005
+	CloseAbnormalClosure         = 1006
+	CloseInvalidFramePayloadData = 1007
+	ClosePolicyViolation         = 1008
+	CloseMessageTooBig           = 1009
+	CloseMandatoryExtension      = 1010
+	CloseInternalServerErr       = 1011
+)
+
+// frame opcodes
+const (
+	opContinuation = 0x0
+	opText         = 0x1
+	opBinary       = 0x2
+	opClose        = 0x8
+	opPing         = 0x9
+	opPong         = 0xa
+)
+
+// The maximum payload length of a control frame.
+const maxControlPayload = 125
+
+// The time allowed to write a close frame when failing the connection.
+const closeWriteTimeout = 5 * time.Second
+
+var (
+	// ErrCloseSent is returned when writing to a
+	// connection after a close frame has been sent.
+	ErrCloseSent = errors.New("httpcrud/httpio/websocket: close frame sent")
+)
+
+// CloseError is returned by ReadMessage when the connection has been closed,
+// either by the peer, or by the Conn itself because the peer violated the
+// protocol or sent a message larger than the limit.
+type CloseError struct {
+	// The close code, one of the Close* constants, or an
+	// application specific code in the range 3000-4999.
+	Code int
+	// The reason for closing, if any.
+	Text string
+}
+
+func (e *CloseError) Error() string {
+	s := "httpcrud/httpio/websocket: close " + strconv.Itoa(e.Code)
+	if len(e.Text) > 0 {
+		s += ": " + e.Text
+	}
+	return s
+}
+
+// Conn represents a WebSocket connection. Conn supports one concurrent
+// reader and multiple concurrent writers.
+type Conn struct {
+	nc net.Conn
+	br *bufio.Reader
+	// set for the server side of the connection; the server
+	// requires incoming frames to be masked and does not mask
+	// outgoing frames, the client does the opposite
+	server bool
+
+	maxSize      int64
+	fragmentSize int
+	subprotocol  string
+
+	// guards writes and the closeSent flag
+	wmu       sync.Mutex
+	closeSent bool
+}
+
+func newConn(nc net.Conn, br *bufio.Reader, server bool) *Conn {
+	if br == nil {
+		br = bufio.NewReader(nc)
+	}
+	return &Conn{nc: nc, br: br, server: server, maxSize: defaultMaxMessageSize}
+}
+
+// Subprotocol returns the negotiated subprotocol, if any.
+func (c *Conn) Subprotocol() string {
+	return c.subprotocol
+}
+
+// RemoteAddr returns the remote network address.
+func (c *Conn) RemoteAddr() net.Addr {
+	return c.nc.RemoteAddr()
+}
+
+// SetReadDeadline sets the deadline for future reads from the underlying
+// connection. A zero value for t means reads will not time out.
+func (c *Conn) SetReadDeadline(t time.Time) error {
+	return c.nc.SetReadDeadline(t)
+}
+
+// SetWriteDeadline sets the deadline for future writes to the underlying
+// connection. A zero value for t means writes will not time out.
+func (c *Conn) SetWriteDeadline(t time.Time) error {
+	return c.nc.SetWriteDeadline(t)
+}
+
+// ReadMessage reads the next data message from the connection, reassembling
+// fragmented messages. Control frames received while reading are handled
+// by ReadMessage itself: pings are answered with pongs, pongs are discarded,
+// and a close frame is answered with a close frame after which the connection
+// is closed and a *CloseError is returned.
+//
+// If the peer violates the protocol, sends a text message that is not valid
+// UTF-8, or a message larger than the limit, the connection is closed with
+// the appropriate close code and a *CloseError with that code is returned.
+func (c *Conn) ReadMessage() (MessageType, []byte, error) {
+	var typ MessageType
+	var msg []byte
+	for {
+		fin, op, payload, err := c.readFrame(c.maxSize - int64(len(msg)))
+		if err != nil {
+			return 0, nil, err
+		}
+
+		switch op {
+		case opPing:
+			if err := c.writeFrame(opPong, payload, true); err != nil && err != ErrCloseSent {
+				return 0, nil, err
+			}
+			continue
+		case opPong:
+			continue
+		case opClose:
+			return 0, nil, c.handleClose(payload)
+		case opText, opBinary:
+			if typ != 0 {
+				return 0, nil, c.fail(CloseProtocolError, "expected continuation frame")
+			}
+			typ, msg = MessageType(op), payload
+		case opContinuation:
+			if typ == 0 {
+				return 0, nil, c.fail(CloseProtocolError, "unexpected continuation frame")
+			}
+			msg = append(msg, payload...)
+		}
+
+		if fin {
+			if typ == TextMessage && !utf8.Valid(msg) {
+				return 0, nil, c.fail(CloseInvalidFramePayloadData, "invalid UTF-8 in text message")
+			}
+			return typ, msg, nil
+		}
+	}
+}
+
+// readFrame reads the next frame from the connection. The limit
+// argument is the maximum allowed payload length of a data frame.
+func (c *Conn) readFrame(limit int64) (fin bool, op byte, payload []byte, err error) {
+	var head [2]byte
+	if _, err := io.ReadFull(c.br, head[:]); err != nil {
+		return false, 0, nil, c.readError(err)
+	}
+	fin, op = head[0]&0x80 != 0, head[0]&0x0f
+	masked := head[1]&0x80 != 0
+
+	if head[0]&0x70 != 0 {
+		return false, 0, nil, c.fail(CloseProtocolError, "reserved bits set")
+	}
+	if masked != c.server {
+		return false, 0, nil, c.fail(CloseProtocolError, "bad frame masking")
+	}
+	isControl := op&0x8 != 0
+	switch op {
+	case opContinuation, opText, opBinary, opClose, opPing, opPong:
+	default:
+		return false, 0, nil, c.fail(CloseProtocolError, "reserved opcode "+strconv.Itoa(int(op)))
+	}
+
+	length := uint64(head[1] & 0x7f)
+	switch length {
+	case 126:
+		var b [2]byte
+		if _, err := io.ReadFull(c.br, b[:]); err != nil {
+			return false, 0, nil, c.readError(err)
+		}
+		length = uint64(binary.BigEndian.Uint16(b[:]))
+	case 127:
+		var b [8]byte
+		if _, err := io.ReadFull(c.br, b[:]); err != nil {
+			return false, 0, nil, c.readError(err)
+		}
+		length = binary.BigEndian.Uint64(b[:])
+	}
+
+	if isControl {
+		if !fin {
+			return false, 0, nil, c.fail(CloseProtocolError, "fragmented control frame")
+		}
+		if length > maxControlPayload {
+			return false, 0, nil, c.fail(CloseProtocolError, "control frame too long")
+		}
+	} else if length > uint64(limit) {
+		return false, 0, nil, c.fail(CloseMessageTooBig, "message too big")
+	}
+
+	var key [4]byte
+	if masked {
+		if _, err := io.ReadFull(c.br, key[:]); err != nil {
+			return false, 0, nil, c.readError(err)
+		}
+	}
+
+	payload = make([]byte, length)
+	if _, err := io.ReadFull(c.br, payload); err != nil {
+		return false, 0, nil, c.readError(err)
+	}
+	if masked {
+		maskBytes(key, payload)
+	}
+	return fin, op, payload, nil
+}
+
+// handleClose answers the close frame with the given payload, closes
+// the connection, and returns the *CloseError describing the closure.
+func (c *Conn) handleClose(payload []byte) error {
+	cerr := &CloseError{Code: CloseNoStatusReceived}
+	switch {
+	case len(payload) == 1:
+		return c.fail(CloseProtocolError, "invalid close payload")
+	case len(payload) >= 2:
+		cerr.Code = int(binary.BigEndian.Uint16(payload))
+		cerr.Text = string(payload[2:])
+		if !validCloseCode(cerr.Code) {
+			return c.fail(CloseProtocolError, "invalid close code")
+		}
+		if !utf8.ValidString(cerr.Text) {
+			return c.fail(CloseInvalidFramePayloadData, "invalid UTF-8 in close reason")
+		}
+	}
+
+	var reply []byte
+	if cerr.Code != CloseNoStatusReceived {
+		reply = closePayload(cerr.Code, "")
+	}
+	c.writeFrame(opClose, reply, true)
+	c.nc.Close()
+	return cerr
+}
+
+// fail closes the connection with the given code and
+// returns the *CloseError describing the closure.
+func (c *Conn) fail(code int, text string) error {
+	c.nc.SetWriteDeadline(time.Now().Add(closeWriteTimeout))
+	c.writeFrame(opClose, closePayload(code, text), true)
+	c.nc.Close()
+	return &CloseError{Code: code, Text: text}
+}
+
+// readError translates an error returned by the underlying connection. An
+// unexpected EOF is reported as a *CloseError with the CloseAbnormalClosure
+// code, other errors are returned as is.
+func (c *Conn) readError(err error) error {
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		c.nc.Close()
+		return &CloseError{Code: CloseAbnormalClosure}
+	}
+	return err
+}
+
+// WriteMessage writes a data message of the given type to the connection.
+// If the connection's fragment size is set and the message is larger than
+// it, the message is sent in multiple frames.
+func (c *Conn) WriteMessage(typ MessageType, data []byte) error {
+	if typ != TextMessage && typ != BinaryMessage {
+		return errors.New("httpcrud/httpio/websocket: invalid message type " + strconv.Itoa(int(typ)))
+	}
+
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+
+	op := byte(typ)
+	for c.fragmentSize > 0 && len(data) > c.fragmentSize {
+		if err := c.writeFrameLocked(op, data[:c.fragmentSize], false); err != nil {
+			return err
+		}
+		op, data = opContinuation, data[c.fragmentSize:]
+	}
+	return c.writeFrameLocked(op, data, true)
+}
+
+// Ping writes a ping frame with the given application data to the connection.
+func (c *Conn) Ping(data []byte) error {
+	if len(data) > maxControlPayload {
+		return errors.New("httpcrud/httpio/websocket: ping data too long")
+	}
+	return c.writeFrame(opPing, data, true)
+}
+
+// Close sends a close frame with the given code and reason, unless one
+// has already been sent, and closes the underlying connection.
+func (c *Conn) Close(code int, text string) error {
+	err := c.writeFrame(opClose, closePayload(code, text), true)
+	if err == ErrCloseSent {
+		c.nc.Close()
+		return nil
+	}
+	if cerr := c.nc.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+func (c *Conn) writeFrame(op byte, payload []byte, fin bool) error {
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+	return c.writeFrameLocked(op, payload, fin)
+}
+
+// writeFrameLocked writes a single frame to the connection.
+// The caller must hold the write lock.
+func (c *Conn) writeFrameLocked(op byte, payload []byte, fin bool) error {
+	if c.closeSent {
+		return ErrCloseSent
+	}
+	if op == opClose {
+		c.closeSent = true
+	}
+
+	buf := make([]byte, 0, 14+len(payload))
+	b0 := op
+	if fin {
+		b0 |= 0x80
+	}
+	buf = append(buf, b0)
+
+	var mask byte
+	if !c.server {
+		mask = 0x80
+	}
+	switch n := len(payload); {
+	case n <= 125:
+		buf = append(buf, mask|byte(n))
+	case n <= 0xffff:
+		buf = append(buf, mask|126, byte(n>>8), byte(n))
+	default:
+		buf = append(buf, mask|127)
+		buf = append(buf, make([]byte, 8)...)
+		binary.BigEndian.PutUint64(buf[len(buf)-8:], uint64(n))
+	}
+
+	if !c.server {
+		var key [4]byte
+		if _, err := rand.Read(key[:]); err != nil {
+			return err
+		}
+		buf = append(buf, key[:]...)
+		start := len(buf)
+		buf = append(buf, payload...)
+		maskBytes(key, buf[start:])
+	} else {
+		buf = append(buf, payload...)
+	}
+
+	_, err := c.nc.Write(buf)
+	return err
+}
+
+// closePayload returns the payload of a close frame with the given code and
+// reason. The reason is truncated, on a rune boundary, to fit into the control
+// frame's payload.
+func closePayload(code int, text string) []byte {
+	if code == CloseNoStatusReceived {
+		return nil
+	}
+	if n := maxControlPayload - 2; len(text) > n {
+		for n > 0 && !utf8.RuneStart(text[n]) {
+			n--
+		}
+		text = text[:n]
+	}
+	p := make([]byte, 2, 2+len(text))
+	binary.BigEndian.PutUint16(p, uint16(code))
+	return append(p, text...)
+}
+
+// validCloseCode reports whether the code may be sent in a close frame.
+func validCloseCode(code int) bool {
+	switch code {
+	case CloseNormalClosure, CloseGoingAway, CloseProtocolError, CloseUnsupportedData,
+		CloseInvalidFramePayloadData, ClosePolicyViolation, CloseMessageTooBig,
+		CloseMandatoryExtension, CloseInternalServerErr:
+		return true
+	}
+	return code >= 3000 && code <= 4999
+}
+
+// maskBytes applies the masking key to b, as defined by RFC 6455, section 5.3.
+func maskBytes(key [4]byte, b []byte) {
+	for i := range b {
+		b[i] ^= key[i&3]
+	}
+}
@@ -0,0 +1,240 @@
+// Package websocket implements the server side of the WebSocket protocol,
+// as specified by RFC 6455, in a way that fits into the httpcrud Handler
+// lifecycle.
+//
+// The Upgrader type is used both as the RequestReader's BodyReader, to
+// validate the opening handshake after the request has been authorized,
+// and as the ResponseWriter's BodyWriter, to complete the handshake in
+// InitResponse. The handler's Action can then exchange messages with
+// the client using the Upgrader's Conn.
+//
+//	type ChatHandler struct {
+//		httpcrud.NopHandler
+//		httpio.RequestReader
+//		httpio.ResponseWriter
+//		ws websocket.Upgrader
+//	}
+//
+//	func (h *ChatHandler) Init() {
+//		h.RequestReader.Body = &h.ws
+//		h.ResponseWriter.Body = &h.ws
+//	}
+//
+//	func (h *ChatHandler) Execute() error {
+//		for {
+//			typ, msg, err := h.ws.Conn.ReadMessage()
+//			if _, ok := err.(*websocket.CloseError); ok {
+//				return nil
+//			} else if err != nil {
+//				return err
+//			}
+//			if err := h.ws.Conn.WriteMessage(typ, msg); err != nil {
+//				return err
+//			}
+//		}
+//	}
+package websocket
+
+import (
+	"crypto/sha1"
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// The default limit of the size of a single message.
+const defaultMaxMessageSize = 1 << 20
+
+// Upgrader implements both the httpio.BodyReader and httpio.BodyWriter
+// interfaces to upgrade an HTTP connection to the WebSocket protocol.
+// Since the Upgrader retains state between the reading of the request
+// and the writing of the response it must be used through a pointer.
+type Upgrader struct {
+	// The list of the subprotocols supported by the server in
+	// the order of preference. If not set, no subprotocol is negotiated.
+	Subprotocols []string
+	// The limit of the size of a single message in bytes, a message that
+	// exceeds the limit causes the connection to be closed with the
+	// CloseMessageTooBig code. If not set, 1MB will be used.
+	MaxMessageSize int64
+	// If set, outgoing messages larger than FragmentSize bytes
+	// are sent in fragments of at most FragmentSize bytes.
+	FragmentSize int
+	// If set, will be used to check the request's Origin header. If not set,
+	// requests with an Origin header whose host does not match the request's
+	// Host are rejected.
+	CheckOrigin func(r *http.Request) bool
+
+	// The connection, set by WriteInit once the handshake is complete.
+	Conn *Conn
+
+	// the request's key and the negotiated subprotocol, set by ReadBody
+	key, protocol string
+}
+
+// ReadBody implements the httpio.BodyReader interface by validating the
+// request's opening handshake. If the request is not a valid WebSocket
+// handshake a HandshakeError will be returned.
+func (u *Upgrader) ReadBody(r *http.Request) error {
+	if r.Method != http.MethodGet {
+		return HandshakeError{Reason: "method must be GET", Status: http.StatusMethodNotAllowed}
+	}
+	if !headerContainsToken(r.Header, "Connection", "upgrade") {
+		return HandshakeError{Reason: "missing 'upgrade' token in Connection header", Status: http.StatusBadRequest}
+	}
+	if !headerContainsToken(r.Header, "Upgrade", "websocket") {
+		return HandshakeError{Reason: "missing 'websocket' token in Upgrade header", Status: http.StatusBadRequest}
+	}
+	if r.Header.Get("Sec-WebSocket-Version") != "13" {
+		return HandshakeError{Reason: "unsupported version", Status: http.StatusUpgradeRequired}
+	}
+
+	key := r.Header.Get("Sec-WebSocket-Key")
+	if b, err := base64.StdEncoding.DecodeString(key); err != nil || len(b) != 16 {
+		return HandshakeError{Reason: "invalid Sec-WebSocket-Key header", Status: http.StatusBadRequest}
+	}
+
+	check := u.CheckOrigin
+	if check == nil {
+		check = sameOrigin
+	}
+	if !check(r) {
+		return HandshakeError{Reason: "origin not allowed", Status: http.StatusForbidden}
+	}
+
+	u.key, u.protocol = key, ""
+	for _, p := range u.Subprotocols {
+		if headerContainsToken(r.Header, "Sec-WebSocket-Protocol", p) {
+			u.protocol = p
+			break
+		}
+	}
+	return nil
+}
+
+// WriteInit implements the httpio.BodyWriter interface by hijacking the
+// connection and completing the opening handshake. WriteInit must be
+// preceded by a successful invocation of ReadBody.
+func (u *Upgrader) WriteInit(w http.ResponseWriter) error {
+	if len(u.key) == 0 {
+		return errors.New("httpcrud/httpio/websocket: handshake was not read")
+	}
+	hj, ok := w.(http.Hijacker)
+	if !ok {
+		return errors.New("httpcrud/httpio/websocket: response does not support hijacking")
+	}
+	nc, brw, err := hj.Hijack()
+	if err != nil {
+		return err
+	}
+	// The server's read and write timeouts, if any, remain
+	// in force after the connection has been hijacked.
+	if err := nc.SetDeadline(time.Time{}); err != nil {
+		nc.Close()
+		return err
+	}
+
+	resp := "HTTP/1.1 101 Switching Protocols\r\n" +
+		"Upgrade: websocket\r\n" +
+		"Connection: Upgrade\r\n" +
+		"Sec-WebSocket-Accept: " + acceptKey(u.key) + "\r\n"
+	if len(u.protocol) > 0 {
+		resp += "Sec-WebSocket-Protocol: " + u.protocol + "\r\n"
+	}
+	resp += "\r\n"
+	if _, err := brw.WriteString(resp); err != nil {
+		nc.Close()
+		return err
+	}
+	if err := brw.Flush(); err != nil {
+		nc.Close()
+		return err
+	}
+
+	maxSize := u.MaxMessageSize
+	if maxSize <= 0 {
+		maxSize = defaultMaxMessageSize
+	}
+	u.Conn = newConn(nc, brw.Reader, true)
+	u.Conn.maxSize = maxSize
+	u.Conn.fragmentSize = u.FragmentSize
+	u.Conn.subprotocol = u.protocol
+	return nil
+}
+
+// WriteBody implements the httpio.BodyWriter interface by closing the
+// connection with the CloseNormalClosure code, unless already closed.
+//
+// Note that WriteBody is not invoked if the handler fails before writing
+// the response, in which case the connection should be closed by the
+// handler, e.g. in the Action's Done method.
+func (u *Upgrader) WriteBody(_ http.ResponseWriter, _ *http.Request, _ int) error {
+	if u.Conn != nil {
+		return u.Conn.Close(CloseNormalClosure, "")
+	}
+	return nil
+}
+
+// acceptKey returns the value of the Sec-WebSocket-Accept header for the given key.
+func acceptKey(key string) string {
+	h := sha1.New()
+	h.Write([]byte(key + "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"))
+	return base64.StdEncoding.EncodeToString(h.Sum(nil))
+}
+
+// sameOrigin reports whether the request has no Origin header or
+// whether the Origin's host matches the request's Host.
+func sameOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if len(origin) == 0 {
+		return true
+	}
+	u, err := url.Parse(origin)
+	if err != nil {
+		return false
+	}
+	return strings.EqualFold(u.Host, r.Host)
+}
+
+// headerContainsToken reports whether the comma separated
+// values of the named header contain the given token.
+func headerContainsToken(h http.Header, name, token string) bool {
+	for _, v := range h[http.CanonicalHeaderKey(name)] {
+		for _, t := range strings.Split(v, ",") {
+			if strings.EqualFold(strings.TrimSpace(t), token) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// HandshakeError is returned by the Upgrader when the
+// request is not a valid WebSocket opening handshake.
+type HandshakeError struct {
+	// The description of the problem.
+	Reason string
+	// The HTTP status code to respond with.
+	Status int
+}
+
+func (e HandshakeError) Error() string {
+	return "httpcrud/httpio/websocket: bad handshake: " + e.Reason
+}
+
+// StatusCode returns the HTTP status code to respond with.
+func (e HandshakeError) StatusCode() int {
+	return e.Status
+}
+
+// WriteHeader implements the httpio.HeaderWriter interface. If the status is
+// 426 (Upgrade Required) it sets the Sec-WebSocket-Version header to the
+// version supported by the server, as required by RFC 6455.
+func (e HandshakeError) WriteHeader(header http.Header) {
+	if e.Status == http.StatusUpgradeRequired {
+		header.Set("Sec-WebSocket-Version", "13")
+	}
+}
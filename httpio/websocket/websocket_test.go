@@ -0,0 +1,377 @@
+package websocket
+
+import (
+	"bufio"
+	"bytes"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/frk/compare"
+)
+
+func TestUpgrader_ReadBody(t *testing.T) {
+	tests := []struct {
+		method string
+		header map[string]string
+		up     Upgrader
+		err    error
+		proto  string
+	}{{
+		method: "GET",
+		header: map[string]string{},
+	}, {
+		method: "POST",
+		header: map[string]string{},
+		err:    HandshakeError{Reason: "method must be GET", Status: 405},
+	}, {
+		method: "GET",
+		header: map[string]string{"Connection": "keep-alive"},
+		err:    HandshakeError{Reason: "missing 'upgrade' token in Connection header", Status: 400},
+	}, {
+		method: "GET",
+		header: map[string]string{"Upgrade": "h2c"},
+		err:    HandshakeError{Reason: "missing 'websocket' token in Upgrade header", Status: 400},
+	}, {
+		method: "GET",
+		header: map[string]string{"Sec-WebSocket-Version": "8"},
+		err:    HandshakeError{Reason: "unsupported version", Status: 426},
+	}, {
+		method: "GET",
+		header: map[string]string{"Sec-WebSocket-Key": "c2hvcnQ="},
+		err:    HandshakeError{Reason: "invalid Sec-WebSocket-Key header", Status: 400},
+	}, {
+		method: "GET",
+		header: map[string]string{"Origin": "http://example.com"},
+	}, {
+		method: "GET",
+		header: map[string]string{"Origin": "http://evil.com"},
+		err:    HandshakeError{Reason: "origin not allowed", Status: 403},
+	}, {
+		method: "GET",
+		header: map[string]string{"Origin": "http://evil.com"},
+		up:     Upgrader{CheckOrigin: func(*http.Request) bool { return true }},
+	}, {
+		method: "GET",
+		header: map[string]string{"Sec-WebSocket-Protocol": "v1.chat, v2.chat"},
+		up:     Upgrader{Subprotocols: []string{"v2.chat", "v1.chat"}},
+		proto:  "v2.chat",
+	}, {
+		method: "GET",
+		header: map[string]string{"Sec-WebSocket-Protocol": "v3.chat"},
+		up:     Upgrader{Subprotocols: []string{"v2.chat", "v1.chat"}},
+	}}
+
+	for _, tt := range tests {
+		r := httptest.NewRequest(tt.method, "http://example.com/ws", nil)
+		r.Header.Set("Connection", "keep-alive, Upgrade")
+		r.Header.Set("Upgrade", "websocket")
+		r.Header.Set("Sec-WebSocket-Version", "13")
+		r.Header.Set("Sec-WebSocket-Key", "dGhlIHNhbXBsZSBub25jZQ==")
+		for k, v := range tt.header {
+			r.Header.Set(k, v)
+		}
+
+		err := tt.up.ReadBody(r)
+		if e := compare.Compare(err, tt.err); e != nil {
+			t.Error(e)
+		}
+		if e := compare.Compare(tt.up.protocol, tt.proto); e != nil {
+			t.Error(e)
+		}
+	}
+}
+
+func TestAcceptKey(t *testing.T) {
+	// the example from RFC 6455, section 1.3
+	got := acceptKey("dGhlIHNhbXBsZSBub25jZQ==")
+	if e := compare.Compare(got, "s3pPLMBiTxaQ9kYGzzhZRbK+xOo="); e != nil {
+		t.Error(e)
+	}
+}
+
+func TestUpgrader_WriteInit_NoHijacker(t *testing.T) {
+	up := Upgrader{key: "dGhlIHNhbXBsZSBub25jZQ=="}
+	if err := up.WriteInit(httptest.NewRecorder()); err == nil {
+		t.Error("got nil error, want hijack error")
+	}
+}
+
+func TestHandshakeError_WriteHeader(t *testing.T) {
+	h := http.Header{}
+	HandshakeError{Reason: "unsupported version", Status: http.StatusUpgradeRequired}.WriteHeader(h)
+	if e := compare.Compare(h, http.Header{"Sec-Websocket-Version": {"13"}}); e != nil {
+		t.Error(e)
+	}
+
+	h = http.Header{}
+	HandshakeError{Reason: "origin not allowed", Status: http.StatusForbidden}.WriteHeader(h)
+	if e := compare.Compare(h, http.Header{}); e != nil {
+		t.Error(e)
+	}
+}
+
+func TestUpgrader_WriteInit_Deadline(t *testing.T) {
+	srv := httptest.NewUnstartedServer(testHandler(t, Upgrader{}, func(c *Conn) {
+		time.Sleep(100 * time.Millisecond)
+		echo(c)
+	}))
+	srv.Config.ReadTimeout = 20 * time.Millisecond
+	srv.Config.WriteTimeout = 20 * time.Millisecond
+	srv.Start()
+	defer srv.Close()
+
+	c, _ := dial(t, srv, "")
+	defer c.nc.Close()
+	if err := c.WriteMessage(TextMessage, []byte("hello")); err != nil {
+		t.Fatal(err)
+	}
+	_, msg, err := c.ReadMessage()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e := compare.Compare(string(msg), "hello"); e != nil {
+		t.Error(e)
+	}
+}
+
+// testServer starts a server whose handler upgrades the connection with the
+// given Upgrader, through the same methods the Handler lifecycle invokes,
+// and passes the connection to fn.
+func testServer(t *testing.T, up Upgrader, fn func(c *Conn)) *httptest.Server {
+	return httptest.NewServer(testHandler(t, up, fn))
+}
+
+// testHandler returns the handler used by testServer.
+func testHandler(t *testing.T, up Upgrader, fn func(c *Conn)) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		u := up
+		if err := u.ReadBody(r); err != nil {
+			http.Error(w, err.Error(), err.(HandshakeError).Status)
+			return
+		}
+		if err := u.WriteInit(w); err != nil {
+			t.Error(err)
+			return
+		}
+		fn(u.Conn)
+		u.WriteBody(w, r, 0)
+	})
+}
+
+// dial performs the opening handshake against the server
+// and returns the client side of the connection.
+func dial(t *testing.T, srv *httptest.Server, protocol string) (*Conn, *http.Response) {
+	nc, err := net.Dial("tcp", srv.Listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	req := "GET / HTTP/1.1\r\n" +
+		"Host: " + srv.Listener.Addr().String() + "\r\n" +
+		"Upgrade: websocket\r\n" +
+		"Connection: Upgrade\r\n" +
+		"Sec-WebSocket-Key: dGhlIHNhbXBsZSBub25jZQ==\r\n" +
+		"Sec-WebSocket-Version: 13\r\n"
+	if len(protocol) > 0 {
+		req += "Sec-WebSocket-Protocol: " + protocol + "\r\n"
+	}
+	if _, err := nc.Write([]byte(req + "\r\n")); err != nil {
+		t.Fatal(err)
+	}
+
+	br := bufio.NewReader(nc)
+	resp, err := http.ReadResponse(br, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return newConn(nc, br, false), resp
+}
+
+func echo(c *Conn) {
+	for {
+		typ, msg, err := c.ReadMessage()
+		if err != nil {
+			return
+		}
+		if err := c.WriteMessage(typ, msg); err != nil {
+			return
+		}
+	}
+}
+
+func TestConn_Echo(t *testing.T) {
+	srv := testServer(t, Upgrader{Subprotocols: []string{"chat"}}, echo)
+	defer srv.Close()
+
+	c, resp := dial(t, srv, "chat")
+	if e := compare.Compare(resp.StatusCode, 101); e != nil {
+		t.Fatal(e)
+	}
+	if e := compare.Compare(resp.Header.Get("Sec-WebSocket-Accept"), "s3pPLMBiTxaQ9kYGzzhZRbK+xOo="); e != nil {
+		t.Error(e)
+	}
+	if e := compare.Compare(resp.Header.Get("Sec-WebSocket-Protocol"), "chat"); e != nil {
+		t.Error(e)
+	}
+
+	messages := []struct {
+		typ  MessageType
+		data []byte
+	}{
+		{TextMessage, []byte("hello")},
+		{BinaryMessage, []byte{0, 1, 2, 255}},
+		{TextMessage, []byte{}},
+		{BinaryMessage, bytes.Repeat([]byte("x"), 70000)},
+	}
+	for _, m := range messages {
+		if err := c.WriteMessage(m.typ, m.data); err != nil {
+			t.Fatal(err)
+		}
+		typ, data, err := c.ReadMessage()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if e := compare.Compare(typ, m.typ); e != nil {
+			t.Error(e)
+		}
+		if !bytes.Equal(data, m.data) {
+			t.Errorf("got %d bytes, want %d bytes", len(data), len(m.data))
+		}
+	}
+
+	if err := c.Close(CloseGoingAway, "bye"); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestConn_Fragmentation(t *testing.T) {
+	srv := testServer(t, Upgrader{FragmentSize: 4}, echo)
+	defer srv.Close()
+	c, _ := dial(t, srv, "")
+	defer c.Close(CloseNormalClosure, "")
+
+	// a fragmented message with a ping interleaved
+	c.writeFrame(opText, []byte("hel"), false)
+	c.writeFrame(opPing, []byte("p"), true)
+	c.writeFrame(opContinuation, []byte("lo, "), false)
+	c.writeFrame(opContinuation, []byte("world"), true)
+
+	// the pong is sent before the echo
+	fin, op, payload, err := c.readFrame(c.maxSize)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e := compare.Compare([]interface{}{fin, op, string(payload)}, []interface{}{true, byte(opPong), "p"}); e != nil {
+		t.Error(e)
+	}
+
+	// the echo is fragmented by the server
+	var frames []string
+	for {
+		fin, _, payload, err := c.readFrame(c.maxSize)
+		if err != nil {
+			t.Fatal(err)
+		}
+		frames = append(frames, string(payload))
+		if fin {
+			break
+		}
+	}
+	if e := compare.Compare(frames, []string{"hell", "o, w", "orld"}); e != nil {
+		t.Error(e)
+	}
+}
+
+func TestConn_Close(t *testing.T) {
+	tests := []struct {
+		name   string
+		up     Upgrader
+		frames func(c *Conn)
+		want   *CloseError
+	}{{
+		name: "message too big",
+		up:   Upgrader{MaxMessageSize: 8},
+		frames: func(c *Conn) {
+			c.writeFrame(opBinary, []byte("12345"), false)
+			c.writeFrame(opContinuation, []byte("67890"), true)
+		},
+		want: &CloseError{Code: CloseMessageTooBig, Text: "message too big"},
+	}, {
+		name: "invalid utf-8",
+		frames: func(c *Conn) {
+			c.writeFrame(opText, []byte{0xff, 0xfe}, true)
+		},
+		want: &CloseError{Code: CloseInvalidFramePayloadData, Text: "invalid UTF-8 in text message"},
+	}, {
+		name: "unexpected continuation",
+		frames: func(c *Conn) {
+			c.writeFrame(opContinuation, []byte("x"), true)
+		},
+		want: &CloseError{Code: CloseProtocolError, Text: "unexpected continuation frame"},
+	}, {
+		name: "fragmented control frame",
+		frames: func(c *Conn) {
+			c.writeFrame(opPing, []byte("x"), false)
+		},
+		want: &CloseError{Code: CloseProtocolError, Text: "fragmented control frame"},
+	}, {
+		name: "unmasked frame",
+		frames: func(c *Conn) {
+			c.server = true
+			c.writeFrame(opText, []byte("x"), true)
+			c.server = false
+		},
+		want: &CloseError{Code: CloseProtocolError, Text: "bad frame masking"},
+	}, {
+		name: "peer close",
+		frames: func(c *Conn) {
+			c.writeFrame(opClose, closePayload(CloseGoingAway, "bye"), true)
+		},
+		want: &CloseError{Code: CloseGoingAway},
+	}}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srverr := make(chan error, 1)
+			srv := testServer(t, tt.up, func(c *Conn) {
+				_, _, err := c.ReadMessage()
+				srverr <- err
+			})
+			defer srv.Close()
+
+			c, _ := dial(t, srv, "")
+			tt.frames(c)
+
+			// the server's close frame
+			_, _, err := c.ReadMessage()
+			if e := compare.Compare(err, tt.want); e != nil {
+				t.Error(e)
+			}
+
+			err = <-srverr
+			if cerr, ok := err.(*CloseError); !ok {
+				t.Errorf("got %v, want *CloseError", err)
+			} else if cerr.Code != tt.want.Code {
+				t.Errorf("got code %d, want %d", cerr.Code, tt.want.Code)
+			}
+		})
+	}
+}
+
+func TestClosePayload(t *testing.T) {
+	p := closePayload(CloseNormalClosure, strings.Repeat("x", 200))
+	if e := compare.Compare(len(p), maxControlPayload); e != nil {
+		t.Error(e)
+	}
+	// 61 two-byte runes, the 62nd would not fit in the 123 bytes
+	p = closePayload(CloseNormalClosure, strings.Repeat("é", 100))
+	if e := compare.Compare(string(p[2:]), strings.Repeat("é", 61)); e != nil {
+		t.Error(e)
+	}
+	if e := compare.Compare(closePayload(CloseNoStatusReceived, "x"), []byte(nil)); e != nil {
+		t.Error(e)
+	}
+}
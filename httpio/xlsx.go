@@ -0,0 +1,453 @@
+package httpio
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// The XLSX type implements the BodyWriter interface by using a StreamWriter.
+type XLSX struct {
+	Stream StreamWriter
+}
+
+// WriteInit opens the underlying StreamWriter.
+func (x XLSX) WriteInit(w http.ResponseWriter) error {
+	x.Stream.Open(w)
+	return nil
+}
+
+// WriteBody flushes the underlying StreamWriter.
+func (x XLSX) WriteBody(_ http.ResponseWriter, _ *http.Request, _ int) error {
+	if err := x.Stream.Flush(); err != nil {
+		return WriteError{err}
+	}
+	return nil
+}
+
+const contentTypeXLSX = "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"
+
+// The default name of the first sheet.
+const defaultXLSXSheetName = "Sheet1"
+
+// The indexes of the cell styles defined by xlsxStyles.
+const (
+	xlsxStyleDefault  = 0
+	xlsxStyleHeader   = 1
+	xlsxStyleDate     = 2
+	xlsxStyleDateTime = 3
+)
+
+// XLSXWriter implements the StreamWriter interface and is intended to be
+// embedded by user-defined structs that want to implement custom xlsx writers.
+//
+// The XLSXWriter generates a minimal Office Open XML workbook. The rows are
+// streamed to the response as they are written, only the names of the sheets
+// are kept in memory, the workbook's remaining parts are written by Flush.
+//
+// The values of a row are written as typed cells: numbers as numeric cells,
+// time.Time values as numeric cells formatted as dates, booleans as boolean
+// cells, nil values as empty cells, and everything else as string cells.
+type XLSXWriter struct {
+	// The list of the column names of the first sheet, written
+	// as a row of bold cells. SHOULD be set prior to the first
+	// call to WriteRow.
+	Header []string
+	// The widths of the columns of the first sheet, in characters.
+	// A zero width leaves the column's width unset. SHOULD be
+	// set prior to the first call to WriteRow.
+	Widths []float64
+	// The name of the first sheet. If not set, "Sheet1" will be used.
+	// SHOULD be set prior to the first call to WriteRow.
+	SheetName string
+	// The file name to be used for the Content-Disposition header.
+	// SHOULD be set prior to the first call to WriteRow.
+	FileName string
+	// The HTTP status code to be sent with the response.
+	// SHOULD be set prior to the first call to WriteRow.
+	// If not set, 200 (Status OK) will be used.
+	StatusCode int
+
+	// The http.ResponseWriter target into which the workbook will be written.
+	rw http.ResponseWriter
+	// The zip.Writer used to write the workbook's parts.
+	zw *zip.Writer
+	// The current sheet's zip entry, nil if no sheet was started.
+	sheet io.Writer
+	// The names of the sheets started so far.
+	sheets []string
+	// The number of rows written to the current sheet.
+	rows int
+	// The buffer used to encode a single row.
+	buf bytes.Buffer
+}
+
+// Open prepares the XLSXWriter instance using the given http.ResponseWriter
+// as the target into which the workbook will be written. Open will be invoked
+// by (XLSX).WriteInit indirectly through the StreamWriter interface, if,
+// however, the embedding code overrides this method by providing its own
+// implementation then that implementation MUST invoke this method directly.
+func (w *XLSXWriter) Open(rw http.ResponseWriter) {
+	w.rw = rw
+	w.zw = nil
+	w.sheet = nil
+	w.sheets = nil
+	w.rows = 0
+}
+
+// Flush finishes the current sheet, writes the remaining parts of the workbook
+// and closes it. If no rows were written, Flush writes a workbook with a single
+// sheet containing just the header. Flush will be invoked by (XLSX).WriteBody
+// indirectly through the StreamWriter interface, if, however, the embedding
+// code overrides this method by providing its own implementation then that
+// implementation MUST invoke this method directly.
+func (w *XLSXWriter) Flush() error {
+	if w.sheet == nil {
+		if err := w.startDefaultSheet(); err != nil {
+			return err
+		}
+	}
+	if err := w.endSheet(); err != nil {
+		return err
+	}
+	if err := w.writeParts(); err != nil {
+		return err
+	}
+	return w.zw.Close()
+}
+
+// NewSheet finishes the current sheet, if any, and starts a new sheet with
+// the given name, header, and column widths. The rows written after NewSheet
+// are added to the new sheet. The name must be unique within the workbook,
+// at most 31 characters long, and must not contain any of the characters
+// : \ / ? * [ ].
+func (w *XLSXWriter) NewSheet(name string, header []string, widths []float64) error {
+	if err := checkXLSXSheetName(name, w.sheets); err != nil {
+		return err
+	}
+	if w.sheet != nil {
+		if err := w.endSheet(); err != nil {
+			return err
+		}
+	}
+	return w.startSheet(name, header, widths)
+}
+
+// WriteRow writes the given row to the current sheet. If no sheet was started
+// yet, a sheet is started using the SheetName, Header, and Widths fields. This
+// method SHOULD be invoked directly by the user code.
+func (w *XLSXWriter) WriteRow(row []interface{}) error {
+	if w.sheet == nil {
+		if err := w.startDefaultSheet(); err != nil {
+			return err
+		}
+	}
+	return w.writeRow(row, xlsxStyleDefault)
+}
+
+// startDefaultSheet starts the first sheet using the writer's fields.
+func (w *XLSXWriter) startDefaultSheet() error {
+	name := w.SheetName
+	if len(name) == 0 {
+		name = defaultXLSXSheetName
+	}
+	if err := checkXLSXSheetName(name, w.sheets); err != nil {
+		return err
+	}
+	return w.startSheet(name, w.Header, w.Widths)
+}
+
+// startSheet starts the zip entry of a new sheet and writes the
+// sheet's column widths and header row to it. If this is the first
+// sheet, the http headers are written as well.
+func (w *XLSXWriter) startSheet(name string, header []string, widths []float64) (err error) {
+	if w.zw == nil {
+		if len(w.FileName) > 0 {
+			w.rw.Header().Set("Content-Disposition", contentDisposition("attachment", w.FileName))
+		} else {
+			w.rw.Header().Set("Content-Disposition", "attachment")
+		}
+		w.rw.Header().Set("Content-Type", contentTypeXLSX)
+		if w.StatusCode == 0 {
+			w.StatusCode = http.StatusOK
+		}
+		w.rw.WriteHeader(w.StatusCode)
+		w.zw = zip.NewWriter(w.rw)
+	}
+
+	w.sheets = append(w.sheets, name)
+	w.rows = 0
+	if w.sheet, err = w.zw.Create("xl/worksheets/sheet" + strconv.Itoa(len(w.sheets)) + ".xml"); err != nil {
+		return err
+	}
+
+	w.buf.Reset()
+	w.buf.WriteString(xml.Header)
+	w.buf.WriteString(`<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main">`)
+	if hasXLSXWidths(widths) {
+		w.buf.WriteString(`<cols>`)
+		for i, width := range widths {
+			if width > 0 {
+				n := strconv.Itoa(i + 1)
+				fmt.Fprintf(&w.buf, `<col min="%s" max="%s" width="%s" customWidth="1"/>`,
+					n, n, strconv.FormatFloat(width, 'f', -1, 64))
+			}
+		}
+		w.buf.WriteString(`</cols>`)
+	}
+	w.buf.WriteString(`<sheetData>`)
+	if _, err := w.sheet.Write(w.buf.Bytes()); err != nil {
+		return err
+	}
+
+	if len(header) > 0 {
+		row := make([]interface{}, len(header))
+		for i, h := range header {
+			row[i] = h
+		}
+		return w.writeRow(row, xlsxStyleHeader)
+	}
+	return nil
+}
+
+// endSheet closes the current sheet's xml document.
+func (w *XLSXWriter) endSheet() error {
+	_, err := io.WriteString(w.sheet, `</sheetData></worksheet>`)
+	w.sheet = nil
+	return err
+}
+
+// writeRow encodes the given row and writes it to the current sheet. The
+// style is applied to the row's cells unless the cell's value requires
+// a specific style.
+func (w *XLSXWriter) writeRow(row []interface{}, style int) error {
+	w.rows++
+	r := strconv.Itoa(w.rows)
+
+	w.buf.Reset()
+	w.buf.WriteString(`<row r="` + r + `">`)
+	for i, v := range row {
+		writeXLSXCell(&w.buf, xlsxColumnName(i)+r, v, style)
+	}
+	w.buf.WriteString(`</row>`)
+	_, err := w.sheet.Write(w.buf.Bytes())
+	return err
+}
+
+// writeParts writes the workbook's parts other than the sheets.
+func (w *XLSXWriter) writeParts() error {
+	var types, workbook, rels bytes.Buffer
+
+	types.WriteString(xml.Header)
+	types.WriteString(`<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types">` +
+		`<Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/>` +
+		`<Default Extension="xml" ContentType="application/xml"/>` +
+		`<Override PartName="/xl/workbook.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"/>` +
+		`<Override PartName="/xl/styles.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.styles+xml"/>`)
+
+	workbook.WriteString(xml.Header)
+	workbook.WriteString(`<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"` +
+		` xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships"><sheets>`)
+
+	rels.WriteString(xml.Header)
+	rels.WriteString(`<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">`)
+
+	for i, name := range w.sheets {
+		n := strconv.Itoa(i + 1)
+		types.WriteString(`<Override PartName="/xl/worksheets/sheet` + n + `.xml"` +
+			` ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/>`)
+
+		workbook.WriteString(`<sheet name="`)
+		xml.EscapeText(&workbook, []byte(name))
+		workbook.WriteString(`" sheetId="` + n + `" r:id="rId` + n + `"/>`)
+
+		rels.WriteString(`<Relationship Id="rId` + n + `"` +
+			` Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet"` +
+			` Target="worksheets/sheet` + n + `.xml"/>`)
+	}
+
+	types.WriteString(`</Types>`)
+	workbook.WriteString(`</sheets></workbook>`)
+	rels.WriteString(`<Relationship Id="rId` + strconv.Itoa(len(w.sheets)+1) + `"` +
+		` Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/styles"` +
+		` Target="styles.xml"/></Relationships>`)
+
+	parts := []struct {
+		name string
+		data []byte
+	}{
+		{"[Content_Types].xml", types.Bytes()},
+		{"_rels/.rels", []byte(xlsxRootRels)},
+		{"xl/workbook.xml", workbook.Bytes()},
+		{"xl/_rels/workbook.xml.rels", rels.Bytes()},
+		{"xl/styles.xml", []byte(xlsxStyles)},
+	}
+	for _, p := range parts {
+		f, err := w.zw.Create(p.name)
+		if err != nil {
+			return err
+		}
+		if _, err := f.Write(p.data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+const xlsxRootRels = xml.Header +
+	`<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+	`<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument"` +
+	` Target="xl/workbook.xml"/></Relationships>`
+
+// xlsxStyles defines the cell styles referenced by the xlsxStyle constants.
+const xlsxStyles = xml.Header +
+	`<styleSheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main">` +
+	`<numFmts count="2">` +
+	`<numFmt numFmtId="164" formatCode="yyyy\-mm\-dd"/>` +
+	`<numFmt numFmtId="165" formatCode="yyyy\-mm\-dd\ hh:mm:ss"/>` +
+	`</numFmts>` +
+	`<fonts count="2">` +
+	`<font><sz val="11"/><name val="Calibri"/></font>` +
+	`<font><b/><sz val="11"/><name val="Calibri"/></font>` +
+	`</fonts>` +
+	`<fills count="2">` +
+	`<fill><patternFill patternType="none"/></fill>` +
+	`<fill><patternFill patternType="gray125"/></fill>` +
+	`</fills>` +
+	`<borders count="1"><border><left/><right/><top/><bottom/><diagonal/></border></borders>` +
+	`<cellStyleXfs count="1"><xf numFmtId="0" fontId="0" fillId="0" borderId="0"/></cellStyleXfs>` +
+	`<cellXfs count="4">` +
+	`<xf numFmtId="0" fontId="0" fillId="0" borderId="0" xfId="0"/>` +
+	`<xf numFmtId="0" fontId="1" fillId="0" borderId="0" xfId="0" applyFont="1"/>` +
+	`<xf numFmtId="164" fontId="0" fillId="0" borderId="0" xfId="0" applyNumberFormat="1"/>` +
+	`<xf numFmtId="165" fontId="0" fillId="0" borderId="0" xfId="0" applyNumberFormat="1"/>` +
+	`</cellXfs>` +
+	`<cellStyles count="1"><cellStyle name="Normal" xfId="0" builtinId="0"/></cellStyles>` +
+	`</styleSheet>`
+
+// writeXLSXCell writes the cell with the given reference and value to buf.
+func writeXLSXCell(buf *bytes.Buffer, ref string, v interface{}, style int) {
+	rv := reflect.ValueOf(v)
+	for rv.Kind() == reflect.Ptr || rv.Kind() == reflect.Interface {
+		if rv.IsNil() {
+			return
+		}
+		rv = rv.Elem()
+	}
+	if !rv.IsValid() {
+		return
+	}
+
+	cell := func(typ, value string, style int) {
+		buf.WriteString(`<c r="` + ref + `"`)
+		if style != xlsxStyleDefault {
+			buf.WriteString(` s="` + strconv.Itoa(style) + `"`)
+		}
+		if len(typ) > 0 {
+			buf.WriteString(` t="` + typ + `"`)
+		}
+		buf.WriteString(`><v>` + value + `</v></c>`)
+	}
+
+	if rv.Type() == timeType {
+		t := rv.Interface().(time.Time)
+		if h, m, s := t.Clock(); h == 0 && m == 0 && s == 0 && t.Nanosecond() == 0 {
+			cell("", xlsxSerialDate(t), xlsxStyleDate)
+		} else {
+			cell("", xlsxSerialDate(t), xlsxStyleDateTime)
+		}
+		return
+	}
+
+	switch rv.Kind() {
+	case reflect.Bool:
+		if rv.Bool() {
+			cell("b", "1", style)
+		} else {
+			cell("b", "0", style)
+		}
+		return
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		cell("", strconv.FormatInt(rv.Int(), 10), style)
+		return
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		cell("", strconv.FormatUint(rv.Uint(), 10), style)
+		return
+	case reflect.Float32, reflect.Float64:
+		if f := rv.Float(); !math.IsNaN(f) && !math.IsInf(f, 0) {
+			cell("", strconv.FormatFloat(f, 'f', -1, rv.Type().Bits()), style)
+			return
+		}
+	}
+
+	var s string
+	if rv.Kind() == reflect.String {
+		s = rv.String()
+	} else {
+		s = fmt.Sprint(rv.Interface())
+	}
+	buf.WriteString(`<c r="` + ref + `"`)
+	if style != xlsxStyleDefault {
+		buf.WriteString(` s="` + strconv.Itoa(style) + `"`)
+	}
+	buf.WriteString(` t="inlineStr"><is><t xml:space="preserve">`)
+	xml.EscapeText(buf, []byte(s))
+	buf.WriteString(`</t></is></c>`)
+}
+
+// The Unix time of the epoch of spreadsheet serial dates, 1899-12-30.
+const xlsxEpoch = -2209161600
+
+// xlsxSerialDate returns the spreadsheet serial date of the wall clock time of t.
+func xlsxSerialDate(t time.Time) string {
+	wall := time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), time.UTC)
+	days := (float64(wall.Unix()-xlsxEpoch) + float64(wall.Nanosecond())/1e9) / 86400
+	return strconv.FormatFloat(days, 'f', -1, 64)
+}
+
+// xlsxColumnName returns the name of the column with the given index, e.g. 0 -> "A", 27 -> "AB".
+func xlsxColumnName(i int) string {
+	var name []byte
+	for i++; i > 0; i = (i - 1) / 26 {
+		name = append([]byte{byte('A' + (i-1)%26)}, name...)
+	}
+	return string(name)
+}
+
+// hasXLSXWidths reports whether any of the given widths are set.
+func hasXLSXWidths(widths []float64) bool {
+	for _, w := range widths {
+		if w > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// checkXLSXSheetName returns an error if the given name is not a valid sheet
+// name, or if it is already used by one of the existing sheets.
+func checkXLSXSheetName(name string, existing []string) error {
+	switch {
+	case len(name) == 0:
+		return errors.New("httpcrud/httpio: xlsx sheet name must not be empty")
+	case len([]rune(name)) > 31:
+		return fmt.Errorf("httpcrud/httpio: xlsx sheet name %q is longer than 31 characters", name)
+	case strings.ContainsAny(name, `:\/?*[]`):
+		return fmt.Errorf("httpcrud/httpio: xlsx sheet name %q contains an invalid character", name)
+	}
+	for _, s := range existing {
+		if strings.EqualFold(s, name) {
+			return fmt.Errorf("httpcrud/httpio: duplicate xlsx sheet name %q", name)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,204 @@
+package httpio
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"io"
+	"io/ioutil"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/frk/compare"
+)
+
+// readXLSX returns the contents of the parts of the given xlsx file.
+func readXLSX(t *testing.T, data []byte) map[string]string {
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	parts := make(map[string]string)
+	for _, f := range zr.File {
+		rc, err := f.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, err := ioutil.ReadAll(rc)
+		rc.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// make sure each part is well-formed xml
+		dec := xml.NewDecoder(bytes.NewReader(b))
+		for {
+			if _, err := dec.Token(); err != nil {
+				if err != io.EOF {
+					t.Errorf("%s: %v", f.Name, err)
+				}
+				break
+			}
+		}
+		parts[f.Name] = string(b)
+	}
+	return parts
+}
+
+func TestXLSXWriter(t *testing.T) {
+	w := httptest.NewRecorder()
+	stream := &XLSXWriter{
+		Header:    []string{"id", "name", "price", "created", "active"},
+		Widths:    []float64{0, 20},
+		SheetName: "Products",
+		FileName:  "products.xlsx",
+	}
+	body := XLSX{stream}
+	if err := body.WriteInit(w); err != nil {
+		t.Fatal(err)
+	}
+
+	date := time.Date(2020, 1, 2, 0, 0, 0, 0, time.UTC)
+	datetime := time.Date(2020, 1, 2, 12, 0, 0, 0, time.FixedZone("", 3600))
+	rows := [][]interface{}{
+		{1, "a <b> & c", 9.5, date, true},
+		{uint8(2), nil, (*int)(nil), &datetime, false},
+	}
+	for _, row := range rows {
+		if err := stream.WriteRow(row); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := stream.NewSheet("Products", nil, nil); err == nil {
+		t.Error("got nil error, want duplicate sheet name error")
+	}
+	if err := stream.NewSheet("Summary", []string{"total"}, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := stream.WriteRow([]interface{}{int64(2)}); err != nil {
+		t.Fatal(err)
+	}
+	if err := body.WriteBody(w, nil, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	if e := compare.Compare(w.Code, 200); e != nil {
+		t.Error(e)
+	}
+	if e := compare.Compare(w.Header().Get("Content-Type"), contentTypeXLSX); e != nil {
+		t.Error(e)
+	}
+	if e := compare.Compare(w.Header().Get("Content-Disposition"), "attachment; filename=products.xlsx"); e != nil {
+		t.Error(e)
+	}
+
+	parts := readXLSX(t, w.Body.Bytes())
+	for _, name := range []string{"[Content_Types].xml", "_rels/.rels", "xl/workbook.xml",
+		"xl/_rels/workbook.xml.rels", "xl/styles.xml"} {
+		if _, ok := parts[name]; !ok {
+			t.Errorf("missing part %q", name)
+		}
+	}
+
+	sheet1 := xml.Header + `<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main">` +
+		`<cols><col min="2" max="2" width="20" customWidth="1"/></cols><sheetData>` +
+		`<row r="1">` +
+		`<c r="A1" s="1" t="inlineStr"><is><t xml:space="preserve">id</t></is></c>` +
+		`<c r="B1" s="1" t="inlineStr"><is><t xml:space="preserve">name</t></is></c>` +
+		`<c r="C1" s="1" t="inlineStr"><is><t xml:space="preserve">price</t></is></c>` +
+		`<c r="D1" s="1" t="inlineStr"><is><t xml:space="preserve">created</t></is></c>` +
+		`<c r="E1" s="1" t="inlineStr"><is><t xml:space="preserve">active</t></is></c>` +
+		`</row>` +
+		`<row r="2">` +
+		`<c r="A2"><v>1</v></c>` +
+		`<c r="B2" t="inlineStr"><is><t xml:space="preserve">a &lt;b&gt; &amp; c</t></is></c>` +
+		`<c r="C2"><v>9.5</v></c>` +
+		`<c r="D2" s="2"><v>43832</v></c>` +
+		`<c r="E2" t="b"><v>1</v></c>` +
+		`</row>` +
+		`<row r="3">` +
+		`<c r="A3"><v>2</v></c>` +
+		`<c r="D3" s="3"><v>43832.5</v></c>` +
+		`<c r="E3" t="b"><v>0</v></c>` +
+		`</row>` +
+		`</sheetData></worksheet>`
+	if e := compare.Compare(parts["xl/worksheets/sheet1.xml"], sheet1); e != nil {
+		t.Error(e)
+	}
+
+	sheet2 := xml.Header + `<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><sheetData>` +
+		`<row r="1"><c r="A1" s="1" t="inlineStr"><is><t xml:space="preserve">total</t></is></c></row>` +
+		`<row r="2"><c r="A2"><v>2</v></c></row>` +
+		`</sheetData></worksheet>`
+	if e := compare.Compare(parts["xl/worksheets/sheet2.xml"], sheet2); e != nil {
+		t.Error(e)
+	}
+
+	if wb := parts["xl/workbook.xml"]; !strings.Contains(wb, `<sheet name="Products" sheetId="1" r:id="rId1"/>`) ||
+		!strings.Contains(wb, `<sheet name="Summary" sheetId="2" r:id="rId2"/>`) {
+		t.Errorf("unexpected workbook: %s", wb)
+	}
+	if rels := parts["xl/_rels/workbook.xml.rels"]; !strings.Contains(rels, `Id="rId3"`) {
+		t.Errorf("missing styles relationship: %s", rels)
+	}
+}
+
+func TestXLSXWriter_ZeroRows(t *testing.T) {
+	w := httptest.NewRecorder()
+	stream := &XLSXWriter{Header: []string{"id"}, StatusCode: 201}
+	body := XLSX{stream}
+	if err := body.WriteInit(w); err != nil {
+		t.Fatal(err)
+	}
+	if err := body.WriteBody(w, nil, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	if e := compare.Compare(w.Code, 201); e != nil {
+		t.Error(e)
+	}
+	parts := readXLSX(t, w.Body.Bytes())
+	want := xml.Header + `<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><sheetData>` +
+		`<row r="1"><c r="A1" s="1" t="inlineStr"><is><t xml:space="preserve">id</t></is></c></row>` +
+		`</sheetData></worksheet>`
+	if e := compare.Compare(parts["xl/worksheets/sheet1.xml"], want); e != nil {
+		t.Error(e)
+	}
+	if wb := parts["xl/workbook.xml"]; !strings.Contains(wb, `<sheet name="Sheet1"`) {
+		t.Errorf("unexpected workbook: %s", wb)
+	}
+}
+
+func TestXLSXColumnName(t *testing.T) {
+	tests := map[int]string{0: "A", 25: "Z", 26: "AA", 27: "AB", 701: "ZZ", 702: "AAA"}
+	for i, want := range tests {
+		if e := compare.Compare(xlsxColumnName(i), want); e != nil {
+			t.Errorf("%d: %v", i, e)
+		}
+	}
+}
+
+func TestCheckXLSXSheetName(t *testing.T) {
+	tests := []struct {
+		name  string
+		valid bool
+	}{
+		{"Sheet1", true},
+		{"", false},
+		{strings.Repeat("x", 32), false},
+		{"a/b", false},
+		{"[x]", false},
+		{"sheet1", false}, // duplicate, case-insensitive
+	}
+	for _, tt := range tests {
+		err := checkXLSXSheetName(tt.name, []string{"Sheet1"})
+		if tt.name == "Sheet1" {
+			err = checkXLSXSheetName(tt.name, nil)
+		}
+		if (err == nil) != tt.valid {
+			t.Errorf("%q: got err %v, want valid=%t", tt.name, err, tt.valid)
+		}
+	}
+}
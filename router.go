@@ -2,8 +2,10 @@ package httpcrud
 
 import (
 	"context"
+	"errors"
 	"net/http"
 
+	"github.com/frk/httpcrud/httpio"
 	"github.com/frk/route"
 )
 
@@ -20,11 +22,22 @@ type HandlerInitializerAdapter interface {
 //
 // If no ErrorHandler is provided, then by default the http.Error function is
 // used to write the response using the err.Error() as the response text and
-// the http.StatusBadRequest as the status code.
+// the http.StatusBadRequest as the status code. If, however, the error, or
+// any error in its chain, implements the StatusCoder interface, then the
+// status code returned by its StatusCode method will be used instead. And if
+// the error, or any error in its chain, implements the httpio.HeaderWriter
+// interface, then its WriteHeader method will be invoked with the response's
+// header before the response is written.
 type ErrorHandler interface {
 	HandleError(w http.ResponseWriter, r *http.Request, err error)
 }
 
+// StatusCoder is the interface implemented by errors that know which
+// HTTP status code should be used to respond to the client with.
+type StatusCoder interface {
+	StatusCode() int
+}
+
 // RouteOptions is a set of options that, if set, will be applied
 // to each route being registered.
 type RouteOptions struct {
@@ -36,11 +49,33 @@ type RouteOptions struct {
 	ErrorHandler ErrorHandler
 	// The prefix to be applied to the routes' paths.
 	PathPrefix string
-
-	// TODO(mkopriva): to some benefit RouteOptions could probably provide
-	// a field to specify a list of middleware that could then be used to
-	// wrap around the http.Handlers (routeHandler/httpHandler) that are
-	// to be registered by the InitXxx functions.
+	// If set, limits the size of the request bodies to MaxBodyBytes bytes,
+	// see httpio.LimitBody. Individual handlers can override the limit using
+	// the httpio.RequestReader's MaxBodyBytes or their BodyReader's limit.
+	MaxBodyBytes int64
+	// The list of middleware to be wrapped around the http.Handlers that
+	// are registered by the InitXxx functions. The first middleware in
+	// the list will be the outermost one.
+	Middleware []func(http.Handler) http.Handler
+	// If set, the responses of the GET routes will be cached and served
+	// from the ResponseCache, see httpio.ResponseCache. The cache is the
+	// innermost middleware, but it is still outside of the Handler, which
+	// means that a stored response is served without invoking the Handler's
+	// AuthCheck. Responses that depend on the client's identity must not
+	// therefore be marked as shareable by a cache.
+	ResponseCache *httpio.ResponseCache
+	// If set, the CORS headers will be added to the responses, including
+	// the error responses, of the routes that don't have their own CORS
+	// config. The CORS middleware is the outermost one.
+	//
+	// For every path that has a CORS config, and no OPTIONS route, an OPTIONS
+	// route will be registered automatically to answer the preflight requests.
+	// The preflight requests are answered using the CORS config of the route
+	// whose method was requested, and without invoking the middleware. Only
+	// the methods whose routes share that config are allowed, and a preflight
+	// request for a method whose route has no CORS config is answered without
+	// the CORS headers.
+	CORS *httpio.CORS
 }
 
 // RouteList is a list of settings used to register HandlerInitializers for the specified paths.
@@ -51,6 +86,8 @@ type RouteList []struct {
 	Method string
 	// The HandlerInitializer to be registered.
 	HandlerInitializer interface{}
+	// If set, overrides the RouteOptions' CORS config for the route.
+	CORS *httpio.CORS
 }
 
 // InitRouter takes the HandlerInitializers in the provided RouteList
@@ -70,18 +107,52 @@ func InitRouter(r *route.Router, routes RouteList, opts RouteOptions) {
 		handler := new(routeHandler)
 		handler.init = opts.HandlerInitializerAdapter.AdaptHandlerInitializer(rt.HandlerInitializer, path, method)
 		handler.eh = opts.ErrorHandler
+		handler.maxBody = opts.MaxBodyBytes
+		if mw := routeMiddleware(opts, method, rt.CORS); len(mw) > 0 {
+			handler.next = wrapMiddleware(http.HandlerFunc(handler.serveMiddleware), mw)
+		}
 
 		r.Handle(method, path, handler)
 	}
+
+	for _, ph := range preflightHandlers(routes, opts) {
+		ph := ph
+		r.Handle(http.MethodOptions, ph.path, route.HandlerFunc(func(_ context.Context, w http.ResponseWriter, r *http.Request) {
+			ph.ServeHTTP(w, r)
+		}))
+	}
 }
 
 // routeHandler is a wrapper around handlerExecer that implements the route.Handler interface.
 type routeHandler struct {
 	handlerExecer
-	eh ErrorHandler
+	eh      ErrorHandler
+	maxBody int64
+	// The route's middleware chain wrapped around serveMiddleware, or nil
+	// if the route has no middleware.
+	next http.Handler
 }
 
 func (h *routeHandler) ServeHTTP(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+	if h.next == nil {
+		h.serveHTTP(ctx, w, r)
+		return
+	}
+
+	// The route.Params are carried over to the middleware chain
+	// by the request's context since the chain is shared by all
+	// of the route's requests.
+	r = r.WithContext(route.Context(r.Context(), route.GetParams(ctx)))
+	h.next.ServeHTTP(w, r)
+}
+
+// serveMiddleware is the innermost handler of the route's middleware chain.
+func (h *routeHandler) serveMiddleware(w http.ResponseWriter, r *http.Request) {
+	h.serveHTTP(r.Context(), w, r)
+}
+
+func (h *routeHandler) serveHTTP(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+	httpio.LimitBody(w, r, h.maxBody)
 	if err := h.serve(w, r, ctx); err != nil {
 		h.eh.HandleError(w, r, err)
 	}
@@ -121,27 +192,149 @@ func InitServeMux(m *http.ServeMux, routes RouteList, opts RouteOptions) {
 		handler := new(httpHandler)
 		handler.init = opts.HandlerInitializerAdapter.AdaptHandlerInitializer(rt.HandlerInitializer, path, method)
 		handler.eh = opts.ErrorHandler
+		handler.maxBody = opts.MaxBodyBytes
 
-		mux.Handle(path, handler)
+		mux.Handle(path, wrapMiddleware(handler, routeMiddleware(opts, method, rt.CORS)))
+	}
+
+	for _, ph := range preflightHandlers(routes, opts) {
+		mux, ok := muxmap[http.MethodOptions]
+		if !ok {
+			mux = http.NewServeMux()
+			muxmap[http.MethodOptions] = mux
+		}
+		mux.Handle(ph.path, ph)
 	}
 }
 
 // httpHandler is a wrapper around handlerExecer that implements the http.Handler interface.
 type httpHandler struct {
 	handlerExecer
-	eh ErrorHandler
+	eh      ErrorHandler
+	maxBody int64
 }
 
 func (h *httpHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	httpio.LimitBody(w, r, h.maxBody)
 	if err := h.serve(w, r, r.Context()); err != nil {
 		h.eh.HandleError(w, r, err)
 	}
 }
 
+// routeMiddleware returns the list of middleware to be wrapped around
+// the handler of a route with the given method and CORS config.
+func routeMiddleware(opts RouteOptions, method string, cors *httpio.CORS) []func(http.Handler) http.Handler {
+	if cors == nil {
+		cors = opts.CORS
+	}
+	cache := opts.ResponseCache
+	if method != http.MethodGet {
+		cache = nil
+	}
+	if cors == nil && cache == nil {
+		return opts.Middleware
+	}
+
+	mw := make([]func(http.Handler) http.Handler, 0, len(opts.Middleware)+2)
+	if cors != nil {
+		mw = append(mw, cors.Handler)
+	}
+	mw = append(mw, opts.Middleware...)
+	if cache != nil {
+		mw = append(mw, cache.Handler)
+	}
+	return mw
+}
+
+// preflightHandler answers the OPTIONS requests of a path.
+type preflightHandler struct {
+	path string
+	// the methods registered for the path
+	methods []string
+	// the CORS configs of the path's routes by their method
+	cors map[string]*httpio.CORS
+}
+
+func (h *preflightHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	cors, ok := h.cors[r.Header.Get("Access-Control-Request-Method")]
+	if !ok || len(r.Header.Get("Origin")) == 0 {
+		// Not a preflight request, or a preflight request for a method
+		// without a CORS config, which is answered without CORS headers.
+		(&httpio.CORS{}).ServePreflight(w, r, h.methods)
+		return
+	}
+
+	// Only the methods that share the config are allowed, the
+	// others may have a different config or none at all.
+	methods := make([]string, 0, len(h.methods))
+	for _, m := range h.methods {
+		if h.cors[m] == cors {
+			methods = append(methods, m)
+		}
+	}
+	cors.ServePreflight(w, r, methods)
+}
+
+// preflightHandlers returns the preflightHandlers for the paths of the given
+// routes that have a CORS config and that have no OPTIONS route registered.
+func preflightHandlers(routes RouteList, opts RouteOptions) (handlers []*preflightHandler) {
+	byPath := make(map[string]*preflightHandler)
+	skip := make(map[string]bool)
+	for _, rt := range routes {
+		path := opts.PathPrefix + rt.Path
+		if rt.Method == http.MethodOptions {
+			skip[path] = true
+			continue
+		}
+
+		ph, ok := byPath[path]
+		if !ok {
+			ph = &preflightHandler{path: path, cors: make(map[string]*httpio.CORS)}
+			byPath[path] = ph
+			handlers = append(handlers, ph)
+		}
+		cors := rt.CORS
+		if cors == nil {
+			cors = opts.CORS
+		}
+		if cors != nil {
+			ph.cors[rt.Method] = cors
+		}
+		ph.methods = append(ph.methods, rt.Method)
+	}
+
+	out := handlers[:0]
+	for _, ph := range handlers {
+		if !skip[ph.path] && len(ph.cors) > 0 {
+			out = append(out, ph)
+		}
+	}
+	return out
+}
+
+// wrapMiddleware wraps the given middleware around h, the first
+// middleware in the list will be the outermost one.
+func wrapMiddleware(h http.Handler, mw []func(http.Handler) http.Handler) http.Handler {
+	for i := len(mw) - 1; i >= 0; i-- {
+		h = mw[i](h)
+	}
+	return h
+}
+
 // Default ErrorHandler implementation.
 type errorHandler struct{}
 
 func (errorHandler) HandleError(w http.ResponseWriter, r *http.Request, err error) {
+	var hw httpio.HeaderWriter
+	if errors.As(err, &hw) {
+		hw.WriteHeader(w.Header())
+	}
+
+	var sc StatusCoder
+	if errors.As(err, &sc) {
+		http.Error(w, err.Error(), sc.StatusCode())
+		return
+	}
 	http.Error(w, err.Error(), http.StatusBadRequest)
 }
 
@@ -0,0 +1,356 @@
+package httpcrud
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/frk/compare"
+	"github.com/frk/httpcrud/httpio"
+	"github.com/frk/httpcrud/httpio/websocket"
+	"github.com/frk/route"
+)
+
+type unauthorizedError struct{}
+
+func (unauthorizedError) Error() string   { return "unauthorized" }
+func (unauthorizedError) StatusCode() int { return http.StatusUnauthorized }
+
+// fakehandler fails the AuthCheck if authErr is set,
+// otherwise it responds with 200 and the body "ok".
+type fakehandler struct {
+	NopHandler
+	authErr error
+}
+
+func (h fakehandler) Init(r *http.Request) Handler { return h }
+
+func (h fakehandler) AuthCheck(_ *http.Request, _ context.Context) error { return h.authErr }
+
+func (h fakehandler) WriteResponse(w http.ResponseWriter, _ *http.Request) error {
+	_, err := w.Write([]byte("ok"))
+	return err
+}
+
+// headerError is an error that writes the Retry-After header.
+type headerError struct{}
+
+func (headerError) Error() string                  { return "unavailable" }
+func (headerError) StatusCode() int                { return http.StatusServiceUnavailable }
+func (headerError) WriteHeader(header http.Header) { header.Set("Retry-After", "120") }
+
+func TestErrorHandler(t *testing.T) {
+	tests := []struct {
+		name   string
+		err    error
+		code   int
+		header http.Header
+	}{{
+		name:   "plain error",
+		err:    errors.New("bad"),
+		code:   400,
+		header: http.Header{},
+	}, {
+		name:   "status coder",
+		err:    unauthorizedError{},
+		code:   401,
+		header: http.Header{},
+	}, {
+		name:   "header writer",
+		err:    fmt.Errorf("wrapped: %w", headerError{}),
+		code:   503,
+		header: http.Header{"Retry-After": {"120"}},
+	}}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			errorHandler{}.HandleError(w, httptest.NewRequest("GET", "/", nil), tt.err)
+
+			if e := compare.Compare(w.Code, tt.code); e != nil {
+				t.Error(e)
+			}
+			got := w.Result().Header
+			got.Del("Content-Type")
+			got.Del("X-Content-Type-Options")
+			if e := compare.Compare(got, tt.header); e != nil {
+				t.Error(e)
+			}
+		})
+	}
+}
+
+func TestRouteOptions_CORS(t *testing.T) {
+	routes := RouteList{
+		{Path: "/items", Method: "GET", HandlerInitializer: fakehandler{authErr: unauthorizedError{}}},
+		{Path: "/items", Method: "POST", HandlerInitializer: fakehandler{}},
+		{Path: "/items/sync", Method: "PUT", HandlerInitializer: fakehandler{},
+			CORS: &httpio.CORS{AllowOrigins: []string{"https://admin.example.com"}, AllowCredentials: true}},
+		{Path: "/other", Method: "GET", HandlerInitializer: fakehandler{}},
+		{Path: "/other", Method: "OPTIONS", HandlerInitializer: fakehandler{}},
+	}
+	opts := RouteOptions{CORS: &httpio.CORS{AllowOrigins: []string{"https://*.example.com"}}}
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		header map[string]string
+		code   int
+		want   http.Header
+	}{{
+		name:   "error response",
+		method: "GET",
+		path:   "/items",
+		header: map[string]string{"Origin": "https://app.example.com"},
+		code:   401,
+		want: http.Header{
+			"Vary":                        {"Origin"},
+			"Access-Control-Allow-Origin": {"https://app.example.com"},
+		},
+	}, {
+		name:   "preflight",
+		method: "OPTIONS",
+		path:   "/items",
+		header: map[string]string{"Origin": "https://app.example.com", "Access-Control-Request-Method": "POST"},
+		code:   204,
+		want: http.Header{
+			"Vary":                         {"Origin", "Access-Control-Request-Method", "Access-Control-Request-Headers"},
+			"Access-Control-Allow-Origin":  {"https://app.example.com"},
+			"Access-Control-Allow-Methods": {"GET, POST"},
+		},
+	}, {
+		name:   "route cors preflight",
+		method: "OPTIONS",
+		path:   "/items/sync",
+		header: map[string]string{"Origin": "https://admin.example.com", "Access-Control-Request-Method": "PUT"},
+		code:   204,
+		want: http.Header{
+			"Vary":                             {"Origin", "Access-Control-Request-Method", "Access-Control-Request-Headers"},
+			"Access-Control-Allow-Origin":      {"https://admin.example.com"},
+			"Access-Control-Allow-Credentials": {"true"},
+			"Access-Control-Allow-Methods":     {"PUT"},
+		},
+	}, {
+		name:   "route cors",
+		method: "PUT",
+		path:   "/items/sync",
+		header: map[string]string{"Origin": "https://app.example.com"},
+		code:   200,
+		want:   http.Header{"Vary": {"Origin"}},
+	}, {
+		name:   "registered options route",
+		method: "OPTIONS",
+		path:   "/other",
+		header: map[string]string{"Origin": "https://app.example.com", "Access-Control-Request-Method": "GET"},
+		code:   200,
+		want: http.Header{
+			"Vary":                        {"Origin"},
+			"Access-Control-Allow-Origin": {"https://app.example.com"},
+		},
+	}}
+
+	rr := route.NewRouter()
+	InitRouter(rr, routes, opts)
+	mux := http.NewServeMux()
+	InitServeMux(mux, routes, opts)
+
+	for _, h := range []http.Handler{rr, mux} {
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				r := httptest.NewRequest(tt.method, tt.path, nil)
+				for k, v := range tt.header {
+					r.Header.Set(k, v)
+				}
+				w := httptest.NewRecorder()
+				h.ServeHTTP(w, r)
+
+				if e := compare.Compare(w.Code, tt.code); e != nil {
+					t.Error(e)
+				}
+				got := w.Result().Header
+				got.Del("Content-Type")
+				got.Del("X-Content-Type-Options")
+				if e := compare.Compare(got, tt.want); e != nil {
+					t.Error(e)
+				}
+			})
+		}
+	}
+}
+
+func TestRouteOptions_CORS_Preflight(t *testing.T) {
+	admin := &httpio.CORS{AllowOrigins: []string{"https://admin.example.com"}, AllowCredentials: true}
+	routes := RouteList{
+		{Path: "/items", Method: "GET", HandlerInitializer: fakehandler{}, CORS: admin},
+		{Path: "/items", Method: "PUT", HandlerInitializer: fakehandler{}, CORS: admin},
+		{Path: "/items", Method: "POST", HandlerInitializer: fakehandler{},
+			CORS: &httpio.CORS{AllowOrigins: []string{"https://admin.example.com"}}},
+		{Path: "/items", Method: "DELETE", HandlerInitializer: fakehandler{}},
+	}
+	vary := []string{"Origin", "Access-Control-Request-Method", "Access-Control-Request-Headers"}
+
+	tests := []struct {
+		name   string
+		header map[string]string
+		want   http.Header
+	}{{
+		name:   "method with config",
+		header: map[string]string{"Origin": "https://admin.example.com", "Access-Control-Request-Method": "GET"},
+		want: http.Header{
+			"Vary":                             vary,
+			"Access-Control-Allow-Origin":      {"https://admin.example.com"},
+			"Access-Control-Allow-Credentials": {"true"},
+			"Access-Control-Allow-Methods":     {"GET, PUT"},
+		},
+	}, {
+		name:   "method with another config",
+		header: map[string]string{"Origin": "https://admin.example.com", "Access-Control-Request-Method": "POST"},
+		want: http.Header{
+			"Vary":                         vary,
+			"Access-Control-Allow-Origin":  {"https://admin.example.com"},
+			"Access-Control-Allow-Methods": {"POST"},
+		},
+	}, {
+		name:   "method without config",
+		header: map[string]string{"Origin": "https://admin.example.com", "Access-Control-Request-Method": "DELETE"},
+		want:   http.Header{"Vary": vary},
+	}, {
+		name: "not a preflight",
+		want: http.Header{"Allow": {"GET, PUT, POST, DELETE, OPTIONS"}},
+	}}
+
+	rr := route.NewRouter()
+	InitRouter(rr, routes, RouteOptions{})
+	mux := http.NewServeMux()
+	InitServeMux(mux, routes, RouteOptions{})
+
+	for _, h := range []http.Handler{rr, mux} {
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				r := httptest.NewRequest("OPTIONS", "/items", nil)
+				for k, v := range tt.header {
+					r.Header.Set(k, v)
+				}
+				w := httptest.NewRecorder()
+				h.ServeHTTP(w, r)
+
+				if e := compare.Compare(w.Code, http.StatusNoContent); e != nil {
+					t.Error(e)
+				}
+				if e := compare.Compare(w.Result().Header, tt.want); e != nil {
+					t.Error(e)
+				}
+			})
+		}
+	}
+}
+
+// wshandler upgrades the connection to the WebSocket protocol
+// and then closes it.
+type wshandler struct {
+	NopHandler
+	up websocket.Upgrader
+}
+
+type wsinit struct{}
+
+func (wsinit) Init(r *http.Request) Handler { return &wshandler{} }
+
+func (h *wshandler) ReadRequest(r *http.Request, _ context.Context) error {
+	return h.up.ReadBody(r)
+}
+
+func (h *wshandler) InitResponse(w http.ResponseWriter) error {
+	return h.up.WriteInit(w)
+}
+
+func (h *wshandler) WriteResponse(w http.ResponseWriter, r *http.Request) error {
+	return h.up.WriteBody(w, r, 0)
+}
+
+func TestRouteOptions_ResponseCache_WebSocket(t *testing.T) {
+	routes := RouteList{{Path: "/ws", Method: "GET", HandlerInitializer: wsinit{}}}
+	opts := RouteOptions{ResponseCache: &httpio.ResponseCache{}}
+
+	rr := route.NewRouter()
+	InitRouter(rr, routes, opts)
+	mux := http.NewServeMux()
+	InitServeMux(mux, routes, opts)
+
+	for _, h := range []http.Handler{rr, mux} {
+		srv := httptest.NewServer(h)
+		nc, err := net.Dial("tcp", srv.Listener.Addr().String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		req := "GET /ws HTTP/1.1\r\n" +
+			"Host: " + srv.Listener.Addr().String() + "\r\n" +
+			"Upgrade: websocket\r\n" +
+			"Connection: Upgrade\r\n" +
+			"Sec-WebSocket-Key: dGhlIHNhbXBsZSBub25jZQ==\r\n" +
+			"Sec-WebSocket-Version: 13\r\n\r\n"
+		if _, err := nc.Write([]byte(req)); err != nil {
+			t.Fatal(err)
+		}
+		resp, err := http.ReadResponse(bufio.NewReader(nc), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if e := compare.Compare(resp.StatusCode, http.StatusSwitchingProtocols); e != nil {
+			t.Error(e)
+		}
+		nc.Close()
+		srv.Close()
+	}
+}
+
+// paramhandler responds with the value of the "id" path parameter.
+type paramhandler struct {
+	NopHandler
+	id string
+}
+
+type paraminit struct{}
+
+func (paraminit) Init(r *http.Request) Handler { return &paramhandler{} }
+
+func (h *paramhandler) ReadRequest(_ *http.Request, ctx context.Context) error {
+	h.id = route.GetParams(ctx).GetString("id")
+	return nil
+}
+
+func (h *paramhandler) WriteResponse(w http.ResponseWriter, _ *http.Request) error {
+	_, err := w.Write([]byte(h.id))
+	return err
+}
+
+func TestInitRouter_Middleware(t *testing.T) {
+	var calls int
+	mw := func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			calls++
+			next.ServeHTTP(w, r)
+		})
+	}
+	routes := RouteList{{Path: "/items/{id}", Method: "GET", HandlerInitializer: paraminit{}}}
+
+	rr := route.NewRouter()
+	InitRouter(rr, routes, RouteOptions{Middleware: []func(http.Handler) http.Handler{mw}})
+
+	for _, id := range []string{"1", "2"} {
+		w := httptest.NewRecorder()
+		rr.ServeHTTP(w, httptest.NewRequest("GET", "/items/"+id, nil))
+		if e := compare.Compare(w.Body.String(), id); e != nil {
+			t.Error(e)
+		}
+	}
+	if e := compare.Compare(calls, 2); e != nil {
+		t.Error(e)
+	}
+}